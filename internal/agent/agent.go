@@ -0,0 +1,264 @@
+// Package agent keeps credentials in memory in a long-running process and
+// serves them to get over a Unix socket, so that kubectl calls neither read
+// the cache file nor log in to Vault. Only processes of the user running the
+// agent are served.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/efortin/kubectl-auth-vault/internal/cache"
+	"github.com/efortin/kubectl-auth-vault/internal/source"
+)
+
+// DefaultRefreshInterval is how often the agent looks for credentials to
+// refresh.
+const DefaultRefreshInterval = 15 * time.Second
+
+// DefaultIdleTimeout is how long the agent keeps refreshing a credential no
+// client asked for.
+const DefaultIdleTimeout = 8 * time.Hour
+
+// DefaultSocket returns the socket the agent listens on by default.
+func DefaultSocket() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = os.TempDir()
+	}
+	return filepath.Join(homeDir, ".kube", "vault_agent.sock")
+}
+
+// Request asks the agent for a credential.
+type Request struct {
+	// VaultAddr and Namespace must match the ones of the agent, so that a
+	// credential is never taken from another Vault than the one configured.
+	VaultAddr string `json:"vault_addr"`
+	Namespace string `json:"namespace,omitempty"`
+	// Source and Settings are the name of the credential source and the
+	// values of its flags, as returned by source.Settings.
+	Source   string            `json:"source"`
+	Settings map[string]string `json:"settings,omitempty"`
+	// Policy is the refresh policy of the client. The agent refreshes a
+	// credential when either its own policy or the one of the last client
+	// asking for it tells so.
+	Policy cache.RefreshPolicy `json:"policy"`
+}
+
+// Response answers a Request with the credential or an error.
+type Response struct {
+	Credential *cache.TokenCache `json:"credential,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// Fetcher gets a new credential from src, logging in to Vault as needed.
+type Fetcher func(ctx context.Context, src source.Source) (*cache.TokenCache, error)
+
+// Revoker revokes the Vault lease of a credential the agent no longer holds.
+type Revoker func(ctx context.Context, entry *cache.TokenCache) error
+
+// Agent holds the credentials asked for by clients and refreshes them before
+// they are due for a refresh, so that clients are answered from memory.
+type Agent struct {
+	// VaultAddr and Namespace are the Vault server the agent gets
+	// credentials from.
+	VaultAddr string
+	Namespace string
+	Fetch     Fetcher
+	// Revoke, when set, revokes the lease of the credentials replaced by a
+	// refresh, dropped as idle or still held when Serve returns, so that the
+	// service accounts of the Kubernetes secrets engine do not outlive them.
+	Revoke Revoker
+	// Policy tells when a credential is due for a refresh. Credentials are
+	// refreshed RefreshInterval ahead of it.
+	Policy          cache.RefreshPolicy
+	RefreshInterval time.Duration
+	// IdleTimeout drops the credentials no client asked for during that
+	// time instead of refreshing them.
+	IdleTimeout time.Duration
+	// Logf reports refreshes and the errors of background refreshes when
+	// set.
+	Logf func(format string, args ...interface{})
+
+	mu    sync.Mutex
+	creds map[string]*heldCredential
+}
+
+type heldCredential struct {
+	// mu is held while fetching, so a credential is fetched only once for
+	// concurrent requests.
+	mu       sync.Mutex
+	src      source.Source
+	entry    *cache.TokenCache
+	policy   cache.RefreshPolicy
+	lastUsed time.Time
+}
+
+// Get returns the credential asked for by req, fetching it when the agent
+// does not hold a fresh one.
+func (a *Agent) Get(ctx context.Context, req *Request) (*cache.TokenCache, error) {
+	if req.VaultAddr != a.VaultAddr || req.Namespace != a.Namespace {
+		return nil, fmt.Errorf("the agent gets credentials from %s, not %s",
+			describeVault(a.VaultAddr, a.Namespace), describeVault(req.VaultAddr, req.Namespace))
+	}
+
+	// Settings that are not part of the cache key, such as a TTL, still
+	// configure another credential.
+	settings, err := json.Marshal(req.Settings)
+	if err != nil {
+		return nil, err
+	}
+	key := req.Source + string(settings)
+
+	a.mu.Lock()
+	held, ok := a.creds[key]
+	if !ok {
+		src, err := source.Build(req.Source, req.Settings)
+		if err != nil {
+			a.mu.Unlock()
+			return nil, err
+		}
+		held = &heldCredential{src: src}
+		if a.creds == nil {
+			a.creds = make(map[string]*heldCredential)
+		}
+		a.creds[key] = held
+	}
+	held.lastUsed = time.Now()
+	a.mu.Unlock()
+
+	held.mu.Lock()
+	defer held.mu.Unlock()
+	held.policy = req.Policy
+	if held.entry != nil && !a.needsRefresh(held, time.Now()) {
+		return held.entry, nil
+	}
+	if err := a.refresh(ctx, held); err != nil {
+		return nil, err
+	}
+	return held.entry, nil
+}
+
+// Run refreshes the held credentials every RefreshInterval until ctx is
+// done.
+func (a *Agent) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.RefreshDue(ctx, time.Now())
+		}
+	}
+}
+
+// RefreshDue refreshes the credentials due for a refresh before the next
+// tick of Run after now, and drops the idle ones. A credential that fails to
+// refresh is kept until it is due, when clients get the error instead.
+func (a *Agent) RefreshDue(ctx context.Context, now time.Time) {
+	a.mu.Lock()
+	var due, idle []*heldCredential
+	for key, held := range a.creds {
+		if now.Sub(held.lastUsed) > a.IdleTimeout {
+			a.logf("Dropped idle credential %s", held.src.CacheKey())
+			delete(a.creds, key)
+			idle = append(idle, held)
+			continue
+		}
+		due = append(due, held)
+	}
+	a.mu.Unlock()
+
+	for _, held := range idle {
+		a.drop(ctx, held)
+	}
+
+	for _, held := range due {
+		held.mu.Lock()
+		if held.entry != nil && a.needsRefresh(held, now.Add(a.RefreshInterval)) {
+			if err := a.refresh(ctx, held); err != nil {
+				a.logf("Failed to refresh %s: %v", held.src.CacheKey(), err)
+			}
+		}
+		held.mu.Unlock()
+	}
+}
+
+// needsRefresh reports whether the credential of held, which must be locked,
+// is due for a refresh at now under the policy of the agent or of the last
+// client asking for it.
+func (a *Agent) needsRefresh(held *heldCredential, now time.Time) bool {
+	return a.Policy.NeedsRefreshEntry(held.entry, now) || held.policy.NeedsRefreshEntry(held.entry, now)
+}
+
+// refresh fetches a new credential for held, which must be locked, and
+// revokes the lease of the one it replaces.
+func (a *Agent) refresh(ctx context.Context, held *heldCredential) error {
+	entry, err := a.Fetch(ctx, held.src)
+	if err != nil {
+		return err
+	}
+	old := held.entry
+	held.entry = entry
+	a.logf("Refreshed %s, expiring at %s", held.src.CacheKey(), time.Unix(entry.Exp, 0).UTC().Format(time.RFC3339))
+	if old != nil {
+		a.revoke(ctx, held.src, old)
+	}
+	return nil
+}
+
+// dropAll forgets all the held credentials, revoking their leases.
+func (a *Agent) dropAll(ctx context.Context) {
+	a.mu.Lock()
+	creds := a.creds
+	a.creds = nil
+	a.mu.Unlock()
+
+	for _, held := range creds {
+		a.drop(ctx, held)
+	}
+}
+
+// drop revokes the lease of the credential of held, which is no longer
+// listed by the agent.
+func (a *Agent) drop(ctx context.Context, held *heldCredential) {
+	held.mu.Lock()
+	defer held.mu.Unlock()
+	if held.entry != nil {
+		a.revoke(ctx, held.src, held.entry)
+		held.entry = nil
+	}
+}
+
+// revoke revokes the lease of entry, if any and not expired yet. Failures
+// are only logged: the lease then expires with its TTL.
+func (a *Agent) revoke(ctx context.Context, src source.Source, entry *cache.TokenCache) {
+	if a.Revoke == nil || entry.LeaseID == "" || entry.Exp <= time.Now().Unix() {
+		return
+	}
+	if err := a.Revoke(ctx, entry); err != nil {
+		a.logf("Failed to revoke lease %s of %s: %v", entry.LeaseID, src.CacheKey(), err)
+		return
+	}
+	a.logf("Revoked lease %s of %s", entry.LeaseID, src.CacheKey())
+}
+
+func (a *Agent) logf(format string, args ...interface{}) {
+	if a.Logf != nil {
+		a.Logf(format, args...)
+	}
+}
+
+func describeVault(addr, namespace string) string {
+	if namespace == "" {
+		return addr
+	}
+	return fmt.Sprintf("%s (namespace %s)", addr, namespace)
+}
@@ -0,0 +1,243 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/agent"
+	"github.com/efortin/kubectl-auth-vault/internal/cache"
+	"github.com/efortin/kubectl-auth-vault/internal/source"
+	"github.com/efortin/kubectl-auth-vault/internal/source/sourcetest"
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+var fakeSource = &sourcetest.Fake{}
+
+func init() {
+	source.Register("fake", func() source.Builder { return fakeSource })
+}
+
+var _ = Describe("Agent", func() {
+	var (
+		a       *agent.Agent
+		req     *agent.Request
+		exp     int64
+		revoked []string
+	)
+
+	BeforeEach(func() {
+		exp = time.Now().Add(time.Hour).Unix()
+		*fakeSource = sourcetest.Fake{Key: "fake/token", Credential: &source.Credential{Token: "token-1", Exp: exp, LeaseID: "lease-1"}}
+		revoked = nil
+		a = &agent.Agent{
+			VaultAddr: "https://vault.example.com",
+			Fetch: func(ctx context.Context, src source.Source) (*cache.TokenCache, error) {
+				cred, err := src.Fetch(ctx, &vault.Client{})
+				if err != nil {
+					return nil, err
+				}
+				return &cache.TokenCache{Token: cred.Token, Exp: cred.Exp, TokenPath: src.CacheKey(), LeaseID: cred.LeaseID}, nil
+			},
+			Revoke: func(ctx context.Context, entry *cache.TokenCache) error {
+				revoked = append(revoked, entry.LeaseID)
+				return nil
+			},
+			Policy:          cache.RefreshPolicy{MinRemaining: 5 * time.Minute},
+			RefreshInterval: time.Minute,
+			IdleTimeout:     time.Hour,
+		}
+		req = &agent.Request{VaultAddr: "https://vault.example.com", Source: "fake"}
+	})
+
+	Describe("Get", func() {
+		It("should fetch a credential once and hold it", func() {
+			for i := 0; i < 2; i++ {
+				entry, err := a.Get(context.Background(), req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entry.Token).To(Equal("token-1"))
+			}
+			Expect(fakeSource.Fetches).To(Equal(1))
+		})
+
+		It("should fetch again a credential due for a refresh", func() {
+			fakeSource.Credential.Exp = time.Now().Add(time.Minute).Unix()
+			_, err := a.Get(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = a.Get(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeSource.Fetches).To(Equal(2))
+		})
+
+		It("should fetch again a credential due for a refresh under the policy of the client", func() {
+			_, err := a.Get(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			fakeSource.Credential = &source.Credential{Token: "token-2", Exp: exp + 3600}
+
+			req.Policy = cache.RefreshPolicy{MinRemaining: 2 * time.Hour}
+			entry, err := a.Get(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entry.Token).To(Equal("token-2"))
+			Expect(fakeSource.Fetches).To(Equal(2))
+		})
+
+		It("should refuse requests for another Vault", func() {
+			req.Namespace = "team-a"
+			_, err := a.Get(context.Background(), req)
+			Expect(err).To(MatchError("the agent gets credentials from https://vault.example.com, not https://vault.example.com (namespace team-a)"))
+			Expect(fakeSource.Fetches).To(BeZero())
+		})
+
+		It("should return fetch errors", func() {
+			fakeSource.Err = errors.New("permission denied")
+			_, err := a.Get(context.Background(), req)
+			Expect(err).To(MatchError("permission denied"))
+		})
+	})
+
+	Describe("RefreshDue", func() {
+		BeforeEach(func() {
+			_, err := a.Get(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			fakeSource.Credential = &source.Credential{Token: "token-2", Exp: exp + 3600, LeaseID: "lease-2"}
+		})
+
+		It("should refresh credentials before they are due", func() {
+			a.RefreshDue(context.Background(), time.Now())
+			Expect(fakeSource.Fetches).To(Equal(1))
+
+			a.RefreshDue(context.Background(), time.Unix(exp, 0).Add(-5*time.Minute-30*time.Second))
+			Expect(fakeSource.Fetches).To(Equal(2))
+
+			entry, err := a.Get(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entry.Token).To(Equal("token-2"))
+			Expect(fakeSource.Fetches).To(Equal(2))
+		})
+
+		It("should refresh credentials due under the policy of the last client", func() {
+			req.Policy = cache.RefreshPolicy{MinRemaining: 30 * time.Minute}
+			_, err := a.Get(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeSource.Fetches).To(Equal(1))
+
+			a.RefreshDue(context.Background(), time.Unix(exp, 0).Add(-30*time.Minute-30*time.Second))
+			Expect(fakeSource.Fetches).To(Equal(2))
+		})
+
+		It("should revoke the lease of the replaced credential", func() {
+			a.RefreshDue(context.Background(), time.Unix(exp, 0).Add(-5*time.Minute-30*time.Second))
+			Expect(revoked).To(Equal([]string{"lease-1"}))
+		})
+
+		It("should keep the credential when the refresh fails", func() {
+			fakeSource.Err = errors.New("vault is sealed")
+			a.RefreshDue(context.Background(), time.Unix(exp, 0).Add(-5*time.Minute-30*time.Second))
+
+			fakeSource.Err = nil
+			entry, err := a.Get(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entry.Token).To(Equal("token-1"))
+		})
+
+		It("should drop idle credentials", func() {
+			a.RefreshDue(context.Background(), time.Now().Add(2*time.Hour))
+			Expect(revoked).To(Equal([]string{"lease-1"}))
+			entry, err := a.Get(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entry.Token).To(Equal("token-2"))
+		})
+	})
+
+	Describe("Serve", func() {
+		var (
+			socket string
+			cancel context.CancelFunc
+			done   chan error
+		)
+
+		BeforeEach(func() {
+			dir, err := os.MkdirTemp("", "agent")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(os.RemoveAll, dir)
+			socket = filepath.Join(dir, "agent.sock")
+
+			l, err := agent.Listen(socket)
+			Expect(err).NotTo(HaveOccurred())
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			done = make(chan error, 1)
+			go func() { done <- a.Serve(ctx, l) }()
+		})
+
+		AfterEach(func() {
+			cancel()
+			Eventually(done).Should(Receive(BeNil()))
+		})
+
+		It("should serve credentials over the socket", func() {
+			entry, err := agent.Get(context.Background(), socket, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entry.Token).To(Equal("token-1"))
+			Expect(entry.Exp).To(Equal(exp))
+		})
+
+		It("should return the errors of the agent", func() {
+			req.Source = "ldap"
+			_, err := agent.Get(context.Background(), socket, req)
+			Expect(err).To(MatchError(ContainSubstring(`unknown source "ldap"`)))
+		})
+
+		It("should make the socket accessible to the current user only", func() {
+			info, err := os.Stat(socket)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+
+		It("should refuse to start a second agent", func() {
+			_, err := agent.Listen(socket)
+			Expect(err).To(MatchError(ContainSubstring("an agent is already listening")))
+		})
+
+		It("should revoke the leases of the held credentials when it stops", func() {
+			_, err := agent.Get(context.Background(), socket, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(revoked).To(BeEmpty())
+
+			cancel()
+			Eventually(done).Should(Receive(BeNil()))
+			done <- nil
+			Expect(revoked).To(Equal([]string{"lease-1"}))
+		})
+
+		It("should remove the socket when it stops", func() {
+			cancel()
+			Eventually(done).Should(Receive(BeNil()))
+			done <- nil
+			Expect(socket).NotTo(BeAnExistingFile())
+		})
+	})
+
+	It("should replace a stale socket", func() {
+		dir, err := os.MkdirTemp("", "agent")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+		socket := filepath.Join(dir, "agent.sock")
+
+		l, err := net.Listen("unix", socket)
+		Expect(err).NotTo(HaveOccurred())
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		Expect(l.Close()).To(Succeed())
+		Expect(socket).To(BeAnExistingFile())
+
+		l, err = agent.Listen(socket)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l.Close()).To(Succeed())
+	})
+})
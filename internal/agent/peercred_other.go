@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+func peerUID(conn *net.UnixConn) (int, error) {
+	return 0, fmt.Errorf("peer credentials are not supported on %s", runtime.GOOS)
+}
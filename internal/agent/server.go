@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/efortin/kubectl-auth-vault/internal/cache"
+)
+
+// requestTimeout bounds the time a client connection is served, including
+// fetching the credential from Vault.
+const requestTimeout = 2 * time.Minute
+
+// shutdownTimeout bounds the time spent revoking the leases of the held
+// credentials once Serve is done.
+const shutdownTimeout = 30 * time.Second
+
+// Listen creates the socket at path, accessible to the current user only. A
+// socket left by an agent that did not shut down cleanly is replaced.
+func Listen(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("an agent is already listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		_ = l.Close()
+		return nil, fmt.Errorf("failed to restrict access to %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Serve answers the requests of the clients connecting to l until ctx is
+// done, then closes l and drops the held credentials, revoking their leases.
+// Clients running as another user are refused.
+func (a *Agent) Serve(ctx context.Context, l net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+		defer cancel()
+		a.dropAll(ctx)
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go a.handle(ctx, conn)
+	}
+}
+
+func (a *Agent) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	_ = conn.SetDeadline(time.Now().Add(requestTimeout))
+
+	resp := &Response{}
+	if err := checkPeer(conn); err != nil {
+		a.logf("Refused connection: %v", err)
+		resp.Error = err.Error()
+	} else {
+		var req Request
+		if err := json.NewDecoder(conn).Decode(&req); err != nil {
+			resp.Error = fmt.Sprintf("invalid request: %v", err)
+		} else if resp.Credential, err = a.Get(ctx, &req); err != nil {
+			resp.Error = err.Error()
+		}
+	}
+
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		a.logf("Failed to answer: %v", err)
+	}
+}
+
+// Get asks the agent listening on socket for the credential described by
+// req. The agent must run as the current user.
+func Get(ctx context.Context, socket string, req *Request) (*cache.TokenCache, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if err := checkPeer(conn); err != nil {
+		return nil, err
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send request to the agent: %w", err)
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read the answer of the agent: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	if resp.Credential == nil {
+		return nil, errors.New("the agent answered without a credential")
+	}
+	return resp.Credential, nil
+}
+
+// checkPeer refuses connections with processes of other users.
+func checkPeer(conn net.Conn) error {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("not a Unix socket connection")
+	}
+	uid, err := peerUID(unixConn)
+	if err != nil {
+		return fmt.Errorf("failed to get peer credentials: %w", err)
+	}
+	if uid != os.Getuid() {
+		return fmt.Errorf("peer runs as uid %d, not %d", uid, os.Getuid())
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package atomicfile_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/atomicfile"
+)
+
+var _ = Describe("Write", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "atomicfile-test")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+	})
+
+	It("should create the file and its directory with the given permissions", func() {
+		path := filepath.Join(dir, "sub", "config")
+		Expect(atomicfile.Write(path, []byte("new"), 0640)).To(Succeed())
+
+		Expect(os.ReadFile(path)).To(Equal([]byte("new")))
+		info, err := os.Stat(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0640)))
+	})
+
+	It("should replace an existing file without leaving temporary files", func() {
+		path := filepath.Join(dir, "config")
+		Expect(os.WriteFile(path, []byte("old"), 0600)).To(Succeed())
+		Expect(atomicfile.Write(path, []byte("new"), 0600)).To(Succeed())
+
+		Expect(os.ReadFile(path)).To(Equal([]byte("new")))
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("should write through symlinks and keep them", func() {
+		target := filepath.Join(dir, "dotfiles", "kubeconfig")
+		Expect(os.MkdirAll(filepath.Dir(target), 0700)).To(Succeed())
+		Expect(os.WriteFile(target, []byte("old"), 0600)).To(Succeed())
+		link := filepath.Join(dir, "config")
+		Expect(os.Symlink(filepath.Join("dotfiles", "kubeconfig"), link)).To(Succeed())
+
+		Expect(atomicfile.Write(link, []byte("new"), 0600)).To(Succeed())
+
+		info, err := os.Lstat(link)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode() & os.ModeSymlink).NotTo(BeZero())
+		Expect(os.ReadFile(target)).To(Equal([]byte("new")))
+	})
+
+	It("should create the missing target of a symlink", func() {
+		target := filepath.Join(dir, "kubeconfig")
+		link := filepath.Join(dir, "config")
+		Expect(os.Symlink(target, link)).To(Succeed())
+
+		Expect(atomicfile.Write(link, []byte("new"), 0600)).To(Succeed())
+		Expect(os.ReadFile(target)).To(Equal([]byte("new")))
+	})
+})
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AddressFile remembers the last healthy node of a list of Vault addresses.
+// It implements vault.AddressStore.
+type AddressFile struct {
+	filePath string
+}
+
+type addressState struct {
+	Address string `json:"address"`
+}
+
+func NewAddressFile(filePath string) *AddressFile {
+	return &AddressFile{filePath: filePath}
+}
+
+// DefaultAddressFile returns the file remembering the last healthy node of
+// the comma-separated Vault addresses vaultAddr.
+func DefaultAddressFile(vaultAddr string) string {
+	sum := sha256.Sum256([]byte(vaultAddr))
+	return filepath.Join(cacheDir(), "vault_addr_"+hex.EncodeToString(sum[:8])+".json")
+}
+
+func (f *AddressFile) LoadAddress() (string, error) {
+	data, err := os.ReadFile(f.filePath)
+	if err != nil {
+		return "", err
+	}
+
+	var state addressState
+	if err := json.Unmarshal(data, &state); err != nil || state.Address == "" {
+		return "", fmt.Errorf("%w %s", ErrCorrupt, f.filePath)
+	}
+	return state.Address, nil
+}
+
+func (f *AddressFile) SaveAddress(address string) error {
+	data, err := json.Marshal(addressState{Address: address})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.filePath, data)
+}
+
+func (f *AddressFile) FilePath() string {
+	return f.filePath
+}
@@ -1,16 +1,37 @@
 package cache
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/efortin/kubectl-auth-vault/internal/atomicfile"
 )
 
+// ErrCorrupt is returned by Read when the cache file exists but cannot be parsed.
+var ErrCorrupt = errors.New("corrupt token cache")
+
+// TokenCache is a cache entry. TokenPath and Namespace record where the token
+// was read from; they are informational and empty in caches written by older
+// versions. Entries for a client certificate issued by the PKI secrets engine
+// have no Token but a PEM-encoded ClientCertificate and ClientKey, and Exp is
+// the certificate NotAfter. LeaseID is the Vault lease of service account
+// tokens generated by the Kubernetes secrets engine, revoked when the entry is
+// cleared.
 type TokenCache struct {
-	Token string `json:"token"`
-	Exp   int64  `json:"exp"`
+	Token             string `json:"token,omitempty"`
+	ClientCertificate string `json:"client_certificate,omitempty"`
+	ClientKey         string `json:"client_key,omitempty"`
+	Exp               int64  `json:"exp"`
+	TokenPath         string `json:"token_path,omitempty"`
+	Namespace         string `json:"namespace,omitempty"`
+	LeaseID           string `json:"lease_id,omitempty"`
 }
 
 type Cache struct {
@@ -21,53 +42,142 @@ func New(filePath string) *Cache {
 	return &Cache{filePath: filePath}
 }
 
-func DefaultCacheFile(tokenPath string) string {
-	homeDir, err := os.UserHomeDir()
+// DefaultCacheFile returns the file caching the token read from tokenPath.
+// Tokens from a Vault Enterprise namespace get a distinct "<namespace>@" prefix
+// so they never collide with tokens from another namespace.
+func DefaultCacheFile(namespace, tokenPath string) string {
+	return filepath.Join(cacheDir(), "vault_"+namespacePrefix(namespace)+sanitize(tokenPath)+"_token.json")
+}
+
+// DefaultAuthCacheFile returns the file caching the Vault token obtained by
+// logging in to the auth method mounted at mountPath of the Vault node at
+// address, since the clusters of a failover list do not share tokens.
+// identity distinguishes logins to the same mount (e.g. the AppRole role_id)
+// and is only stored hashed, along with address.
+func DefaultAuthCacheFile(address, namespace, mountPath, identity string) string {
+	sum := sha256.Sum256([]byte(address + "\n" + identity))
+	return filepath.Join(cacheDir(), "vault_auth_"+namespacePrefix(namespace)+sanitize(strings.Trim(mountPath, "/"))+"_"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// List returns the caches of the OIDC tokens stored in the default cache
+// directory, sorted by file name.
+func List() ([]*Cache, error) {
+	paths, err := filepath.Glob(filepath.Join(cacheDir(), "vault_*_token.json"))
 	if err != nil {
-		homeDir = os.TempDir()
+		return nil, err
+	}
+
+	caches := make([]*Cache, 0, len(paths))
+	for _, path := range paths {
+		caches = append(caches, New(path))
 	}
-	sanitizedPath := strings.ReplaceAll(tokenPath, "/", "_")
-	return filepath.Join(homeDir, ".kube", "vault_"+sanitizedPath+"_token.json")
+	return caches, nil
 }
 
-func (c *Cache) Load() (string, bool) {
-	data, err := os.ReadFile(c.filePath)
+// StateFiles returns the files other than token caches kept in the default
+// cache directory: the Vault tokens cached after logins, the key sets of the
+// Vault OIDC providers, the last healthy Vault nodes and the expiry of the
+// Vault token. Lock files are not included: removing one while another
+// process holds it would let a third process lock a new file and refresh the
+// same token concurrently.
+func StateFiles() ([]string, error) {
+	var files []string
+	for _, pattern := range []string{"vault_auth_*.json", "vault_jwks_*.json", "vault_addr_*.json", "vault_token_expiry.json"} {
+		paths, err := filepath.Glob(filepath.Join(cacheDir(), pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, paths...)
+	}
+	return files, nil
+}
+
+func namespacePrefix(namespace string) string {
+	if namespace = strings.Trim(namespace, "/"); namespace == "" {
+		return ""
+	}
+	return sanitize(namespace) + "@"
+}
+
+func sanitize(path string) string {
+	return strings.ReplaceAll(path, "/", "_")
+}
+
+func cacheDir() string {
+	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return "", false
+		homeDir = os.TempDir()
 	}
+	return filepath.Join(homeDir, ".kube")
+}
 
-	var cache TokenCache
-	if err := json.Unmarshal(data, &cache); err != nil {
-		return "", false
+// Load returns the cached token and its expiration if the token has not expired yet.
+func (c *Cache) Load() (string, int64, bool) {
+	cache, err := c.Read()
+	if err != nil {
+		return "", 0, false
 	}
 
 	now := time.Now().Unix()
 	if cache.Exp > now {
-		return cache.Token, true
+		return cache.Token, cache.Exp, true
 	}
 
-	return "", false
+	return "", 0, false
 }
 
-func (c *Cache) Save(token string, exp int64) error {
-	dir := filepath.Dir(c.filePath)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return err
+// Read returns the cache entry regardless of its expiration. A missing cache
+// file yields an error matching os.ErrNotExist. A file that cannot be parsed
+// is removed so the next Save starts clean, and yields ErrCorrupt.
+func (c *Cache) Read() (*TokenCache, error) {
+	cache, err := c.Peek()
+	if errors.Is(err, ErrCorrupt) {
+		_ = os.Remove(c.filePath)
+		return nil, fmt.Errorf("%w %s: discarded unparsable file", ErrCorrupt, c.filePath)
 	}
+	return cache, err
+}
 
-	cache := TokenCache{
-		Token: token,
-		Exp:   exp,
+// Peek returns the cache entry like Read, but leaves a corrupt cache file in place.
+func (c *Cache) Peek() (*TokenCache, error) {
+	data, err := os.ReadFile(c.filePath)
+	if err != nil {
+		return nil, err
 	}
 
-	data, err := json.Marshal(cache)
+	var cache TokenCache
+	if err := json.Unmarshal(data, &cache); err != nil || (cache.Token == "" && (cache.ClientCertificate == "" || cache.ClientKey == "")) {
+		return nil, fmt.Errorf("%w %s", ErrCorrupt, c.filePath)
+	}
+
+	return &cache, nil
+}
+
+// Save writes the cache entry atomically: the data is written and synced to a
+// temporary file in the same directory which then replaces the cache file, so
+// readers never observe a partially written cache.
+func (c *Cache) Save(token string, exp int64) error {
+	return c.SaveEntry(&TokenCache{Token: token, Exp: exp})
+}
+
+// SaveEntry writes the cache entry atomically, like Save.
+func (c *Cache) SaveEntry(entry *TokenCache) error {
+	data, err := json.Marshal(entry)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(c.filePath, data, 0600)
+	return writeFileAtomic(c.filePath, data)
+}
+
+// writeFileAtomic replaces path with data, readable by the user only.
+func writeFileAtomic(path string, data []byte) error {
+	return atomicfile.Write(path, data, 0600)
 }
 
+// Clear removes the cache file. Its lock file is kept, since other processes
+// may be holding it. It returns an error matching os.ErrNotExist when there is
+// no cache file.
 func (c *Cache) Clear() error {
 	return os.Remove(c.filePath)
 }
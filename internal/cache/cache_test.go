@@ -1,14 +1,20 @@
 package cache_test
 
 import (
+	"context"
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	"github.com/efortin/kubectl-auth-vault/internal/cache"
+	"github.com/efortin/kubectl-auth-vault/internal/jwt"
 )
 
 var _ = Describe("Cache", func() {
@@ -38,14 +44,41 @@ var _ = Describe("Cache", func() {
 
 	Describe("DefaultCacheFile", func() {
 		It("should generate correct filename for simple path", func() {
-			path := cache.DefaultCacheFile("identity/oidc/token/my_role")
+			path := cache.DefaultCacheFile("", "identity/oidc/token/my_role")
 			Expect(filepath.Base(path)).To(Equal("vault_identity_oidc_token_my_role_token.json"))
 		})
 
 		It("should generate correct filename for path with special chars", func() {
-			path := cache.DefaultCacheFile("auth/oidc/role")
+			path := cache.DefaultCacheFile("", "auth/oidc/role")
 			Expect(filepath.Base(path)).To(Equal("vault_auth_oidc_role_token.json"))
 		})
+
+		It("should include the namespace in the filename", func() {
+			path := cache.DefaultCacheFile("team-a/sub", "identity/oidc/token/my_role")
+			Expect(filepath.Base(path)).To(Equal("vault_team-a_sub@identity_oidc_token_my_role_token.json"))
+		})
+
+		It("should not collide across namespaces", func() {
+			Expect(cache.DefaultCacheFile("team-a", "identity/oidc/token/my_role")).
+				NotTo(Equal(cache.DefaultCacheFile("team-b", "identity/oidc/token/my_role")))
+			Expect(cache.DefaultCacheFile("team-a", "identity/oidc/token/my_role")).
+				NotTo(Equal(cache.DefaultCacheFile("", "team-a/identity/oidc/token/my_role")))
+		})
+	})
+
+	Describe("DefaultAuthCacheFile", func() {
+		It("should not expose the identity in the filename", func() {
+			path := cache.DefaultAuthCacheFile("https://vault.example.com", "", "approle", "my-role-id")
+			Expect(filepath.Base(path)).To(HavePrefix("vault_auth_approle_"))
+			Expect(path).NotTo(ContainSubstring("my-role-id"))
+		})
+
+		It("should differ per Vault node, namespace, mount and identity", func() {
+			Expect(cache.DefaultAuthCacheFile("https://vault.example.com", "", "approle", "a")).NotTo(Equal(cache.DefaultAuthCacheFile("https://vault.example.com", "", "approle", "b")))
+			Expect(cache.DefaultAuthCacheFile("https://vault.example.com", "", "approle", "a")).NotTo(Equal(cache.DefaultAuthCacheFile("https://vault.example.com", "", "ci/approle", "a")))
+			Expect(cache.DefaultAuthCacheFile("https://vault.example.com", "", "approle", "a")).NotTo(Equal(cache.DefaultAuthCacheFile("https://vault.example.com", "team-a", "approle", "a")))
+			Expect(cache.DefaultAuthCacheFile("https://vault.example.com", "", "approle", "a")).NotTo(Equal(cache.DefaultAuthCacheFile("https://vault-b.example.com", "", "approle", "a")))
+		})
 	})
 
 	Describe("Save and Load", func() {
@@ -57,9 +90,10 @@ var _ = Describe("Cache", func() {
 				err := c.Save(token, exp)
 				Expect(err).NotTo(HaveOccurred())
 
-				loadedToken, ok := c.Load()
+				loadedToken, loadedExp, ok := c.Load()
 				Expect(ok).To(BeTrue())
 				Expect(loadedToken).To(Equal(token))
+				Expect(loadedExp).To(Equal(exp))
 			})
 		})
 
@@ -71,7 +105,7 @@ var _ = Describe("Cache", func() {
 				err := c.Save(token, exp)
 				Expect(err).NotTo(HaveOccurred())
 
-				_, ok := c.Load()
+				_, _, ok := c.Load()
 				Expect(ok).To(BeFalse())
 			})
 		})
@@ -94,7 +128,7 @@ var _ = Describe("Cache", func() {
 		Context("with a non-existent file", func() {
 			It("should return false", func() {
 				nonExistent := cache.New("/nonexistent/path/cache.json")
-				_, ok := nonExistent.Load()
+				_, _, ok := nonExistent.Load()
 				Expect(ok).To(BeFalse())
 			})
 		})
@@ -104,12 +138,193 @@ var _ = Describe("Cache", func() {
 				err := os.WriteFile(cacheFile, []byte("not valid json"), 0600)
 				Expect(err).NotTo(HaveOccurred())
 
-				_, ok := c.Load()
+				_, _, ok := c.Load()
 				Expect(ok).To(BeFalse())
 			})
 		})
 	})
 
+	Describe("Read", func() {
+		Context("with a non-existent file", func() {
+			It("should return a not-exist error", func() {
+				_, err := c.Read()
+				Expect(err).To(HaveOccurred())
+				Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+				Expect(errors.Is(err, cache.ErrCorrupt)).To(BeFalse())
+			})
+		})
+
+		Context("with an expired token", func() {
+			It("should still return the entry", func() {
+				exp := time.Now().Add(-time.Hour).Unix()
+				Expect(c.Save("expired-token", exp)).To(Succeed())
+
+				entry, err := c.Read()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entry.Token).To(Equal("expired-token"))
+				Expect(entry.Exp).To(Equal(exp))
+			})
+		})
+
+		Context("with a partially written file", func() {
+			It("should report it as corrupt and remove it", func() {
+				Expect(c.Save("token", time.Now().Add(time.Hour).Unix())).To(Succeed())
+				data, err := os.ReadFile(cacheFile)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.WriteFile(cacheFile, data[:len(data)/2], 0600)).To(Succeed())
+
+				_, err = c.Read()
+				Expect(err).To(MatchError(cache.ErrCorrupt))
+
+				_, err = os.Stat(cacheFile)
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
+		Context("with an empty file", func() {
+			It("should report it as corrupt", func() {
+				Expect(os.WriteFile(cacheFile, nil, 0600)).To(Succeed())
+
+				_, err := c.Read()
+				Expect(err).To(MatchError(cache.ErrCorrupt))
+			})
+		})
+	})
+
+	Describe("Peek", func() {
+		It("should report a corrupt file without removing it", func() {
+			Expect(os.WriteFile(cacheFile, []byte("{"), 0600)).To(Succeed())
+
+			_, err := c.Peek()
+			Expect(err).To(MatchError(cache.ErrCorrupt))
+
+			_, err = os.Stat(cacheFile)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("SaveEntry", func() {
+		It("should store where the token was read from", func() {
+			exp := time.Now().Add(time.Hour).Unix()
+			Expect(c.SaveEntry(&cache.TokenCache{Token: "token", Exp: exp, TokenPath: "identity/oidc/token/test", Namespace: "team-a"})).To(Succeed())
+
+			entry, err := c.Read()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*entry).To(Equal(cache.TokenCache{Token: "token", Exp: exp, TokenPath: "identity/oidc/token/test", Namespace: "team-a"}))
+		})
+	})
+
+	Describe("List", func() {
+		It("should return the token caches of the default cache directory", func() {
+			GinkgoT().Setenv("HOME", tmpDir)
+			GinkgoT().Setenv("USERPROFILE", tmpDir)
+
+			exp := time.Now().Add(time.Hour).Unix()
+			Expect(cache.New(cache.DefaultCacheFile("", "identity/oidc/token/b")).Save("b", exp)).To(Succeed())
+			Expect(cache.New(cache.DefaultCacheFile("team-a", "identity/oidc/token/a")).Save("a", exp)).To(Succeed())
+			Expect(cache.New(cache.DefaultAuthCacheFile("https://vault.example.com", "", "approle", "role")).Save("hvs.token", exp)).To(Succeed())
+			Expect(os.WriteFile(cache.DefaultCacheFile("", "identity/oidc/token/b")+".lock", nil, 0600)).To(Succeed())
+
+			caches, err := cache.List()
+			Expect(err).NotTo(HaveOccurred())
+			var names []string
+			for _, c := range caches {
+				names = append(names, filepath.Base(c.FilePath()))
+			}
+			Expect(names).To(Equal([]string{
+				"vault_identity_oidc_token_b_token.json",
+				"vault_team-a@identity_oidc_token_a_token.json",
+			}))
+		})
+	})
+
+	Describe("StateFiles", func() {
+		It("should return the other files of the default cache directory", func() {
+			GinkgoT().Setenv("HOME", tmpDir)
+			GinkgoT().Setenv("USERPROFILE", tmpDir)
+
+			exp := time.Now().Add(time.Hour).Unix()
+			Expect(cache.New(cache.DefaultCacheFile("", "identity/oidc/token/b")).Save("b", exp)).To(Succeed())
+			Expect(os.WriteFile(cache.DefaultCacheFile("", "identity/oidc/token/b")+".lock", nil, 0600)).To(Succeed())
+			Expect(os.WriteFile(cache.DefaultCacheFile("", "identity/oidc/token/a")+".lock", nil, 0600)).To(Succeed())
+			Expect(cache.New(cache.DefaultAuthCacheFile("https://vault.example.com", "", "approle", "role")).Save("hvs.token", exp)).To(Succeed())
+			Expect(os.WriteFile(cache.DefaultVaultTokenExpiryFile(), []byte("{}"), 0600)).To(Succeed())
+
+			files, err := cache.StateFiles()
+			Expect(err).NotTo(HaveOccurred())
+			var names []string
+			for _, file := range files {
+				names = append(names, filepath.Base(file))
+			}
+			Expect(names).To(ConsistOf(
+				filepath.Base(cache.DefaultAuthCacheFile("https://vault.example.com", "", "approle", "role")),
+				"vault_token_expiry.json",
+			))
+		})
+	})
+
+	Describe("Save", func() {
+		It("should write the file with owner-only permissions", func() {
+			Expect(c.Save("token", time.Now().Add(time.Hour).Unix())).To(Succeed())
+
+			info, err := os.Stat(cacheFile)
+			Expect(err).NotTo(HaveOccurred())
+			if runtime.GOOS != "windows" {
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+			}
+		})
+
+		It("should not leave temporary files behind", func() {
+			Expect(c.Save("token", time.Now().Add(time.Hour).Unix())).To(Succeed())
+
+			entries, err := os.ReadDir(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+		})
+
+		It("should ignore a temporary file left by an interrupted write", func() {
+			Expect(c.Save("old-token", time.Now().Add(time.Hour).Unix())).To(Succeed())
+			Expect(os.WriteFile(cacheFile+".tmp-123", []byte(`{"token":"new-to`), 0600)).To(Succeed())
+
+			token, _, ok := c.Load()
+			Expect(ok).To(BeTrue())
+			Expect(token).To(Equal("old-token"))
+
+			Expect(c.Save("new-token", time.Now().Add(time.Hour).Unix())).To(Succeed())
+			token, _, ok = c.Load()
+			Expect(ok).To(BeTrue())
+			Expect(token).To(Equal("new-token"))
+		})
+
+		It("should never expose a partial file to concurrent readers", func() {
+			exp := time.Now().Add(time.Hour).Unix()
+			Expect(c.Save("initial", exp)).To(Succeed())
+
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				for i := 0; i < 200; i++ {
+					Expect(c.Save(strings.Repeat("t", i+1), exp)).To(Succeed())
+				}
+			}()
+
+			reader := cache.New(cacheFile)
+			corrupt := 0
+			for {
+				select {
+				case <-done:
+					Expect(corrupt).To(BeZero())
+					return
+				default:
+					if _, err := reader.Read(); errors.Is(err, cache.ErrCorrupt) {
+						corrupt++
+					}
+				}
+			}
+		})
+	})
+
 	Describe("Clear", func() {
 		It("should remove the cache file", func() {
 			err := c.Save("token", time.Now().Add(time.Hour).Unix())
@@ -122,6 +337,16 @@ var _ = Describe("Cache", func() {
 			Expect(os.IsNotExist(err)).To(BeTrue())
 		})
 
+		It("should keep the lock file", func() {
+			Expect(c.Save("token", time.Now().Add(time.Hour).Unix())).To(Succeed())
+			unlock, err := c.Lock(context.Background(), time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			unlock()
+
+			Expect(c.Clear()).To(Succeed())
+			Expect(c.LockPath()).To(BeAnExistingFile())
+		})
+
 		Context("with a non-existent file", func() {
 			It("should return an error", func() {
 				nonExistent := cache.New("/nonexistent/path/cache.json")
@@ -130,4 +355,72 @@ var _ = Describe("Cache", func() {
 			})
 		})
 	})
+
+	Describe("KeySetFile", func() {
+		It("should save and load the key set", func() {
+			keySetFile := cache.NewKeySetFile(filepath.Join(tmpDir, "jwks.json"))
+			keys := &jwt.KeySet{Issuer: "https://vault.example.com/v1/identity/oidc", Keys: []jwt.JSONWebKey{{Kty: "OKP", Kid: "k", Crv: "Ed25519", X: "AA"}}}
+
+			Expect(keySetFile.SaveKeySet(keys)).To(Succeed())
+			loaded, err := keySetFile.LoadKeySet()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).To(Equal(keys))
+		})
+
+		It("should report an empty key set as corrupt", func() {
+			keySetFile := cache.NewKeySetFile(filepath.Join(tmpDir, "jwks.json"))
+			Expect(os.WriteFile(keySetFile.FilePath(), []byte(`{"keys": []}`), 0600)).To(Succeed())
+			_, err := keySetFile.LoadKeySet()
+			Expect(err).To(MatchError(cache.ErrCorrupt))
+		})
+
+		It("should use a file per Vault server and namespace", func() {
+			Expect(cache.DefaultKeySetFile("", "https://a")).NotTo(Equal(cache.DefaultKeySetFile("", "https://b")))
+			Expect(cache.DefaultKeySetFile("team-a", "https://a")).NotTo(Equal(cache.DefaultKeySetFile("", "https://a")))
+			Expect(cache.DefaultKeySetFile("", "https://a/")).To(Equal(cache.DefaultKeySetFile("", "https://a")))
+		})
+	})
+
+	Describe("AddressFile", func() {
+		It("should save and load the address", func() {
+			addressFile := cache.NewAddressFile(filepath.Join(tmpDir, "addr.json"))
+			Expect(addressFile.SaveAddress("https://vault-b.example.com")).To(Succeed())
+			Expect(addressFile.LoadAddress()).To(Equal("https://vault-b.example.com"))
+		})
+
+		It("should report an empty file as corrupt", func() {
+			addressFile := cache.NewAddressFile(filepath.Join(tmpDir, "addr.json"))
+			Expect(os.WriteFile(addressFile.FilePath(), []byte(`{}`), 0600)).To(Succeed())
+			_, err := addressFile.LoadAddress()
+			Expect(err).To(MatchError(cache.ErrCorrupt))
+		})
+
+		It("should use a file per address list", func() {
+			Expect(cache.DefaultAddressFile("https://a,https://b")).NotTo(Equal(cache.DefaultAddressFile("https://a,https://c")))
+		})
+	})
+
+	Describe("VaultTokenExpiry", func() {
+		It("should save and load the expiry of a token without storing it", func() {
+			expiry := cache.NewVaultTokenExpiry(filepath.Join(tmpDir, "expiry.json"))
+			expireTime := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+			Expect(expiry.Save("hvs.secret", expireTime)).To(Succeed())
+
+			loaded, err := expiry.Load("hvs.secret")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.Equal(expireTime)).To(BeTrue())
+
+			data, err := os.ReadFile(filepath.Join(tmpDir, "expiry.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).NotTo(ContainSubstring("hvs.secret"))
+		})
+
+		It("should not return the expiry of another token", func() {
+			expiry := cache.NewVaultTokenExpiry(filepath.Join(tmpDir, "expiry.json"))
+			Expect(expiry.Save("hvs.old", time.Now())).To(Succeed())
+
+			_, err := expiry.Load("hvs.new")
+			Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+		})
+	})
 })
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/efortin/kubectl-auth-vault/internal/jwt"
+)
+
+// KeySetFile caches the key set used to verify OIDC tokens. It implements
+// jwt.KeySetCache.
+type KeySetFile struct {
+	filePath string
+}
+
+func NewKeySetFile(filePath string) *KeySetFile {
+	return &KeySetFile{filePath: filePath}
+}
+
+// DefaultKeySetFile returns the file caching the key set of the Vault server
+// at vaultAddr, per namespace.
+func DefaultKeySetFile(namespace, vaultAddr string) string {
+	sum := sha256.Sum256([]byte(strings.TrimRight(vaultAddr, "/")))
+	return filepath.Join(cacheDir(), "vault_jwks_"+namespacePrefix(namespace)+hex.EncodeToString(sum[:8])+".json")
+}
+
+func (f *KeySetFile) LoadKeySet() (*jwt.KeySet, error) {
+	data, err := os.ReadFile(f.filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys jwt.KeySet
+	if err := json.Unmarshal(data, &keys); err != nil || len(keys.Keys) == 0 {
+		return nil, fmt.Errorf("%w %s", ErrCorrupt, f.filePath)
+	}
+	return &keys, nil
+}
+
+func (f *KeySetFile) SaveKeySet(keys *jwt.KeySet) error {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.filePath, data)
+}
+
+func (f *KeySetFile) FilePath() string {
+	return f.filePath
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLockTimeout is returned by Lock when another process holds the lock for
+// longer than the allowed wait.
+var ErrLockTimeout = errors.New("timed out waiting for cache lock")
+
+const lockPollInterval = 50 * time.Millisecond
+
+// Lock takes an exclusive advisory lock on the cache file, shared by every
+// process using the same cache. It waits at most timeout for the lock and
+// returns a function that releases it.
+func (c *Cache) Lock(ctx context.Context, timeout time.Duration) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(c.filePath), 0700); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(c.LockPath(), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLock(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", c.LockPath(), err)
+		}
+		if locked {
+			return func() {
+				_ = unlock(f)
+				_ = f.Close()
+			}, nil
+		}
+
+		if !time.Now().Before(deadline) {
+			_ = f.Close()
+			return nil, ErrLockTimeout
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// LockPath returns the path of the lock file guarding the cache file.
+func (c *Cache) LockPath() string {
+	return c.filePath + ".lock"
+}
@@ -0,0 +1,76 @@
+package cache_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/cache"
+)
+
+var _ = Describe("Lock", func() {
+	var (
+		tmpDir    string
+		cacheFile string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "cache-lock-test")
+		Expect(err).NotTo(HaveOccurred())
+		cacheFile = filepath.Join(tmpDir, "nested", "cache.json")
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(tmpDir)
+	})
+
+	It("should create the lock file next to the cache file", func() {
+		c := cache.New(cacheFile)
+		unlock, err := c.Lock(context.Background(), time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		defer unlock()
+
+		Expect(c.LockPath()).To(Equal(cacheFile + ".lock"))
+		_, err = os.Stat(c.LockPath())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should time out while another holder has the lock", func() {
+		unlock, err := cache.New(cacheFile).Lock(context.Background(), time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		defer unlock()
+
+		_, err = cache.New(cacheFile).Lock(context.Background(), 100*time.Millisecond)
+		Expect(err).To(MatchError(cache.ErrLockTimeout))
+	})
+
+	It("should be acquired once the holder releases it", func() {
+		unlock, err := cache.New(cacheFile).Lock(context.Background(), time.Second)
+		Expect(err).NotTo(HaveOccurred())
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			unlock()
+		}()
+
+		unlock2, err := cache.New(cacheFile).Lock(context.Background(), 5*time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		unlock2()
+	})
+
+	It("should stop waiting when the context is canceled", func() {
+		unlock, err := cache.New(cacheFile).Lock(context.Background(), time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		defer unlock()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = cache.New(cacheFile).Lock(ctx, 5*time.Second)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+})
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	"github.com/efortin/kubectl-auth-vault/internal/jwt"
+)
+
+// RefreshPolicy decides when a cached token that has not expired yet is too
+// close to its expiration to be handed out.
+type RefreshPolicy struct {
+	// MinRemaining is the minimum lifetime a token must have left to be reused.
+	MinRemaining time.Duration `json:"min_remaining,omitempty"`
+
+	// RemainingPercent, when non-zero, also treats a token as stale once less
+	// than this percentage of its lifetime (from the JWT iat to exp, or from
+	// the certificate NotBefore to NotAfter) is left.
+	RemainingPercent int `json:"remaining_percent,omitempty"`
+}
+
+// NeedsRefresh reports whether token, expiring at exp, should be refreshed at now.
+func (p RefreshPolicy) NeedsRefresh(token string, exp int64, now time.Time) bool {
+	var iat int64
+	if payload, err := jwt.DecodePayload(token); err == nil {
+		iat = payload.Iat
+	}
+	return p.needsRefresh(iat, exp, now)
+}
+
+// NeedsRefreshEntry reports whether the token or client certificate of entry
+// should be refreshed at now.
+func (p RefreshPolicy) NeedsRefreshEntry(entry *TokenCache, now time.Time) bool {
+	if entry.ClientCertificate == "" {
+		return p.NeedsRefresh(entry.Token, entry.Exp, now)
+	}
+
+	var notBefore int64
+	if block, _ := pem.Decode([]byte(entry.ClientCertificate)); block != nil {
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			notBefore = cert.NotBefore.Unix()
+		}
+	}
+	return p.needsRefresh(notBefore, entry.Exp, now)
+}
+
+// needsRefresh applies the policy to a credential issued at iat, which is
+// zero when unknown, and expiring at exp.
+func (p RefreshPolicy) needsRefresh(iat, exp int64, now time.Time) bool {
+	remaining := time.Unix(exp, 0).Sub(now)
+	if remaining <= p.MinRemaining || remaining <= 0 {
+		return true
+	}
+
+	if p.RemainingPercent <= 0 || iat <= 0 || iat >= exp {
+		return false
+	}
+
+	lifetime := time.Duration(exp-iat) * time.Second
+	return remaining*100 < lifetime*time.Duration(p.RemainingPercent)
+}
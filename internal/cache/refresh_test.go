@@ -0,0 +1,117 @@
+package cache_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/cache"
+	"github.com/efortin/kubectl-auth-vault/internal/jwt"
+)
+
+func createTestJWT(iat, exp int64) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	payloadBytes, _ := json.Marshal(jwt.Payload{Exp: exp, Iat: iat, Sub: "test"})
+	payloadB64 := base64.RawURLEncoding.EncodeToString(payloadBytes)
+	signature := base64.RawURLEncoding.EncodeToString([]byte("fake-signature"))
+	return header + "." + payloadB64 + "." + signature
+}
+
+func createTestCertificate(notBefore, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: notBefore, NotAfter: notAfter}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+var _ = Describe("RefreshPolicy", func() {
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Unix(1700000000, 0)
+	})
+
+	Context("with a minimum remaining lifetime", func() {
+		policy := cache.RefreshPolicy{MinRemaining: time.Minute}
+
+		It("should keep a token with enough lifetime left", func() {
+			exp := now.Add(10 * time.Minute).Unix()
+			Expect(policy.NeedsRefresh("opaque", exp, now)).To(BeFalse())
+		})
+
+		It("should refresh a token inside the skew window", func() {
+			exp := now.Add(30 * time.Second).Unix()
+			Expect(policy.NeedsRefresh("opaque", exp, now)).To(BeTrue())
+		})
+
+		It("should refresh an expired token", func() {
+			exp := now.Add(-time.Second).Unix()
+			Expect(policy.NeedsRefresh("opaque", exp, now)).To(BeTrue())
+		})
+	})
+
+	Context("with a zero policy", func() {
+		It("should only refresh expired tokens", func() {
+			policy := cache.RefreshPolicy{}
+			Expect(policy.NeedsRefresh("opaque", now.Add(time.Second).Unix(), now)).To(BeFalse())
+			Expect(policy.NeedsRefresh("opaque", now.Unix(), now)).To(BeTrue())
+		})
+	})
+
+	Context("with a percentage of lifetime", func() {
+		policy := cache.RefreshPolicy{RemainingPercent: 20}
+
+		It("should keep a token with more than the percentage left", func() {
+			iat := now.Add(-30 * time.Minute).Unix()
+			exp := now.Add(30 * time.Minute).Unix()
+			Expect(policy.NeedsRefresh(createTestJWT(iat, exp), exp, now)).To(BeFalse())
+		})
+
+		It("should refresh a token with less than the percentage left", func() {
+			iat := now.Add(-50 * time.Minute).Unix()
+			exp := now.Add(10 * time.Minute).Unix()
+			Expect(policy.NeedsRefresh(createTestJWT(iat, exp), exp, now)).To(BeTrue())
+		})
+
+		It("should ignore the percentage for tokens without iat", func() {
+			exp := now.Add(time.Minute).Unix()
+			Expect(policy.NeedsRefresh(createTestJWT(0, exp), exp, now)).To(BeFalse())
+			Expect(policy.NeedsRefresh("not-a-jwt", exp, now)).To(BeFalse())
+		})
+	})
+
+	Context("with a client certificate", func() {
+		policy := cache.RefreshPolicy{MinRemaining: time.Minute, RemainingPercent: 20}
+
+		entry := func(notBefore, notAfter time.Time) *cache.TokenCache {
+			return &cache.TokenCache{
+				ClientCertificate: createTestCertificate(notBefore, notAfter),
+				ClientKey:         "key",
+				Exp:               notAfter.Unix(),
+			}
+		}
+
+		It("should keep a certificate with more than the percentage left", func() {
+			Expect(policy.NeedsRefreshEntry(entry(now.Add(-30*time.Minute), now.Add(30*time.Minute)), now)).To(BeFalse())
+		})
+
+		It("should refresh a certificate with less than the percentage of its validity left", func() {
+			Expect(policy.NeedsRefreshEntry(entry(now.Add(-50*time.Minute), now.Add(10*time.Minute)), now)).To(BeTrue())
+		})
+
+		It("should refresh a certificate inside the skew window", func() {
+			Expect(policy.NeedsRefreshEntry(entry(now.Add(-time.Hour), now.Add(30*time.Second)), now)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// VaultTokenExpiry remembers when the Vault token used by the token auth
+// method expires. Vault tokens are opaque and Vault only answers permission
+// denied once they expired, so this is the only way to tell the user when it
+// happened. The token itself is not stored, only its hash.
+type VaultTokenExpiry struct {
+	filePath string
+}
+
+type vaultTokenExpiry struct {
+	TokenSHA256 string    `json:"token_sha256"`
+	ExpireTime  time.Time `json:"expire_time"`
+}
+
+func NewVaultTokenExpiry(filePath string) *VaultTokenExpiry {
+	return &VaultTokenExpiry{filePath: filePath}
+}
+
+// DefaultVaultTokenExpiryFile returns the file remembering the expiry of the
+// last Vault token looked up.
+func DefaultVaultTokenExpiryFile() string {
+	return filepath.Join(cacheDir(), "vault_token_expiry.json")
+}
+
+// Load returns the expiry time saved for token. It returns an error matching
+// os.ErrNotExist when the expiry of another token was saved last.
+func (f *VaultTokenExpiry) Load(token string) (time.Time, error) {
+	data, err := os.ReadFile(f.filePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var entry vaultTokenExpiry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return time.Time{}, fmt.Errorf("%w %s", ErrCorrupt, f.filePath)
+	}
+	if entry.TokenSHA256 != tokenHash(token) {
+		return time.Time{}, fmt.Errorf("no expiry saved for this token in %s: %w", f.filePath, os.ErrNotExist)
+	}
+	return entry.ExpireTime, nil
+}
+
+// Save records the expiry time of token, replacing the one of any other token.
+func (f *VaultTokenExpiry) Save(token string, expireTime time.Time) error {
+	data, err := json.Marshal(vaultTokenExpiry{TokenSHA256: tokenHash(token), ExpireTime: expireTime})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.filePath, data)
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/efortin/kubectl-auth-vault/internal/agent"
+	"github.com/efortin/kubectl-auth-vault/internal/cache"
+	"github.com/efortin/kubectl-auth-vault/internal/source"
+)
+
+// agentTimeout bounds the time get waits for the agent, which may have to
+// log in to Vault and fetch the credential first.
+const agentTimeout = time.Minute
+
+type agentOptions struct {
+	profile profileOptions
+	vault   vaultOptions
+	auth    authOptions
+
+	socket               string
+	refreshBefore        time.Duration
+	refreshBeforePercent int
+	refreshInterval      time.Duration
+	idleTimeout          time.Duration
+	verbose              bool
+}
+
+func addAgentCommand(rootCmd *cobra.Command) {
+	opts := &agentOptions{}
+
+	agentCmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Serve credentials to get from memory over a Unix socket",
+		Long: `Runs in the foreground as a user daemon, holding the Vault token and the
+credentials asked for by get in memory, and refreshing them before they are
+due for a refresh. get uses the agent when it is running, and gets the
+credential itself otherwise or when the agent fails.
+
+The agent logs in to Vault with the same settings as get, and only serves
+requests for its Vault address and namespace. The settings of the credential
+source come with each request. The leases of service account tokens are
+revoked when a refresh replaces them, when they are dropped as idle and when
+the agent stops. Only processes of the user running the agent
+are served, which is checked with the peer credentials of the socket
+(Linux, macOS and FreeBSD).`,
+		Example: `  # Run the agent with the settings of the "prod" profile
+  kubectl-auth_vault agent --profile prod
+
+  # Run the agent, logging in with AppRole
+  export VAULT_ROLE_ID=... VAULT_SECRET_ID=...
+  kubectl-auth_vault agent --vault-addr https://vault.example.com --auth-method approle`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAgent(cmd, opts)
+		},
+	}
+
+	opts.profile.addFlags(agentCmd.Flags())
+	opts.vault.addFlags(agentCmd.Flags())
+	opts.auth.addFlags(agentCmd.Flags())
+	agentCmd.Flags().StringVar(&opts.socket, "socket", "", "Socket to listen on (env: KUBECTL_AUTH_VAULT_AGENT_SOCKET, default: ~/.kube/vault_agent.sock)")
+	agentCmd.Flags().DurationVar(&opts.refreshBefore, "refresh-before", 30*time.Second, "Refresh credentials with less than this lifetime left")
+	agentCmd.Flags().IntVar(&opts.refreshBeforePercent, "refresh-before-percent", 0, "Refresh credentials with less than this percentage of their lifetime left (0 disables)")
+	agentCmd.Flags().DurationVar(&opts.refreshInterval, "refresh-interval", agent.DefaultRefreshInterval, "How often to look for credentials to refresh")
+	agentCmd.Flags().DurationVar(&opts.idleTimeout, "idle-timeout", agent.DefaultIdleTimeout, "Stop refreshing credentials get did not ask for during this time")
+	agentCmd.Flags().BoolVarP(&opts.verbose, "verbose", "v", false, "Print skipped unavailable Vault nodes to stderr")
+
+	rootCmd.AddCommand(agentCmd)
+}
+
+func runAgent(cmd *cobra.Command, opts *agentOptions) error {
+	if err := opts.profile.apply(cmd.Flags()); err != nil {
+		return err
+	}
+
+	if opts.refreshBeforePercent < 0 || opts.refreshBeforePercent > 100 {
+		return fmt.Errorf("--refresh-before-percent must be between 0 and 100")
+	}
+	if opts.refreshInterval <= 0 {
+		return fmt.Errorf("--refresh-interval must be positive")
+	}
+
+	client, err := opts.vault.newClient()
+	if err != nil {
+		return err
+	}
+	if opts.verbose {
+		client.SetFailoverHandler(func(address string, err error) {
+			logAgent(cmd, "Vault at %s is unavailable: %v", address, err)
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cmd.SetContext(ctx)
+
+	// Logging in now reports a misconfiguration before serving anything.
+	if err := login(ctx, cmd, client, &opts.auth, true); err != nil {
+		return err
+	}
+
+	// The Vault client is shared by all fetches, which log in again when the
+	// Vault token gets close to expiring. With the token auth method, they
+	// pick up the token of a `vault login` run since the agent started.
+	var mu sync.Mutex
+	withClient := func(ctx context.Context, do func(ctx context.Context) error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ctx, cancel, err := opts.vault.withDeadline(ctx)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		if opts.auth.resolvedMethod() == authMethodToken {
+			if err := client.ReloadToken(); err != nil {
+				return err
+			}
+		}
+		if err := login(ctx, cmd, client, &opts.auth, true); err != nil {
+			return err
+		}
+		return do(ctx)
+	}
+	a := &agent.Agent{
+		VaultAddr: opts.vault.resolvedAddr(),
+		Namespace: opts.vault.resolvedNamespace(),
+		Fetch: func(ctx context.Context, src source.Source) (entry *cache.TokenCache, err error) {
+			err = withClient(ctx, func(ctx context.Context) error {
+				entry, err = fetch(ctx, client, src)
+				return err
+			})
+			return entry, err
+		},
+		Revoke: func(ctx context.Context, entry *cache.TokenCache) error {
+			return withClient(ctx, func(ctx context.Context) error {
+				return client.RevokeLease(ctx, entry.LeaseID)
+			})
+		},
+		Policy: cache.RefreshPolicy{
+			MinRemaining:     opts.refreshBefore,
+			RemainingPercent: opts.refreshBeforePercent,
+		},
+		RefreshInterval: opts.refreshInterval,
+		IdleTimeout:     opts.idleTimeout,
+		Logf: func(format string, args ...interface{}) {
+			logAgent(cmd, format, args...)
+		},
+	}
+
+	socket := agentSocket(opts.socket)
+	l, err := agent.Listen(socket)
+	if err != nil {
+		return err
+	}
+	logAgent(cmd, "Listening on %s", socket)
+
+	go a.Run(ctx)
+	return a.Serve(ctx, l)
+}
+
+func logAgent(cmd *cobra.Command, format string, args ...interface{}) {
+	cmd.PrintErrf("%s %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
+
+// agentSocket resolves the socket of the agent from its flag value.
+func agentSocket(flagValue string) string {
+	if socket := flagOrEnv(flagValue, "KUBECTL_AUTH_VAULT_AGENT_SOCKET"); socket != "" {
+		return socket
+	}
+	return agent.DefaultSocket()
+}
+
+// fromAgent asks the agent for the credential when it is running. It reports
+// the failures of a running agent as warnings, so that get falls back to
+// fetching the credential itself.
+func (o *getOptions) fromAgent(cmd *cobra.Command, sourceName string, policy cache.RefreshPolicy, validator *tokenValidator) (*cache.TokenCache, bool) {
+	socket := agentSocket(o.agentSocket)
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), agentTimeout)
+	defer cancel()
+	entry, err := agent.Get(ctx, socket, &agent.Request{
+		VaultAddr: o.vault.resolvedAddr(),
+		Namespace: o.vault.resolvedNamespace(),
+		Source:    sourceName,
+		Settings:  source.Settings(sourceName, cmd.Flags()),
+		Policy:    policy,
+	})
+	// Without an agent, the socket is missing or left by an agent that did
+	// not shut down cleanly.
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+		return nil, false
+	}
+	if err != nil {
+		cmd.PrintErrf("warning: the agent at %s failed, getting the credential without it: %v\n", socket, err)
+		return nil, false
+	}
+	if err := validator.validate(cmd.Context(), entry.Token); err != nil {
+		cmd.PrintErrf("warning: discarding the token of the agent: %v\n", err)
+		return nil, false
+	}
+
+	if o.verbose {
+		cmd.PrintErrf("Token served by the agent at %s\n", socket)
+	}
+	return entry, true
+}
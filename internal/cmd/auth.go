@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/efortin/kubectl-auth-vault/internal/cache"
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+const (
+	authMethodToken      = "token"
+	authMethodAppRole    = "approle"
+	authMethodKubernetes = "kubernetes"
+)
+
+// vaultTokenRenewBefore is the remaining lifetime under which the Vault token
+// used by the token auth method is renewed, along with a third of its TTL.
+const vaultTokenRenewBefore = 5 * time.Minute
+
+// vaultTokenRefresh is applied to Vault tokens cached after a login, so a
+// token is never used for the OIDC request in its last minute.
+var vaultTokenRefresh = cache.RefreshPolicy{MinRemaining: time.Minute}
+
+type authOptions struct {
+	method       string
+	approleMount string
+	roleID       string
+	roleIDFile   string
+	secretID     string
+	secretIDFile string
+
+	kubernetesMount string
+	kubernetesRole  string
+	saTokenPath     string
+}
+
+func (o *authOptions) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.method, "auth-method", "", "Vault auth method: token, approle, kubernetes (env: VAULT_AUTH_METHOD, default: token)")
+	fs.StringVar(&o.approleMount, "approle-mount", "approle", "Mount path of the AppRole auth method")
+	fs.StringVar(&o.roleID, "role-id", "", "AppRole role_id (env: VAULT_ROLE_ID)")
+	fs.StringVar(&o.roleIDFile, "role-id-file", "", "File containing the AppRole role_id")
+	fs.StringVar(&o.secretID, "secret-id", "", "AppRole secret_id (env: VAULT_SECRET_ID)")
+	fs.StringVar(&o.secretIDFile, "secret-id-file", "", "File containing the AppRole secret_id")
+	fs.StringVar(&o.kubernetesMount, "kubernetes-mount", "kubernetes", "Mount path of the Kubernetes auth method")
+	fs.StringVar(&o.kubernetesRole, "kubernetes-role", "", "Kubernetes auth role (env: VAULT_KUBERNETES_ROLE)")
+	fs.StringVar(&o.saTokenPath, "service-account-token-path", vault.DefaultServiceAccountTokenPath, "Service account token used for Kubernetes auth")
+}
+
+func (o *authOptions) resolvedMethod() string {
+	if o.method != "" {
+		return o.method
+	}
+	return envOrDefault("VAULT_AUTH_METHOD", authMethodToken)
+}
+
+// authenticator returns the auth method to log in with and the file caching
+// its Vault token for a Vault node and the given namespace. It returns a nil
+// authenticator for the token method, which uses VAULT_TOKEN or
+// ~/.vault-token as is.
+func (o *authOptions) authenticator(namespace string) (vault.Authenticator, func(address string) string, error) {
+	switch method := o.resolvedMethod(); method {
+	case authMethodToken:
+		return nil, nil, nil
+
+	case authMethodAppRole:
+		roleID, err := secretValue(o.roleID, o.roleIDFile, "VAULT_ROLE_ID")
+		if err != nil {
+			return nil, nil, err
+		}
+		if roleID == "" {
+			return nil, nil, fmt.Errorf("AppRole auth requires a role_id (use --role-id, --role-id-file or VAULT_ROLE_ID env var)")
+		}
+		secretID, err := secretValue(o.secretID, o.secretIDFile, "VAULT_SECRET_ID")
+		if err != nil {
+			return nil, nil, err
+		}
+		auth := &vault.AppRoleAuth{MountPath: o.approleMount, RoleID: roleID, SecretID: secretID}
+		return auth, func(address string) string {
+			return cache.DefaultAuthCacheFile(address, namespace, o.approleMount, roleID)
+		}, nil
+
+	case authMethodKubernetes:
+		role := flagOrEnv(o.kubernetesRole, "VAULT_KUBERNETES_ROLE")
+		if role == "" {
+			return nil, nil, fmt.Errorf("kubernetes auth requires a role (use --kubernetes-role or VAULT_KUBERNETES_ROLE env var)")
+		}
+		auth := &vault.KubernetesAuth{MountPath: o.kubernetesMount, Role: role, JWTPath: o.saTokenPath}
+		return auth, func(address string) string {
+			return cache.DefaultAuthCacheFile(address, namespace, o.kubernetesMount, role+"@"+o.saTokenPath)
+		}, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported auth method %q", method)
+	}
+}
+
+// login logs in to Vault with the configured auth method, reusing the Vault
+// token cached by a previous login to the same node while it is valid. For
+// the token auth method, it checks the Vault token instead. Warnings go to
+// the stderr of cmd.
+func login(ctx context.Context, cmd *cobra.Command, client *vault.Client, opts *authOptions, useCache bool) error {
+	authenticator, cacheFile, err := opts.authenticator(client.Namespace())
+	if err != nil {
+		return err
+	}
+	if authenticator == nil {
+		_, err := checkVaultToken(ctx, cmd, client)
+		return err
+	}
+
+	saveToken := func(address string, auth *vault.Auth) {
+		if !useCache || auth.Exp <= 0 {
+			return
+		}
+		if err := cache.New(cacheFile(address)).Save(auth.ClientToken, auth.Exp); err != nil {
+			cmd.PrintErrf("warning: failed to cache Vault token: %v\n", err)
+		}
+	}
+	// A node the client fails over to gets a login of its own.
+	client.SetAuthenticator(authenticator, saveToken)
+
+	if useCache {
+		if token, exp, ok := cache.New(cacheFile(client.Address())).Load(); ok && !vaultTokenRefresh.NeedsRefresh(token, exp, time.Now()) {
+			return client.SetToken(token)
+		}
+	}
+
+	auth, err := client.Login(ctx, authenticator)
+	if err != nil {
+		return fmt.Errorf("failed to log in to Vault with %s auth: %w", opts.resolvedMethod(), err)
+	}
+	saveToken(client.Address(), auth)
+
+	return nil
+}
+
+// checkVaultToken looks up the Vault token used by the token auth method and
+// renews it when it gets close to expiring. A denied lookup is only a
+// warning, since the token may not be allowed to look itself up, unless the
+// token is known to have expired. It returns nil info when there is no token
+// or the lookup failed, leaving Vault to deny the requests, which
+// vaultTokenDenied then reports.
+func checkVaultToken(ctx context.Context, cmd *cobra.Command, client *vault.Client) (*vault.TokenInfo, error) {
+	token := client.Token()
+	if token == "" {
+		return nil, nil
+	}
+	expiry := cache.NewVaultTokenExpiry(cache.DefaultVaultTokenExpiryFile())
+
+	info, err := client.LookupToken(ctx)
+	if vault.IsUnavailable(err) {
+		return nil, err
+	}
+	if err != nil {
+		if _, expired := expiredVaultToken(token); expired && vault.IsPermissionDenied(err) {
+			return nil, vaultTokenDenied(ctx, client, err)
+		}
+		cmd.PrintErrf("warning: %v\n", err)
+		return nil, nil
+	}
+
+	if info.NeedsRenewal(time.Now(), vaultTokenRenewBefore) {
+		if info.Renewable {
+			auth, err := client.RenewToken(ctx)
+			if err != nil {
+				cmd.PrintErrf("warning: %v\n", err)
+			} else if auth.Exp > 0 {
+				info.ExpireTime = time.Unix(auth.Exp, 0)
+			}
+		} else if time.Until(info.ExpireTime) < vaultTokenRenewBefore {
+			cmd.PrintErrf("warning: your Vault token expires at %s and cannot be renewed, run `vault login` to get a new one\n",
+				info.ExpireTime.Local().Format(time.RFC3339))
+		}
+	}
+
+	if !info.ExpireTime.IsZero() {
+		if err := expiry.Save(token, info.ExpireTime); err != nil {
+			cmd.PrintErrf("warning: failed to save the Vault token expiry: %v\n", err)
+		}
+	}
+
+	return info, nil
+}
+
+// vaultTokenDenied reports a request Vault denied with the token of the
+// token auth method, with how to get a new token, when the token is known to
+// have expired or Vault also denies its lookup. Otherwise the token is valid
+// and err is returned as is.
+func vaultTokenDenied(ctx context.Context, client *vault.Client, err error) error {
+	if expireTime, expired := expiredVaultToken(client.Token()); expired {
+		return fmt.Errorf("your Vault token expired at %s, run `vault login` or `kubectl auth-vault login` to get a new one: %w",
+			expireTime.Local().Format(time.RFC3339), err)
+	}
+	if _, lookupErr := client.LookupToken(ctx); !vault.IsPermissionDenied(lookupErr) {
+		return err
+	}
+	return fmt.Errorf("your Vault token may be expired or invalid, run `vault login` or `kubectl auth-vault login` to get a new one: %w", err)
+}
+
+// expiredVaultToken returns the expiry saved for token by a previous lookup,
+// and whether it has passed.
+func expiredVaultToken(token string) (time.Time, bool) {
+	expireTime, err := cache.NewVaultTokenExpiry(cache.DefaultVaultTokenExpiryFile()).Load(token)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expireTime, !expireTime.After(time.Now())
+}
+
+// secretValue resolves a credential from its flag, then the file named by its
+// file flag, then the environment.
+func secretValue(value, file, envKey string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return os.Getenv(envKey), nil
+}
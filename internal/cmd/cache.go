@@ -0,0 +1,326 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/efortin/kubectl-auth-vault/internal/cache"
+	"github.com/efortin/kubectl-auth-vault/internal/jwt"
+	"github.com/efortin/kubectl-auth-vault/internal/source"
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+type cacheClearOptions struct {
+	profile   profileOptions
+	vault     vaultOptions
+	auth      authOptions
+	source    string
+	sources   map[string]source.Builder
+	cacheFile string
+	all       bool
+
+	// clients revoke the leases of cached service account tokens in the
+	// namespace they were generated in. They are created and logged in on
+	// first use, and clientErrs keeps the namespaces where that failed.
+	clients    map[string]*vault.Client
+	clientErrs map[string]error
+}
+
+func addCacheCommand(rootCmd *cobra.Command) {
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect and purge cached tokens",
+		Long:  `Manage the OIDC tokens cached in ~/.kube/vault_*_token.json.`,
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List cached tokens",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCacheList(cmd)
+		},
+	}
+
+	clearOpts := &cacheClearOptions{}
+	clearCmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Remove cached tokens",
+		Long: `Remove cached tokens. The token to remove is selected with the same source
+flags as get (--token-path, --pki-role, --kubernetes-creds-role, --kv-path...),
+given on the command line or by --profile. The Vault leases of service
+account tokens generated by the Kubernetes secrets engine are revoked first,
+in the namespace they were generated in, which deletes their service
+accounts; this requires the Vault address and credentials. A token whose
+lease could not be revoked is kept, so that clearing it can be retried; --all
+removes the other tokens and reports the leases it could not revoke.
+
+--all also removes the Vault tokens cached after logging in with AppRole or
+Kubernetes auth, the cached key sets of the Vault OIDC providers, the last
+healthy Vault nodes and the saved expiry of the Vault token, so that the next
+get starts afresh. ~/.vault-token is left alone.`,
+		Example: `  # Remove the cached token of a token path
+  kubectl-auth_vault cache clear --token-path identity/oidc/token/my_role
+
+  # Remove the cached token of a profile, whatever its credential source
+  kubectl-auth_vault cache clear --profile prod
+
+  # Remove the cached client certificate of a PKI role
+  kubectl-auth_vault cache clear --pki-role pki/issue/kubernetes
+
+  # Remove all cached tokens
+  kubectl-auth_vault cache clear --all`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCacheClear(cmd, clearOpts)
+		},
+	}
+	clearOpts.profile.addFlags(clearCmd.Flags())
+	clearOpts.vault.addFlags(clearCmd.Flags())
+	clearOpts.auth.addFlags(clearCmd.Flags())
+	clearOpts.sources = source.Builders()
+	clearCmd.Flags().StringVar(&clearOpts.source, "source", "", fmt.Sprintf("Credential source of the token to remove: %s (default: implied by the source flags, or %s)", strings.Join(source.Names(), ", "), source.Default))
+	for _, name := range source.Names() {
+		clearOpts.sources[name].AddFlags(clearCmd.Flags())
+	}
+	clearCmd.Flags().StringVar(&clearOpts.cacheFile, "cache-file", "", "Token cache file to remove")
+	clearCmd.Flags().BoolVar(&clearOpts.all, "all", false, "Remove all cached tokens, including the Vault tokens of logins, and the other cached state")
+
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove expired and unparsable cached tokens",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCachePrune(cmd)
+		},
+	}
+
+	cacheCmd.AddCommand(listCmd)
+	cacheCmd.AddCommand(clearCmd)
+	cacheCmd.AddCommand(pruneCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
+
+func runCacheList(cmd *cobra.Command) error {
+	caches, err := cache.List()
+	if err != nil {
+		return err
+	}
+	if len(caches) == 0 {
+		printf(cmd, "No cached tokens\n")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "FILE\tNAMESPACE\tTOKEN PATH\tSUBJECT\tISSUED AT\tREMAINING")
+	now := time.Now()
+	for _, c := range caches {
+		entry, err := c.Peek()
+		if err != nil {
+			_, _ = fmt.Fprintf(w, "%s\t-\t-\t-\t-\tunparsable\n", c.FilePath())
+			continue
+		}
+
+		subject, issuedAt := "-", "-"
+		if payload, err := jwt.DecodePayload(entry.Token); err == nil {
+			subject = valueOrDefault(payload.Sub, "-")
+			if payload.Iat > 0 {
+				issuedAt = time.Unix(payload.Iat, 0).Format(time.RFC3339)
+			}
+		} else if cert, err := parseCertificate(entry.ClientCertificate); err == nil {
+			subject = "CN=" + cert.Subject.CommonName
+			issuedAt = cert.NotBefore.Format(time.RFC3339)
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			c.FilePath(),
+			valueOrDefault(entry.Namespace, "-"),
+			valueOrDefault(entry.TokenPath, "-"),
+			subject,
+			issuedAt,
+			remaining(entry.Exp, now),
+		)
+	}
+	return w.Flush()
+}
+
+func runCacheClear(cmd *cobra.Command, opts *cacheClearOptions) error {
+	if err := opts.profile.apply(cmd.Flags()); err != nil {
+		return err
+	}
+
+	if opts.all {
+		caches, err := cache.List()
+		if err != nil {
+			return err
+		}
+		// A token whose lease could not be revoked is kept so the revocation
+		// can be retried, without keeping the other tokens from being removed.
+		var revokeErrs []error
+		for _, c := range caches {
+			if err := opts.revokeLease(cmd, c); err != nil {
+				revokeErrs = append(revokeErrs, err)
+				continue
+			}
+			if err := c.Clear(); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to remove %s: %w", c.FilePath(), err)
+			}
+			printf(cmd, "Removed %s\n", c.FilePath())
+		}
+
+		files, err := cache.StateFiles()
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to remove %s: %w", file, err)
+			}
+			printf(cmd, "Removed %s\n", file)
+		}
+
+		if len(revokeErrs) > 0 {
+			return fmt.Errorf("kept %d cached token(s) whose lease could not be revoked:\n%w", len(revokeErrs), errors.Join(revokeErrs...))
+		}
+		return nil
+	}
+
+	// The token is found like get caches it, from the source flags given on
+	// the command line or by the profile.
+	cacheFile := opts.cacheFile
+	if cacheFile == "" {
+		_, src, err := buildSource(opts.source, opts.sources)
+		if err != nil {
+			return err
+		}
+		if src.CacheKey() == "" {
+			return fmt.Errorf("--token-path, another source flag, --cache-file, --profile or --all is required")
+		}
+		cacheFile = cache.DefaultCacheFile(opts.vault.resolvedNamespace(), src.CacheKey())
+	}
+
+	c := cache.New(cacheFile)
+	if err := opts.revokeLease(cmd, c); err != nil {
+		return err
+	}
+	err := c.Clear()
+	if errors.Is(err, os.ErrNotExist) {
+		printf(cmd, "No cached token in %s\n", cacheFile)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove %s: %w", cacheFile, err)
+	}
+	printf(cmd, "Removed %s\n", cacheFile)
+	return nil
+}
+
+// revokeLease revokes the Vault lease of the service account token cached in
+// c, if any and not expired yet, from the namespace the token was generated
+// in. The cached token is kept when this fails, so the revocation can be
+// retried.
+func (o *cacheClearOptions) revokeLease(cmd *cobra.Command, c *cache.Cache) error {
+	entry, err := c.Peek()
+	if err != nil || entry.LeaseID == "" || entry.Exp <= time.Now().Unix() {
+		return nil
+	}
+
+	client, err := o.client(cmd, entry.Namespace)
+	if err == nil {
+		err = client.RevokeLease(cmd.Context(), entry.LeaseID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke the lease %s of %s: %w", entry.LeaseID, c.FilePath(), err)
+	}
+	printf(cmd, "Revoked lease %s\n", entry.LeaseID)
+	return nil
+}
+
+// client returns the client logged in to namespace, creating it on first
+// use.
+func (o *cacheClearOptions) client(cmd *cobra.Command, namespace string) (*vault.Client, error) {
+	if client, ok := o.clients[namespace]; ok {
+		return client, nil
+	}
+	if err, ok := o.clientErrs[namespace]; ok {
+		return nil, err
+	}
+
+	client, err := o.vault.newNamespaceClient(namespace)
+	if err == nil {
+		err = login(cmd.Context(), cmd, client, &o.auth, true)
+	}
+	if err != nil {
+		if o.clientErrs == nil {
+			o.clientErrs = make(map[string]error)
+		}
+		o.clientErrs[namespace] = err
+		return nil, err
+	}
+
+	if o.clients == nil {
+		o.clients = make(map[string]*vault.Client)
+	}
+	o.clients[namespace] = client
+	return client, nil
+}
+
+func runCachePrune(cmd *cobra.Command) error {
+	caches, err := cache.List()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	pruned := 0
+	for _, c := range caches {
+		entry, err := c.Peek()
+		var reason string
+		switch {
+		case errors.Is(err, cache.ErrCorrupt):
+			reason = "unparsable"
+		case err != nil:
+			cmd.PrintErrf("warning: %v\n", err)
+			continue
+		case entry.Exp <= now:
+			reason = "expired"
+		default:
+			continue
+		}
+
+		if err := c.Clear(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", c.FilePath(), err)
+		}
+		printf(cmd, "Removed %s (%s)\n", c.FilePath(), reason)
+		pruned++
+	}
+
+	printf(cmd, "Pruned %d cached token(s)\n", pruned)
+	return nil
+}
+
+// parseCertificate parses the first certificate of a PEM bundle.
+func parseCertificate(data string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// remaining formats the lifetime left until exp.
+func remaining(exp int64, now time.Time) string {
+	left := time.Unix(exp, 0).Sub(now)
+	if left <= 0 {
+		return "expired"
+	}
+	return left.Truncate(time.Second).String()
+}
@@ -2,23 +2,49 @@ package cmd_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/efortin/kubectl-auth-vault/internal/cache"
 	"github.com/efortin/kubectl-auth-vault/internal/cmd"
+	"github.com/efortin/kubectl-auth-vault/internal/credential"
 	"github.com/efortin/kubectl-auth-vault/internal/jwt"
+	"github.com/efortin/kubectl-auth-vault/internal/source"
+	"github.com/efortin/kubectl-auth-vault/internal/source/sourcetest"
 	"github.com/efortin/kubectl-auth-vault/internal/vault"
 )
 
+// fakeSource is registered as the "fake" credential source.
+var fakeSource = &sourcetest.Fake{}
+
+func init() {
+	source.Register("fake", func() source.Builder { return fakeSource })
+}
+
 func writeVaultResponse(w http.ResponseWriter, resp vault.OIDCTokenResponse) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
@@ -26,6 +52,17 @@ func writeVaultResponse(w http.ResponseWriter, resp vault.OIDCTokenResponse) {
 	}
 }
 
+func writeAuthResponse(w http.ResponseWriter, clientToken string, leaseDuration int) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": nil,
+		"auth": map[string]interface{}{
+			"client_token":   clientToken,
+			"lease_duration": leaseDuration,
+		},
+	})
+}
+
 func createTestJWT(exp int64) string {
 	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
 	payload := jwt.Payload{Exp: exp, Iat: time.Now().Unix(), Sub: "test"}
@@ -35,9 +72,73 @@ func createTestJWT(exp int64) string {
 	return strings.Join([]string{header, payloadB64, signature}, ".")
 }
 
+const testIssuer = "https://vault.example.com/v1/identity/oidc"
+
+func newSigningKey() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	return key
+}
+
+// signTestJWT returns an ES256 token signed by key with the key ID "test-key".
+func signTestJWT(key *ecdsa.PrivateKey, claims map[string]interface{}) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","kid":"test-key"}`))
+	payload, _ := json.Marshal(claims)
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, sig, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	Expect(err).NotTo(HaveOccurred())
+	signature := append(r.FillBytes(make([]byte, 32)), sig.FillBytes(make([]byte, 32))...)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// serveKeySet answers the Vault OIDC discovery and keys endpoints with the
+// public key of key. It reports whether the request was handled.
+func serveKeySet(w http.ResponseWriter, r *http.Request, key *ecdsa.PrivateKey) bool {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/v1/identity/oidc/.well-known/openid-configuration":
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": testIssuer})
+	case "/v1/identity/oidc/.well-known/keys":
+		_ = json.NewEncoder(w).Encode(jwt.KeySet{Keys: []jwt.JSONWebKey{{
+			Kty: "EC", Kid: "test-key", Alg: "ES256", Crv: "P-256",
+			X: base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			Y: base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		}}})
+	default:
+		return false
+	}
+	return true
+}
+
+// createTestCertificate returns a self-signed client certificate for
+// commonName and its key, PEM-encoded.
+func createTestCertificate(commonName string, notAfter time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
 func executeCommand(args ...string) (*bytes.Buffer, error) {
+	return executeCommandWithInput("", args...)
+}
+
+func executeCommandWithInput(input string, args ...string) (*bytes.Buffer, error) {
 	buf := new(bytes.Buffer)
 	rootCmd := cmd.NewRootCmd()
+	rootCmd.SetIn(strings.NewReader(input))
 	rootCmd.SetOut(buf)
 	rootCmd.SetErr(buf)
 	rootCmd.SetArgs(args)
@@ -76,6 +177,37 @@ var _ = Describe("Commands", func() {
 				Expect(buf.String()).To(ContainSubstring("vault.test.com"))
 			})
 		})
+
+		Context("with TLS settings", func() {
+			AfterEach(func() {
+				_ = os.Unsetenv("VAULT_SKIP_VERIFY")
+			})
+
+			It("should add the TLS settings to the kubeconfig example", func() {
+				buf, err := executeCommand("config", "show",
+					"--vault-addr", "https://vault.test.com",
+					"--ca-cert", "/etc/vault/ca.pem",
+					"--tls-skip-verify",
+				)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(buf.String()).To(MatchRegexp(`- name: VAULT_CACERT\s+value: /etc/vault/ca.pem\n`))
+				Expect(buf.String()).To(MatchRegexp(`- name: VAULT_SKIP_VERIFY\s+value: "true"\n`))
+			})
+
+			It("should reject an invalid VAULT_SKIP_VERIFY", func() {
+				_ = os.Setenv("VAULT_SKIP_VERIFY", "maybe")
+				_, err := executeCommand("config", "show")
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("VAULT_SKIP_VERIFY"))
+			})
+
+			It("should let --tls-skip-verify=false override VAULT_SKIP_VERIFY", func() {
+				_ = os.Setenv("VAULT_SKIP_VERIFY", "true")
+				buf, err := executeCommand("config", "show", "--tls-skip-verify=false")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(buf.String()).To(ContainSubstring("Skip Verify:   false"))
+			})
+		})
 	})
 
 	Describe("Get Command", func() {
@@ -94,12 +226,13 @@ var _ = Describe("Commands", func() {
 			var (
 				server    *httptest.Server
 				testToken string
+				testExp   int64
 				tmpDir    string
 			)
 
 			BeforeEach(func() {
-				exp := time.Now().Add(time.Hour).Unix()
-				testToken = createTestJWT(exp)
+				testExp = time.Now().Add(time.Hour).Unix()
+				testToken = createTestJWT(testExp)
 
 				server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					writeVaultResponse(w, vault.OIDCTokenResponse{
@@ -129,12 +262,60 @@ var _ = Describe("Commands", func() {
 
 				var cred struct {
 					Status struct {
-						Token string `json:"token"`
+						Token               string `json:"token"`
+						ExpirationTimestamp string `json:"expirationTimestamp"`
 					} `json:"status"`
 				}
 				err = json.Unmarshal(buf.Bytes(), &cred)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(cred.Status.Token).To(Equal(testToken))
+				Expect(cred.Status.ExpirationTimestamp).To(Equal(time.Unix(testExp, 0).UTC().Format(time.RFC3339)))
+			})
+
+			It("should include expirationTimestamp when served from cache", func() {
+				cacheFile := filepath.Join(tmpDir, "cache.json")
+				args := []string{
+					"get",
+					"--vault-addr", server.URL,
+					"--token-path", "identity/oidc/token/test",
+					"--cache-file", cacheFile,
+				}
+				_, err := executeCommand(args...)
+				Expect(err).NotTo(HaveOccurred())
+
+				server.Close()
+				buf, err := executeCommand(args...)
+				Expect(err).NotTo(HaveOccurred())
+
+				var cred credential.ExecCredential
+				Expect(json.Unmarshal(buf.Bytes(), &cred)).To(Succeed())
+				Expect(cred.Status.Token).To(Equal(testToken))
+				Expect(cred.Status.ExpirationTimestamp).To(Equal(time.Unix(testExp, 0).UTC().Format(time.RFC3339)))
+			})
+
+			It("should omit expirationTimestamp and not reuse a token without exp claim", func() {
+				callCount := 0
+				server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					callCount++
+					writeVaultResponse(w, vault.OIDCTokenResponse{
+						Data: vault.OIDCTokenData{Token: createTestJWT(0)},
+					})
+				})
+
+				cacheFile := filepath.Join(tmpDir, "cache.json")
+				args := []string{
+					"get",
+					"--vault-addr", server.URL,
+					"--token-path", "identity/oidc/token/test",
+					"--cache-file", cacheFile,
+				}
+				buf, err := executeCommand(args...)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(buf.String()).NotTo(ContainSubstring("expirationTimestamp"))
+
+				_, err = executeCommand(args...)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(callCount).To(Equal(2))
 			})
 
 			It("should use cache on second call", func() {
@@ -184,59 +365,2068 @@ var _ = Describe("Commands", func() {
 				Expect(callCount).To(Equal(2))
 			})
 
-			It("should use VAULT_ADDR from environment", func() {
-				GinkgoT().Setenv("VAULT_ADDR", server.URL)
-
+			It("should discard a corrupt cache file and fetch a new token", func() {
 				cacheFile := filepath.Join(tmpDir, "cache.json")
-				_, err := executeCommand(
+				Expect(os.WriteFile(cacheFile, []byte(`{"token":"trunc`), 0600)).To(Succeed())
+
+				buf, err := executeCommand(
 					"get",
+					"--vault-addr", server.URL,
 					"--token-path", "identity/oidc/token/test",
 					"--cache-file", cacheFile,
-					"--no-cache",
 				)
 				Expect(err).NotTo(HaveOccurred())
-			})
-		})
-	})
+				Expect(buf.String()).To(ContainSubstring("corrupt token cache"))
+				Expect(buf.String()).To(ContainSubstring(testToken))
 
-	Describe("Config Test Command", func() {
-		Context("without VAULT_ADDR", func() {
-			BeforeEach(func() {
-				_ = os.Unsetenv("VAULT_ADDR")
+				data, err := os.ReadFile(cacheFile)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(data)).To(ContainSubstring(testToken))
 			})
 
-			It("should return an error", func() {
-				_, err := executeCommand("config", "test")
-				Expect(err).To(HaveOccurred())
+			It("should fetch the token only once for concurrent invocations", func() {
+				var callCount atomic.Int32
+				server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					callCount.Add(1)
+					time.Sleep(200 * time.Millisecond)
+					writeVaultResponse(w, vault.OIDCTokenResponse{
+						Data: vault.OIDCTokenData{Token: testToken},
+					})
+				})
+
+				cacheFile := filepath.Join(tmpDir, "cache.json")
+				errs := make(chan error, 5)
+				for i := 0; i < 5; i++ {
+					go func() {
+						defer GinkgoRecover()
+						_, err := executeCommand(
+							"get",
+							"--vault-addr", server.URL,
+							"--token-path", "identity/oidc/token/test",
+							"--cache-file", cacheFile,
+						)
+						errs <- err
+					}()
+				}
+				for i := 0; i < 5; i++ {
+					Expect(<-errs).NotTo(HaveOccurred())
+				}
+
+				Expect(callCount.Load()).To(Equal(int32(1)))
 			})
-		})
 
-		Context("with mock vault server", func() {
-			var server *httptest.Server
+			It("should refresh a cached token inside the refresh window", func() {
+				callCount := 0
+				shortLived := createTestJWT(time.Now().Add(20 * time.Second).Unix())
+				server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					callCount++
+					writeVaultResponse(w, vault.OIDCTokenResponse{
+						Data: vault.OIDCTokenData{Token: shortLived},
+					})
+				})
 
-			BeforeEach(func() {
-				exp := time.Now().Add(time.Hour).Unix()
-				testToken := createTestJWT(exp)
+				cacheFile := filepath.Join(tmpDir, "cache.json")
+				for i := 0; i < 2; i++ {
+					_, err := executeCommand(
+						"get",
+						"--vault-addr", server.URL,
+						"--token-path", "identity/oidc/token/test",
+						"--cache-file", cacheFile,
+						"--refresh-before", "1m",
+					)
+					Expect(err).NotTo(HaveOccurred())
+				}
 
-				server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(callCount).To(Equal(2))
+			})
+
+			It("should retry failing Vault requests up to --max-retries", func() {
+				callCount := 0
+				server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					callCount++
+					if callCount <= 2 {
+						w.WriteHeader(http.StatusBadGateway)
+						return
+					}
 					writeVaultResponse(w, vault.OIDCTokenResponse{
 						Data: vault.OIDCTokenData{Token: testToken},
 					})
+				})
+
+				args := []string{
+					"get",
+					"--vault-addr", server.URL,
+					"--token-path", "identity/oidc/token/test",
+					"--no-cache",
+				}
+				_, err := executeCommand(append(args, "--max-retries", "1")...)
+				Expect(err).To(HaveOccurred())
+				Expect(callCount).To(Equal(2))
+
+				callCount = 0
+				buf, err := executeCommand(append(args, "--max-retries", "2")...)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(buf.String()).To(ContainSubstring(testToken))
+				Expect(callCount).To(Equal(3))
+			})
+
+			Context("when Vault is unavailable", func() {
+				var (
+					cacheFile string
+					cached    string
+				)
+
+				BeforeEach(func() {
+					cacheFile = filepath.Join(tmpDir, "cache.json")
+					cached = createTestJWT(time.Now().Add(20 * time.Second).Unix())
+					Expect(cache.New(cacheFile).Save(cached, time.Now().Add(20*time.Second).Unix())).To(Succeed())
+
+					server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						w.WriteHeader(http.StatusServiceUnavailable)
+					})
+				})
+
+				get := func(args ...string) (*bytes.Buffer, error) {
+					return executeCommand(append([]string{
+						"get",
+						"--vault-addr", server.URL,
+						"--token-path", "identity/oidc/token/test",
+						"--cache-file", cacheFile,
+						"--refresh-before", "1m",
+						"--max-retries", "0",
+					}, args...)...)
+				}
+
+				It("should fall back to the cached token until it expires", func() {
+					buf, err := get()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(buf.String()).To(ContainSubstring("Vault is unavailable, using the cached token expiring at"))
+
+					var cred credential.ExecCredential
+					Expect(json.Unmarshal([]byte(buf.String()[strings.Index(buf.String(), "{"):]), &cred)).To(Succeed())
+					Expect(cred.Status.Token).To(Equal(cached))
+				})
+
+				It("should fail with --fail-on-refresh-error", func() {
+					_, err := get("--fail-on-refresh-error")
+					Expect(err).To(MatchError(ContainSubstring("failed to fetch token from Vault")))
+				})
+
+				It("should fail when the cached token has expired", func() {
+					Expect(cache.New(cacheFile).Save(cached, time.Now().Add(-time.Second).Unix())).To(Succeed())
+					_, err := get()
+					Expect(err).To(HaveOccurred())
+				})
+
+				It("should not fall back when Vault denies the request", func() {
+					server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						w.WriteHeader(http.StatusForbidden)
+					})
+					_, err := get()
+					Expect(err).To(HaveOccurred())
+				})
+			})
+
+			It("should fail over to the next Vault address and report it with --verbose", func() {
+				GinkgoT().Setenv("HOME", tmpDir)
+				down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusBadGateway)
 				}))
+				defer down.Close()
+
+				buf, err := executeCommand(
+					"get",
+					"--vault-addr", down.URL+","+server.URL,
+					"--token-path", "identity/oidc/token/test",
+					"--no-cache",
+					"--max-retries", "0",
+					"--verbose",
+				)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(buf.String()).To(ContainSubstring("Vault at " + down.URL + " is unavailable"))
+				Expect(buf.String()).To(ContainSubstring("Token served by " + server.URL))
+
+				state, err := filepath.Glob(filepath.Join(tmpDir, ".kube", "vault_addr_*.json"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(state).To(HaveLen(1))
+				data, err := os.ReadFile(state[0])
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(data)).To(ContainSubstring(server.URL))
 			})
 
-			AfterEach(func() {
-				server.Close()
+			It("should bound the whole command with --timeout", func() {
+				GinkgoT().Setenv("HOME", tmpDir)
+				slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					time.Sleep(300 * time.Millisecond)
+					w.WriteHeader(http.StatusBadGateway)
+				}))
+				defer slow.Close()
+
+				start := time.Now()
+				_, err := executeCommand(
+					"get",
+					"--vault-addr", slow.URL+","+slow.URL+","+slow.URL,
+					"--token-path", "identity/oidc/token/test",
+					"--no-cache",
+					"--max-retries", "0",
+					"--timeout", "500ms",
+				)
+				Expect(err).To(MatchError(ContainSubstring("context deadline exceeded")))
+				Expect(time.Since(start)).To(BeNumerically("<", 800*time.Millisecond))
 			})
 
-			It("should show success message", func() {
+			It("should reject an invalid VAULT_MAX_RETRIES", func() {
+				GinkgoT().Setenv("VAULT_MAX_RETRIES", "many")
+				_, err := executeCommand(
+					"get",
+					"--vault-addr", server.URL,
+					"--token-path", "identity/oidc/token/test",
+					"--no-cache",
+				)
+				Expect(err).To(MatchError(ContainSubstring("invalid VAULT_MAX_RETRIES")))
+			})
+
+			It("should reject an invalid --refresh-before-percent", func() {
+				_, err := executeCommand(
+					"get",
+					"--vault-addr", server.URL,
+					"--token-path", "identity/oidc/token/test",
+					"--refresh-before-percent", "150",
+				)
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("should echo the apiVersion requested in KUBERNETES_EXEC_INFO", func() {
+				GinkgoT().Setenv("KUBERNETES_EXEC_INFO", `{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential","spec":{"interactive":false}}`)
+
+				cacheFile := filepath.Join(tmpDir, "cache.json")
 				buf, err := executeCommand(
-					"config", "test",
+					"get",
 					"--vault-addr", server.URL,
 					"--token-path", "identity/oidc/token/test",
+					"--cache-file", cacheFile,
 				)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(buf.String()).To(ContainSubstring("Successfully"))
+
+				var cred credential.ExecCredential
+				Expect(json.Unmarshal(buf.Bytes(), &cred)).To(Succeed())
+				Expect(cred.APIVersion).To(Equal(credential.APIVersionV1Beta1))
+			})
+
+			It("should fail on an unsupported apiVersion in KUBERNETES_EXEC_INFO", func() {
+				GinkgoT().Setenv("KUBERNETES_EXEC_INFO", `{"apiVersion":"client.authentication.k8s.io/v2","kind":"ExecCredential"}`)
+
+				cacheFile := filepath.Join(tmpDir, "cache.json")
+				_, err := executeCommand(
+					"get",
+					"--vault-addr", server.URL,
+					"--token-path", "identity/oidc/token/test",
+					"--cache-file", cacheFile,
+				)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("unsupported ExecCredential apiVersion"))
+			})
+
+			It("should send the namespace from --namespace or VAULT_NAMESPACE", func() {
+				var namespaces []string
+				server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					namespaces = append(namespaces, r.Header.Get("X-Vault-Namespace"))
+					writeVaultResponse(w, vault.OIDCTokenResponse{
+						Data: vault.OIDCTokenData{Token: testToken},
+					})
+				})
+
+				_, err := executeCommand(
+					"get",
+					"--vault-addr", server.URL,
+					"--token-path", "identity/oidc/token/test",
+					"--namespace", "team-a",
+					"--no-cache",
+				)
+				Expect(err).NotTo(HaveOccurred())
+
+				GinkgoT().Setenv("VAULT_NAMESPACE", "team-b")
+				_, err = executeCommand(
+					"get",
+					"--vault-addr", server.URL,
+					"--token-path", "identity/oidc/token/test",
+					"--no-cache",
+				)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(namespaces).To(Equal([]string{"team-a", "team-b"}))
+			})
+
+			It("should use VAULT_ADDR from environment", func() {
+				GinkgoT().Setenv("VAULT_ADDR", server.URL)
+
+				cacheFile := filepath.Join(tmpDir, "cache.json")
+				_, err := executeCommand(
+					"get",
+					"--token-path", "identity/oidc/token/test",
+					"--cache-file", cacheFile,
+					"--no-cache",
+				)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Get Command with --verify", func() {
+		var (
+			server     *httptest.Server
+			tmpDir     string
+			cacheFile  string
+			key        *ecdsa.PrivateKey
+			served     string
+			tokenCount int
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "cmd-verify-test")
+			Expect(err).NotTo(HaveOccurred())
+			GinkgoT().Setenv("HOME", tmpDir)
+			GinkgoT().Setenv("VAULT_NAMESPACE", "")
+			cacheFile = filepath.Join(tmpDir, "cache.json")
+
+			key = newSigningKey()
+			served = signTestJWT(key, map[string]interface{}{"iss": testIssuer, "exp": time.Now().Add(time.Hour).Unix()})
+			tokenCount = 0
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if serveKeySet(w, r, key) {
+					return
+				}
+				tokenCount++
+				writeVaultResponse(w, vault.OIDCTokenResponse{
+					Data: vault.OIDCTokenData{Token: served},
+				})
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		get := func() (*bytes.Buffer, error) {
+			return executeCommand(
+				"get",
+				"--vault-addr", server.URL,
+				"--token-path", "identity/oidc/token/test",
+				"--cache-file", cacheFile,
+				"--verify",
+			)
+		}
+
+		It("should return a verified token and cache the key set", func() {
+			buf, err := get()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring(served))
+
+			jwks, err := filepath.Glob(filepath.Join(tmpDir, ".kube", "vault_jwks_*.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(jwks).To(HaveLen(1))
+		})
+
+		It("should discard a tampered cached token", func() {
+			forged := signTestJWT(newSigningKey(), map[string]interface{}{"iss": testIssuer, "exp": time.Now().Add(time.Hour).Unix()})
+			Expect(cache.New(cacheFile).Save(forged, time.Now().Add(time.Hour).Unix())).To(Succeed())
+
+			buf, err := get()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("discarding cached token"))
+			Expect(buf.String()).To(ContainSubstring(served))
+			Expect(tokenCount).To(Equal(1))
+		})
+
+		It("should fail closed when Vault returns a token that does not verify", func() {
+			served = signTestJWT(key, map[string]interface{}{"iss": "https://other.example.com", "exp": time.Now().Add(time.Hour).Unix()})
+
+			_, err := get()
+			Expect(err).To(MatchError(ContainSubstring("failed verification")))
+			_, err = os.Stat(cacheFile)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+
+	Describe("Get Command with an expected audience", func() {
+		var (
+			server     *httptest.Server
+			tmpDir     string
+			cacheFile  string
+			audience   interface{}
+			tokenCount int
+		)
+
+		tokenFor := func(aud interface{}) string {
+			return signTestJWT(newSigningKey(), map[string]interface{}{"aud": aud, "exp": time.Now().Add(time.Hour).Unix()})
+		}
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "cmd-audience-test")
+			Expect(err).NotTo(HaveOccurred())
+			cacheFile = filepath.Join(tmpDir, "cache.json")
+
+			audience = "prod"
+			tokenCount = 0
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tokenCount++
+				writeVaultResponse(w, vault.OIDCTokenResponse{
+					Data: vault.OIDCTokenData{Token: tokenFor(audience)},
+				})
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		get := func(args ...string) (*bytes.Buffer, error) {
+			return executeCommand(append([]string{
+				"get",
+				"--vault-addr", server.URL,
+				"--token-path", "identity/oidc/token/test",
+				"--cache-file", cacheFile,
+			}, args...)...)
+		}
+
+		It("should return a token issued for the expected audience", func() {
+			audience = []string{"staging", "prod"}
+			_, err := get("--expected-audience", "prod")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should fail closed on another audience and not cache the token", func() {
+			audience = "staging"
+			_, err := get("--expected-audience", "prod")
+			Expect(err).To(MatchError(ContainSubstring(`audience ["staging"] does not include "prod"`)))
+			_, err = os.Stat(cacheFile)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("should discard a cached token issued for another audience", func() {
+			Expect(cache.New(cacheFile).Save(tokenFor("staging"), time.Now().Add(time.Hour).Unix())).To(Succeed())
+
+			buf, err := get("--expected-audience", "prod")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("discarding cached token"))
+			Expect(tokenCount).To(Equal(1))
+		})
+
+		It("should use the audience of the cluster in KUBERNETES_EXEC_INFO", func() {
+			GinkgoT().Setenv("KUBERNETES_EXEC_INFO", `{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential",
+				"spec":{"cluster":{"server":"https://staging.example.com","config":{"audience":"staging"}}}}`)
+
+			_, err := get()
+			Expect(err).To(MatchError(ContainSubstring(`does not include "staging"`)))
+		})
+
+		It("should prefer --expected-audience over the cluster audience", func() {
+			GinkgoT().Setenv("KUBERNETES_EXEC_INFO", `{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential",
+				"spec":{"cluster":{"server":"https://staging.example.com","config":{"audience":"staging"}}}}`)
+
+			_, err := get("--expected-audience", "prod")
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("Get Command with --pki-role", func() {
+		var (
+			server    *httptest.Server
+			tmpDir    string
+			cacheFile string
+			issued    int
+			request   map[string]interface{}
+			certPEM   string
+			keyPEM    string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "cmd-pki-test")
+			Expect(err).NotTo(HaveOccurred())
+			GinkgoT().Setenv("HOME", tmpDir)
+			cacheFile = filepath.Join(tmpDir, "cache.json")
+			issued = 0
+
+			certPEM, keyPEM = createTestCertificate("jane", time.Now().Add(time.Hour).Truncate(time.Second))
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/pki/issue/kubernetes" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				issued++
+				Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+					"certificate": certPEM,
+					"private_key": keyPEM,
+				}})
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		get := func(args ...string) (*bytes.Buffer, error) {
+			return executeCommand(append([]string{
+				"get",
+				"--vault-addr", server.URL,
+				"--pki-role", "pki/issue/kubernetes",
+				"--cache-file", cacheFile,
+			}, args...)...)
+		}
+
+		It("should return the client certificate and key, expiring with the certificate", func() {
+			buf, err := get("--pki-common-name", "jane", "--pki-ttl", "1h")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(request).To(Equal(map[string]interface{}{"common_name": "jane", "ttl": "1h0m0s"}))
+
+			var cred credential.ExecCredential
+			Expect(json.Unmarshal(buf.Bytes(), &cred)).To(Succeed())
+			Expect(cred.Status.Token).To(BeEmpty())
+			Expect(cred.Status.ClientCertificateData).To(Equal(certPEM))
+			Expect(cred.Status.ClientKeyData).To(Equal(keyPEM))
+			Expect(cred.Status.ExpirationTimestamp).To(Equal(time.Now().Add(time.Hour).Truncate(time.Second).UTC().Format(time.RFC3339)))
+		})
+
+		It("should cache the certificate until it expires", func() {
+			_, err := get()
+			Expect(err).NotTo(HaveOccurred())
+			buf, err := get()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(issued).To(Equal(1))
+			Expect(buf.String()).To(ContainSubstring("clientCertificateData"))
+		})
+
+		It("should issue a new certificate close to its expiry", func() {
+			certPEM, keyPEM = createTestCertificate("jane", time.Now().Add(20*time.Second))
+			_, err := get()
+			Expect(err).NotTo(HaveOccurred())
+			_, err = get()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(issued).To(Equal(2))
+		})
+
+		It("should list cached certificates with their common name", func() {
+			cacheFile = cache.DefaultCacheFile("", "pki/issue/kubernetes")
+			_, err := get()
+			Expect(err).NotTo(HaveOccurred())
+
+			buf, err := executeCommand("cache", "list")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("pki/issue/kubernetes"))
+			Expect(buf.String()).To(ContainSubstring("CN=jane"))
+		})
+
+		It("should reject token verification options", func() {
+			_, err := get("--verify")
+			Expect(err).To(MatchError(ContainSubstring("cannot be used with the pki source")))
+		})
+	})
+
+	Describe("Get Command with --kubernetes-creds-role", func() {
+		var (
+			server  *httptest.Server
+			tmpDir  string
+			saToken string
+			issued  int
+			request map[string]interface{}
+			revoked []string
+			// revokedIn holds the namespace of each revocation.
+			revokedIn []string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "cmd-kubernetes-creds-test")
+			Expect(err).NotTo(HaveOccurred())
+			GinkgoT().Setenv("HOME", tmpDir)
+			GinkgoT().Setenv("VAULT_TOKEN", "")
+			issued, revoked, revokedIn = 0, nil, nil
+
+			// The token outlives its lease, which must win.
+			saToken = createTestJWT(time.Now().Add(24 * time.Hour).Unix())
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v1/kubernetes/creds/breakglass":
+					issued++
+					Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+					w.Header().Set("Content-Type", "application/json")
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{
+						"lease_id":       fmt.Sprintf("kubernetes/creds/breakglass/%d", issued),
+						"lease_duration": 900,
+						"data":           map[string]interface{}{"service_account_token": saToken},
+					})
+				case "/v1/sys/leases/revoke":
+					var body map[string]string
+					Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+					revoked = append(revoked, body["lease_id"])
+					revokedIn = append(revokedIn, r.Header.Get("X-Vault-Namespace"))
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		get := func() (*bytes.Buffer, error) {
+			return executeCommand(
+				"get",
+				"--vault-addr", server.URL,
+				"--kubernetes-creds-role", "kubernetes/creds/breakglass",
+				"--kubernetes-creds-namespace", "default",
+				"--kubernetes-creds-ttl", "15m",
+				"--kubernetes-creds-cluster-role-binding",
+			)
+		}
+
+		It("should return the service account token, expiring with its lease", func() {
+			buf, err := get()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(request).To(Equal(map[string]interface{}{
+				"kubernetes_namespace": "default",
+				"ttl":                  "15m0s",
+				"cluster_role_binding": true,
+			}))
+
+			var cred credential.ExecCredential
+			Expect(json.Unmarshal(buf.Bytes(), &cred)).To(Succeed())
+			Expect(cred.Status.Token).To(Equal(saToken))
+			exp, err := time.Parse(time.RFC3339, cred.Status.ExpirationTimestamp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(time.Until(exp)).To(BeNumerically("~", 15*time.Minute, 5*time.Second))
+
+			_, err = get()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(issued).To(Equal(1))
+		})
+
+		It("should revoke the lease when clearing the cache", func() {
+			_, err := get()
+			Expect(err).NotTo(HaveOccurred())
+
+			buf, err := executeCommand("cache", "clear", "--vault-addr", server.URL, "--kubernetes-creds-role", "kubernetes/creds/breakglass")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("Revoked lease kubernetes/creds/breakglass/1"))
+			Expect(revoked).To(Equal([]string{"kubernetes/creds/breakglass/1"}))
+
+			_, err = os.Stat(cache.DefaultCacheFile("", "kubernetes/creds/breakglass"))
+			Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+		})
+
+		It("should revoke the lease when clearing the cache of a profile", func() {
+			configFile := filepath.Join(tmpDir, "config.yaml")
+			Expect(os.WriteFile(configFile, []byte(`profiles:
+  breakglass:
+    vault-addr: `+server.URL+`
+    namespace: team-a
+    kubernetes-creds:
+      role: kubernetes/creds/breakglass
+      namespace: default
+`), 0600)).To(Succeed())
+			GinkgoT().Setenv("KUBECTL_AUTH_VAULT_CONFIG", configFile)
+
+			_, err := executeCommand("get", "--profile", "breakglass")
+			Expect(err).NotTo(HaveOccurred())
+			cacheFile := cache.DefaultCacheFile("team-a", "kubernetes/creds/breakglass")
+			Expect(cacheFile).To(BeAnExistingFile())
+
+			buf, err := executeCommand("cache", "clear", "--profile", "breakglass")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("Revoked lease kubernetes/creds/breakglass/1"))
+			Expect(revoked).To(Equal([]string{"kubernetes/creds/breakglass/1"}))
+			Expect(revokedIn).To(Equal([]string{"team-a"}))
+			Expect(cacheFile).NotTo(BeAnExistingFile())
+		})
+
+		It("should keep the cached token when the lease cannot be revoked", func() {
+			_, err := get()
+			Expect(err).NotTo(HaveOccurred())
+			otherFile := cache.DefaultCacheFile("", "identity/oidc/token/other")
+			Expect(cache.New(otherFile).Save(createTestJWT(time.Now().Add(time.Hour).Unix()), time.Now().Add(time.Hour).Unix())).To(Succeed())
+
+			GinkgoT().Setenv("VAULT_ADDR", "")
+			buf, err := executeCommand("cache", "clear", "--all")
+			Expect(err).To(MatchError(ContainSubstring("kept 1 cached token(s) whose lease could not be revoked")))
+			Expect(err).To(MatchError(ContainSubstring("failed to revoke the lease kubernetes/creds/breakglass/1")))
+			Expect(err).To(MatchError(ContainSubstring("VAULT_ADDR is required")))
+
+			// The other tokens are still removed.
+			Expect(buf.String()).To(ContainSubstring("Removed " + otherFile))
+			Expect(otherFile).NotTo(BeAnExistingFile())
+			Expect(cache.DefaultCacheFile("", "kubernetes/creds/breakglass")).To(BeAnExistingFile())
+		})
+
+		It("should revoke the lease in the namespace of the cached token", func() {
+			_, err := executeCommand(
+				"get",
+				"--vault-addr", server.URL,
+				"--namespace", "team-a",
+				"--kubernetes-creds-role", "kubernetes/creds/breakglass",
+				"--kubernetes-creds-namespace", "default",
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = executeCommand("cache", "clear", "--all", "--vault-addr", server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(revoked).To(Equal([]string{"kubernetes/creds/breakglass/1"}))
+			Expect(revokedIn).To(Equal([]string{"team-a"}))
+			Expect(cache.DefaultCacheFile("team-a", "kubernetes/creds/breakglass")).NotTo(BeAnExistingFile())
+		})
+
+		It("should revoke the lease of a token fetched by token inspect", func() {
+			buf, err := executeCommand("token", "inspect", "--fetch", "--vault-addr", server.URL,
+				"--kubernetes-creds-role", "kubernetes/creds/breakglass", "--kubernetes-creds-namespace", "default")
+			// The test server has no OIDC provider to verify the token with.
+			Expect(err).To(MatchError(ContainSubstring("token failed verification")))
+			Expect(buf.String()).To(ContainSubstring("Revoked lease kubernetes/creds/breakglass/1"))
+			Expect(issued).To(Equal(1))
+			Expect(revoked).To(Equal([]string{"kubernetes/creds/breakglass/1"}))
+		})
+
+		It("should reject --pki-role", func() {
+			_, err := executeCommand("get", "--vault-addr", server.URL,
+				"--kubernetes-creds-role", "kubernetes/creds/breakglass", "--pki-role", "pki/issue/kubernetes")
+			Expect(err).To(MatchError(ContainSubstring("cannot be used together")))
+		})
+	})
+
+	Describe("Get Command with --source", func() {
+		var tmpDir string
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "cmd-source-test")
+			Expect(err).NotTo(HaveOccurred())
+			GinkgoT().Setenv("HOME", tmpDir)
+			GinkgoT().Setenv("VAULT_TOKEN", "")
+
+			exp := time.Now().Add(time.Hour).Unix()
+			*fakeSource = sourcetest.Fake{
+				Key:        "fake/creds",
+				Credential: &source.Credential{Token: createTestJWT(exp), Exp: exp},
+			}
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		// The fake source never calls Vault.
+		get := func(args ...string) (*bytes.Buffer, error) {
+			return executeCommand(append([]string{"get", "--vault-addr", "http://127.0.0.1:1"}, args...)...)
+		}
+
+		It("should return and cache the credential of the selected source", func() {
+			buf, err := get("--source", "fake")
+			Expect(err).NotTo(HaveOccurred())
+
+			var cred credential.ExecCredential
+			Expect(json.Unmarshal(buf.Bytes(), &cred)).To(Succeed())
+			Expect(cred.Status.Token).To(Equal(fakeSource.Credential.Token))
+
+			entry, err := cache.New(cache.DefaultCacheFile("", "fake/creds")).Read()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entry.TokenPath).To(Equal("fake/creds"))
+
+			_, err = get("--source", "fake")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeSource.Fetches).To(Equal(1))
+		})
+
+		It("should return client certificates", func() {
+			fakeSource.Credential = &source.Credential{ClientCertificate: "cert", ClientKey: "key", Exp: fakeSource.Credential.Exp}
+			buf, err := get("--source", "fake", "--no-cache")
+			Expect(err).NotTo(HaveOccurred())
+
+			var cred credential.ExecCredential
+			Expect(json.Unmarshal(buf.Bytes(), &cred)).To(Succeed())
+			Expect(cred.Status.ClientCertificateData).To(Equal("cert"))
+			Expect(cred.Status.ClientKeyData).To(Equal("key"))
+		})
+
+		It("should return the errors of the source", func() {
+			fakeSource.Err = fmt.Errorf("source failure")
+			_, err := get("--source", "fake")
+			Expect(err).To(MatchError("source failure"))
+		})
+
+		It("should select the source of the profile", func() {
+			configFile := filepath.Join(tmpDir, "config.yaml")
+			Expect(os.WriteFile(configFile, []byte("profiles:\n  fake:\n    source: fake\n"), 0600)).To(Succeed())
+
+			_, err := get("--config", configFile, "--profile", "fake")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeSource.Fetches).To(Equal(1))
+		})
+
+		It("should reject unknown sources", func() {
+			_, err := get("--source", "unknown")
+			Expect(err).To(MatchError(ContainSubstring(`unknown source "unknown"`)))
+		})
+	})
+
+	Describe("Get Command with --kv-path", func() {
+		var (
+			server *httptest.Server
+			tmpDir string
+			token  string
+			reads  int
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "cmd-kv-test")
+			Expect(err).NotTo(HaveOccurred())
+			GinkgoT().Setenv("HOME", tmpDir)
+			GinkgoT().Setenv("VAULT_TOKEN", "")
+			token, reads = "static-token", 0
+
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case "/v1/sys/internal/ui/mounts/secret/clusters/legacy":
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+						"path": "secret/", "type": "kv", "options": map[string]interface{}{"version": "2"},
+					}})
+				case "/v1/secret/data/clusters/legacy":
+					reads++
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+						"data":     map[string]interface{}{"token": token},
+						"metadata": map[string]interface{}{"version": 1},
+					}})
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		get := func(args ...string) (*credential.ExecCredential, error) {
+			buf, err := executeCommand(append([]string{"get", "--vault-addr", server.URL, "--kv-path", "secret/clusters/legacy"}, args...)...)
+			if err != nil {
+				return nil, err
+			}
+			var cred credential.ExecCredential
+			Expect(json.Unmarshal(buf.Bytes(), &cred)).To(Succeed())
+			return &cred, nil
+		}
+
+		It("should return the token and cache it for --kv-ttl", func() {
+			cred, err := get("--kv-ttl", "2h")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cred.Status.Token).To(Equal("static-token"))
+			exp, err := time.Parse(time.RFC3339, cred.Status.ExpirationTimestamp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(time.Until(exp)).To(BeNumerically("~", 2*time.Hour, 5*time.Second))
+
+			_, err = get("--kv-ttl", "2h")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reads).To(Equal(1))
+		})
+
+		It("should not cache a token beyond its exp claim", func() {
+			exp := time.Now().Add(10 * time.Minute).Unix()
+			token = createTestJWT(exp)
+			cred, err := get()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cred.Status.ExpirationTimestamp).To(Equal(time.Unix(exp, 0).UTC().Format(time.RFC3339)))
+		})
+
+		It("should fail when the field is missing", func() {
+			_, err := get("--kv-field", "admin")
+			Expect(err).To(MatchError(ContainSubstring(`no "admin" field in the secret at secret/clusters/legacy`)))
+		})
+	})
+
+	Describe("Agent Command", func() {
+		var (
+			server *httptest.Server
+			tmpDir string
+			socket string
+			cancel context.CancelFunc
+			done   chan error
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "cmd-agent-test")
+			Expect(err).NotTo(HaveOccurred())
+			GinkgoT().Setenv("HOME", tmpDir)
+			GinkgoT().Setenv("VAULT_TOKEN", "")
+			socket = filepath.Join(tmpDir, ".kube", "vault_agent.sock")
+
+			exp := time.Now().Add(time.Hour).Unix()
+			*fakeSource = sourcetest.Fake{
+				Key:        "fake/creds",
+				Credential: &source.Credential{Token: createTestJWT(exp), Exp: exp},
+			}
+
+			// The fake source never calls Vault, which only looks up the Vault
+			// token.
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal("/v1/auth/token/lookup-self"))
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+					"expire_time": nil, "creation_ttl": 0, "renewable": false,
+				}})
+			}))
+
+			agentCmd := cmd.NewRootCmd()
+			agentCmd.SetOut(io.Discard)
+			agentCmd.SetErr(io.Discard)
+			agentCmd.SetArgs([]string{"agent", "--vault-addr", server.URL})
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			done = make(chan error, 1)
+			go func() { done <- agentCmd.ExecuteContext(ctx) }()
+			Eventually(socket).Should(BeAnExistingFile())
+		})
+
+		AfterEach(func() {
+			cancel()
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(socket).NotTo(BeAnExistingFile())
+			server.Close()
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		get := func(args ...string) (*credential.ExecCredential, string) {
+			buf, err := executeCommand(append([]string{"get", "--vault-addr", server.URL, "--source", "fake"}, args...)...)
+			Expect(err).NotTo(HaveOccurred())
+			output := buf.String()
+			var cred credential.ExecCredential
+			Expect(json.Unmarshal([]byte(output[strings.Index(output, "{"):]), &cred)).To(Succeed())
+			return &cred, output
+		}
+
+		It("should serve credentials from memory", func() {
+			for i := 0; i < 2; i++ {
+				cred, _ := get()
+				Expect(cred.Status.Token).To(Equal(fakeSource.Credential.Token))
+			}
+			Expect(fakeSource.Fetches).To(Equal(1))
+			Expect(cache.DefaultCacheFile("", "fake/creds")).NotTo(BeAnExistingFile())
+		})
+
+		It("should not be used with --no-agent", func() {
+			get()
+			get("--no-agent")
+			Expect(fakeSource.Fetches).To(Equal(2))
+			Expect(cache.DefaultCacheFile("", "fake/creds")).To(BeAnExistingFile())
+		})
+
+		It("should fall back to getting the credential without the agent", func() {
+			cred, output := get("--namespace", "team-a")
+			Expect(output).To(ContainSubstring("warning: the agent at " + socket + " failed"))
+			Expect(output).To(ContainSubstring("not " + server.URL + " (namespace team-a)"))
+			Expect(cred.Status.Token).To(Equal(fakeSource.Credential.Token))
+			Expect(cache.DefaultCacheFile("team-a", "fake/creds")).To(BeAnExistingFile())
+		})
+
+		It("should pick up the Vault token of a later vault login", func() {
+			// The credential is due for a refresh, so each get fetches it.
+			fakeSource.Credential.Exp = time.Now().Add(10 * time.Second).Unix()
+			get()
+			Expect(os.WriteFile(filepath.Join(tmpDir, ".vault-token"), []byte("hvs.new\n"), 0600)).To(Succeed())
+			get()
+			Expect(fakeSource.VaultTokens).To(Equal([]string{"", "hvs.new"}))
+		})
+
+		It("should refuse to start twice", func() {
+			_, err := executeCommand("agent", "--vault-addr", server.URL)
+			Expect(err).To(MatchError(ContainSubstring("an agent is already listening on " + socket)))
+		})
+	})
+
+	Describe("Get Command with a stale agent socket", func() {
+		var tmpDir string
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "cmd-stale-agent-test")
+			Expect(err).NotTo(HaveOccurred())
+			GinkgoT().Setenv("HOME", tmpDir)
+			GinkgoT().Setenv("VAULT_TOKEN", "")
+
+			exp := time.Now().Add(time.Hour).Unix()
+			*fakeSource = sourcetest.Fake{
+				Key:        "fake/creds",
+				Credential: &source.Credential{Token: createTestJWT(exp), Exp: exp},
+			}
+
+			// An agent that did not shut down cleanly leaves its socket.
+			socket := filepath.Join(tmpDir, ".kube", "vault_agent.sock")
+			Expect(os.MkdirAll(filepath.Dir(socket), 0700)).To(Succeed())
+			l, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+			Expect(err).NotTo(HaveOccurred())
+			l.SetUnlinkOnClose(false)
+			Expect(l.Close()).To(Succeed())
+			Expect(socket).To(BeAnExistingFile())
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("should get the credential without a warning", func() {
+			buf, err := executeCommand("get", "--vault-addr", "http://127.0.0.1:1", "--source", "fake")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).NotTo(ContainSubstring("warning"))
+			Expect(fakeSource.Fetches).To(Equal(1))
+		})
+	})
+
+	Describe("Get Command with AppRole auth", func() {
+		var (
+			server     *httptest.Server
+			tmpDir     string
+			loginCount int
+			tokenCount int
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "cmd-approle-test")
+			Expect(err).NotTo(HaveOccurred())
+			GinkgoT().Setenv("HOME", tmpDir)
+			GinkgoT().Setenv("VAULT_TOKEN", "")
+
+			loginCount, tokenCount = 0, 0
+			testToken := createTestJWT(time.Now().Add(time.Hour).Unix())
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v1/auth/approle/login":
+					loginCount++
+					writeAuthResponse(w, "hvs.approle", 3600)
+				case "/v1/identity/oidc/token/test":
+					if r.Header.Get("X-Vault-Token") != "hvs.approle" {
+						w.WriteHeader(http.StatusForbidden)
+						return
+					}
+					tokenCount++
+					writeVaultResponse(w, vault.OIDCTokenResponse{
+						Data: vault.OIDCTokenData{Token: testToken},
+					})
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("should log in once and reuse the cached Vault token", func() {
+			GinkgoT().Setenv("VAULT_ROLE_ID", "my-role")
+			secretFile := filepath.Join(tmpDir, "secret-id")
+			Expect(os.WriteFile(secretFile, []byte("my-secret\n"), 0600)).To(Succeed())
+
+			cacheFile := filepath.Join(tmpDir, "cache.json")
+			args := []string{
+				"get",
+				"--vault-addr", server.URL,
+				"--token-path", "identity/oidc/token/test",
+				"--cache-file", cacheFile,
+				"--auth-method", "approle",
+				"--secret-id-file", secretFile,
+			}
+
+			_, err := executeCommand(args...)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.Remove(cacheFile)).To(Succeed())
+			_, err = executeCommand(args...)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(loginCount).To(Equal(1))
+			Expect(tokenCount).To(Equal(2))
+		})
+
+		It("should require a role_id", func() {
+			_, err := executeCommand(
+				"get",
+				"--vault-addr", server.URL,
+				"--token-path", "identity/oidc/token/test",
+				"--cache-file", filepath.Join(tmpDir, "cache.json"),
+				"--auth-method", "approle",
+			)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("role_id"))
+		})
+
+		It("should log in with the Kubernetes auth method", func() {
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v1/auth/kubernetes/login":
+					loginCount++
+					writeAuthResponse(w, "hvs.k8s", 3600)
+				case "/v1/identity/oidc/token/test":
+					Expect(r.Header.Get("X-Vault-Token")).To(Equal("hvs.k8s"))
+					writeVaultResponse(w, vault.OIDCTokenResponse{
+						Data: vault.OIDCTokenData{Token: createTestJWT(time.Now().Add(time.Hour).Unix())},
+					})
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			})
+
+			saToken := filepath.Join(tmpDir, "sa-token")
+			Expect(os.WriteFile(saToken, []byte("sa-jwt"), 0600)).To(Succeed())
+
+			_, err := executeCommand(
+				"get",
+				"--vault-addr", server.URL,
+				"--token-path", "identity/oidc/token/test",
+				"--cache-file", filepath.Join(tmpDir, "cache.json"),
+				"--auth-method", "kubernetes",
+				"--kubernetes-role", "fleet",
+				"--service-account-token-path", saToken,
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loginCount).To(Equal(1))
+		})
+
+		It("should reject an unknown auth method", func() {
+			_, err := executeCommand(
+				"get",
+				"--vault-addr", server.URL,
+				"--token-path", "identity/oidc/token/test",
+				"--no-cache",
+				"--auth-method", "userpass",
+			)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unsupported auth method"))
+		})
+	})
+
+	Describe("OIDC login", func() {
+		var (
+			server *httptest.Server
+			tmpDir string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "cmd-oidc-test")
+			Expect(err).NotTo(HaveOccurred())
+			GinkgoT().Setenv("HOME", tmpDir)
+			GinkgoT().Setenv("VAULT_TOKEN", "")
+
+			testToken := createTestJWT(time.Now().Add(time.Hour).Unix())
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v1/auth/oidc/oidc/auth_url":
+					var body map[string]string
+					Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+					// Simulate the user completing the login in the browser.
+					go func() {
+						resp, err := http.Get(body["redirect_uri"] + "?code=abc&state=st")
+						if err == nil {
+							_ = resp.Body.Close()
+						}
+					}()
+					w.Header().Set("Content-Type", "application/json")
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{
+						"data": map[string]interface{}{"auth_url": "https://idp.example.com/authorize"},
+					})
+				case "/v1/auth/oidc/oidc/callback":
+					writeAuthResponse(w, "hvs.oidc", 3600)
+				case "/v1/identity/oidc/token/test":
+					if r.Header.Get("X-Vault-Token") != "hvs.oidc" {
+						w.WriteHeader(http.StatusForbidden)
+						return
+					}
+					writeVaultResponse(w, vault.OIDCTokenResponse{
+						Data: vault.OIDCTokenData{Token: testToken},
+					})
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("should save the Vault token with the login command", func() {
+			buf, err := executeCommand(
+				"login",
+				"--vault-addr", server.URL,
+				"--oidc-listen-address", "127.0.0.1:0",
+				"--no-browser",
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("https://idp.example.com/authorize"))
+
+			data, err := os.ReadFile(filepath.Join(tmpDir, ".vault-token"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("hvs.oidc"))
+		})
+
+		It("should require VAULT_ADDR for the login command", func() {
+			GinkgoT().Setenv("VAULT_ADDR", "")
+			_, err := executeCommand("login")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should log in from get when running interactively", func() {
+			GinkgoT().Setenv("KUBERNETES_EXEC_INFO", `{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","spec":{"interactive":true}}`)
+
+			_, err := executeCommand(
+				"get",
+				"--vault-addr", server.URL,
+				"--token-path", "identity/oidc/token/test",
+				"--cache-file", filepath.Join(tmpDir, "cache.json"),
+				"--oidc-login",
+				"--oidc-listen-address", "127.0.0.1:0",
+				"--no-browser",
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = os.Stat(filepath.Join(tmpDir, ".vault-token"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should not start a browser login when not interactive", func() {
+			_, err := executeCommand(
+				"get",
+				"--vault-addr", server.URL,
+				"--token-path", "identity/oidc/token/test",
+				"--cache-file", filepath.Join(tmpDir, "cache.json"),
+				"--oidc-login",
+			)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("kubectl auth-vault login"))
+		})
+	})
+
+	Describe("Vault token renewal", func() {
+		var (
+			server    *httptest.Server
+			tmpDir    string
+			lookup    map[string]interface{}
+			denied    bool
+			renewed   atomic.Int32
+			cacheFile string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "cmd-renew-test")
+			Expect(err).NotTo(HaveOccurred())
+			GinkgoT().Setenv("HOME", tmpDir)
+			GinkgoT().Setenv("VAULT_TOKEN", "hvs.user")
+			cacheFile = filepath.Join(tmpDir, "cache.json")
+			denied = false
+			renewed.Store(0)
+
+			testToken := createTestJWT(time.Now().Add(time.Hour).Unix())
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v1/auth/token/lookup-self":
+					if lookup == nil {
+						w.WriteHeader(http.StatusForbidden)
+						return
+					}
+					w.Header().Set("Content-Type", "application/json")
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": lookup})
+				case "/v1/auth/token/renew-self":
+					renewed.Add(1)
+					writeAuthResponse(w, "hvs.user", 3600)
+				case "/v1/identity/oidc/token/test":
+					if denied {
+						w.WriteHeader(http.StatusForbidden)
+						return
+					}
+					writeVaultResponse(w, vault.OIDCTokenResponse{
+						Data: vault.OIDCTokenData{Token: testToken},
+					})
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		get := func() (*bytes.Buffer, error) {
+			return executeCommand(
+				"get",
+				"--vault-addr", server.URL,
+				"--token-path", "identity/oidc/token/test",
+				"--cache-file", cacheFile,
+			)
+		}
+
+		It("should renew a renewable token close to its expiry", func() {
+			lookup = map[string]interface{}{
+				"expire_time":  time.Now().Add(2 * time.Minute).Format(time.RFC3339),
+				"creation_ttl": 3600,
+				"renewable":    true,
+			}
+			_, err := get()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(renewed.Load()).To(Equal(int32(1)))
+
+			expireTime, err := cache.NewVaultTokenExpiry(cache.DefaultVaultTokenExpiryFile()).Load("hvs.user")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(time.Until(expireTime)).To(BeNumerically(">", 50*time.Minute))
+		})
+
+		It("should not renew a fresh token", func() {
+			lookup = map[string]interface{}{
+				"expire_time":  time.Now().Add(50 * time.Minute).Format(time.RFC3339),
+				"creation_ttl": 3600,
+				"renewable":    true,
+			}
+			_, err := get()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(renewed.Load()).To(BeZero())
+		})
+
+		It("should warn about a token that cannot be renewed", func() {
+			lookup = map[string]interface{}{
+				"expire_time":  time.Now().Add(2 * time.Minute).Format(time.RFC3339),
+				"creation_ttl": 3600,
+				"renewable":    false,
+			}
+			buf, err := get()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("cannot be renewed, run `vault login`"))
+			Expect(renewed.Load()).To(BeZero())
+		})
+
+		It("should report when the token expired", func() {
+			expiredAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+			Expect(cache.NewVaultTokenExpiry(cache.DefaultVaultTokenExpiryFile()).Save("hvs.user", expiredAt)).To(Succeed())
+			lookup = nil
+
+			_, err := get()
+			Expect(err).To(MatchError(ContainSubstring(
+				"your Vault token expired at " + expiredAt.Local().Format(time.RFC3339) + ", run `vault login`")))
+		})
+
+		It("should get the token with a warning when the token cannot look itself up", func() {
+			lookup = nil
+
+			buf, err := get()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("warning: failed to look up vault token"))
+			Expect(buf.String()).To(ContainSubstring(`"kind":"ExecCredential"`))
+		})
+
+		It("should not report an expiry in the future when the token cannot look itself up", func() {
+			Expect(cache.NewVaultTokenExpiry(cache.DefaultVaultTokenExpiryFile()).Save("hvs.user", time.Now().Add(time.Hour))).To(Succeed())
+			lookup = nil
+
+			_, err := get()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should report an invalid token when Vault also denies the request", func() {
+			lookup = nil
+			denied = true
+
+			_, err := get()
+			Expect(err).To(MatchError(ContainSubstring("your Vault token may be expired or invalid, run `vault login`")))
+		})
+
+		It("should not blame a valid token for a denied request", func() {
+			lookup = map[string]interface{}{
+				"expire_time":  time.Now().Add(50 * time.Minute).Format(time.RFC3339),
+				"creation_ttl": 3600,
+				"renewable":    true,
+			}
+			denied = true
+
+			_, err := get()
+			Expect(vault.IsPermissionDenied(err)).To(BeTrue())
+			Expect(err).NotTo(MatchError(ContainSubstring("your Vault token")))
+		})
+	})
+
+	Describe("Profiles", func() {
+		var (
+			server     *httptest.Server
+			tmpDir     string
+			configFile string
+			requests   []string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "cmd-profile-test")
+			Expect(err).NotTo(HaveOccurred())
+			GinkgoT().Setenv("HOME", tmpDir)
+			GinkgoT().Setenv("VAULT_ADDR", "")
+			GinkgoT().Setenv("VAULT_NAMESPACE", "")
+			GinkgoT().Setenv("KUBECTL_AUTH_VAULT_PROFILE", "")
+
+			requests = nil
+			testToken := createTestJWT(time.Now().Add(time.Hour).Unix())
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, r.Header.Get("X-Vault-Namespace")+" "+r.URL.Path)
+				writeVaultResponse(w, vault.OIDCTokenResponse{
+					Data: vault.OIDCTokenData{Token: testToken},
+				})
+			}))
+
+			configFile = filepath.Join(tmpDir, "config.yaml")
+			Expect(os.WriteFile(configFile, []byte(`profiles:
+  prod:
+    vault-addr: `+server.URL+`
+    namespace: team-a
+    token-path: identity/oidc/token/prod
+    cache:
+      disabled: true
+`), 0600)).To(Succeed())
+			GinkgoT().Setenv("KUBECTL_AUTH_VAULT_CONFIG", configFile)
+		})
+
+		AfterEach(func() {
+			server.Close()
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("should use the settings of the profile", func() {
+			_, err := executeCommand("get", "--profile", "prod")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests).To(Equal([]string{"team-a /v1/identity/oidc/token/prod"}))
+			_, err = os.Stat(filepath.Join(tmpDir, ".kube"))
+			Expect(os.IsNotExist(err)).To(BeTrue(), "profile disables the cache")
+		})
+
+		It("should select the profile from KUBECTL_AUTH_VAULT_PROFILE", func() {
+			GinkgoT().Setenv("KUBECTL_AUTH_VAULT_PROFILE", "prod")
+			_, err := executeCommand("get")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests).To(HaveLen(1))
+		})
+
+		It("should prefer flags over env and env over the profile", func() {
+			GinkgoT().Setenv("VAULT_NAMESPACE", "team-b")
+			_, err := executeCommand("get", "--profile", "prod")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = executeCommand("get", "--profile", "prod", "--namespace", "team-c", "--token-path", "identity/oidc/token/other")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(requests).To(Equal([]string{
+				"team-b /v1/identity/oidc/token/prod",
+				"team-c /v1/identity/oidc/token/other",
+			}))
+		})
+
+		It("should reject an unknown profile", func() {
+			_, err := executeCommand("get", "--profile", "staging")
+			Expect(err).To(MatchError(ContainSubstring(`profile "staging" not found`)))
+		})
+
+		It("should reject an invalid profile value", func() {
+			Expect(os.WriteFile(configFile, []byte("profiles:\n  prod:\n    cache:\n      refresh-before: soon\n"), 0600)).To(Succeed())
+			_, err := executeCommand("get", "--profile", "prod")
+			Expect(err).To(MatchError(ContainSubstring("refresh-before")))
+		})
+
+		It("should reference the profile in the kubeconfig example", func() {
+			buf, err := executeCommand("config", "show", "--profile", "prod")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("Namespace:     team-a"))
+			Expect(buf.String()).To(MatchRegexp(`- --profile\s+- prod\n`))
+			Expect(buf.String()).NotTo(ContainSubstring("- name: VAULT_ADDR"))
+			Expect(buf.String()).NotTo(ContainSubstring("- --token-path"))
+		})
+
+		It("should test the profile with config test", func() {
+			buf, err := executeCommand("config", "test", "--profile", "prod")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("Profile:       prod"))
+			Expect(requests).To(Equal([]string{"team-a /v1/identity/oidc/token/prod"}))
+		})
+	})
+
+	Describe("Kubeconfig Install Command", func() {
+		var (
+			tmpDir         string
+			kubeconfigFile string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "cmd-kubeconfig-test")
+			Expect(err).NotTo(HaveOccurred())
+			GinkgoT().Setenv("VAULT_ADDR", "")
+			GinkgoT().Setenv("VAULT_NAMESPACE", "")
+			GinkgoT().Setenv("KUBECTL_AUTH_VAULT_PROFILE", "")
+
+			kubeconfigFile = filepath.Join(tmpDir, "config")
+			Expect(os.WriteFile(kubeconfigFile, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: prod-cluster
+  cluster:
+    server: https://prod.example.com
+contexts:
+- name: prod
+  context:
+    cluster: prod-cluster
+    user: admin
+users:
+- name: admin
+  user:
+    token: abc
+`), 0600)).To(Succeed())
+			GinkgoT().Setenv("KUBECONFIG", kubeconfigFile)
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("should add the user and bind it to contexts and clusters", func() {
+			buf, err := executeCommand("kubeconfig", "install",
+				"--vault-addr", "https://vault.example.com",
+				"--token-path", "identity/oidc/token/test",
+				"--context", "prod",
+				"--cluster", "prod-cluster",
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("Updated " + kubeconfigFile))
+
+			data, err := os.ReadFile(kubeconfigFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(ContainSubstring("token: abc"))
+			Expect(string(data)).To(MatchRegexp(`- name: prod\s+context:\s+cluster: prod-cluster\s+user: vault-user\n`))
+			Expect(string(data)).To(MatchRegexp(`- name: vault-user@prod-cluster\s+context:\s+cluster: prod-cluster\s+user: vault-user\n`))
+			Expect(string(data)).To(MatchRegexp(`- name: VAULT_ADDR\s+value: https://vault.example.com\n`))
+			Expect(string(data)).To(MatchRegexp(`- get\s+- --token-path\s+- identity/oidc/token/test\n`))
+
+			buf, err = executeCommand("kubeconfig", "install",
+				"--vault-addr", "https://vault.example.com",
+				"--token-path", "identity/oidc/token/test",
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("Kubeconfig is up to date"))
+		})
+
+		It("should install the get flags that were set", func() {
+			_, err := executeCommand("kubeconfig", "install",
+				"--vault-addr", "https://vault.example.com",
+				"--token-path", "identity/oidc/token/test",
+				"--auth-method", "approle",
+				"--approle-mount", "ci",
+				"--secret-id", "s3cr3t",
+				"--oidc-login",
+				"--verify",
+				"--refresh-before", "5m",
+				"--max-retries", "0",
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			data, err := os.ReadFile(kubeconfigFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(MatchRegexp(`- get\s+- --token-path\s+- identity/oidc/token/test\s+- --approle-mount\s+- ci\s+- --auth-method\s+- approle\s+- --max-retries\s+- "0"\s+- --oidc-login\s+- --refresh-before\s+- 5m0s\s+- --verify\n`))
+			Expect(string(data)).To(ContainSubstring("interactiveMode: IfAvailable"))
+			Expect(string(data)).NotTo(ContainSubstring("s3cr3t"))
+		})
+
+		It("should not install a token path for other sources", func() {
+			_, err := executeCommand("kubeconfig", "install",
+				"--vault-addr", "https://vault.example.com",
+				"--pki-role", "pki/issue/kubernetes",
+				"--pki-common-name", "jane",
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			data, err := os.ReadFile(kubeconfigFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(MatchRegexp(`- get\s+- --pki-common-name\s+- jane\s+- --pki-role\s+- pki/issue/kubernetes\n`))
+			Expect(string(data)).NotTo(ContainSubstring("--token-path"))
+			Expect(string(data)).To(ContainSubstring("interactiveMode: Never"))
+		})
+
+		It("should print a diff without writing with --dry-run", func() {
+			buf, err := executeCommand("kubeconfig", "install",
+				"--vault-addr", "https://vault.example.com",
+				"--user", "vault-prod",
+				"--dry-run",
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(HavePrefix("--- " + kubeconfigFile + "\n+++ " + kubeconfigFile + "\n"))
+			Expect(buf.String()).To(ContainSubstring("+  - name: vault-prod\n"))
+
+			data, err := os.ReadFile(kubeconfigFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).NotTo(ContainSubstring("vault-prod"))
+		})
+
+		It("should require a Vault address", func() {
+			_, err := executeCommand("kubeconfig", "install")
+			Expect(err).To(MatchError(ContainSubstring("VAULT_ADDR is required")))
+		})
+
+		It("should reject an unknown context", func() {
+			_, err := executeCommand("kubeconfig", "install", "--vault-addr", "https://vault.example.com", "--context", "staging")
+			Expect(err).To(MatchError(ContainSubstring(`context "staging" not found`)))
+		})
+	})
+
+	Describe("Cache Commands", func() {
+		var (
+			tmpDir    string
+			validFile string
+			oldFile   string
+			badFile   string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "cmd-cache-test")
+			Expect(err).NotTo(HaveOccurred())
+			GinkgoT().Setenv("HOME", tmpDir)
+			GinkgoT().Setenv("VAULT_NAMESPACE", "")
+			GinkgoT().Setenv("KUBECTL_AUTH_VAULT_PROFILE", "")
+
+			exp := time.Now().Add(time.Hour).Unix()
+			validFile = cache.DefaultCacheFile("team-a", "identity/oidc/token/valid")
+			Expect(cache.New(validFile).SaveEntry(&cache.TokenCache{
+				Token:     createTestJWT(exp),
+				Exp:       exp,
+				TokenPath: "identity/oidc/token/valid",
+				Namespace: "team-a",
+			})).To(Succeed())
+
+			oldFile = cache.DefaultCacheFile("", "identity/oidc/token/old")
+			Expect(cache.New(oldFile).Save(createTestJWT(time.Now().Add(-time.Hour).Unix()), time.Now().Add(-time.Hour).Unix())).To(Succeed())
+
+			badFile = cache.DefaultCacheFile("", "identity/oidc/token/bad")
+			Expect(os.WriteFile(badFile, []byte("{"), 0600)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("should list the cached tokens", func() {
+			buf, err := executeCommand("cache", "list")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(MatchRegexp(`FILE\s+NAMESPACE\s+TOKEN PATH\s+SUBJECT\s+ISSUED AT\s+REMAINING\n`))
+			Expect(buf.String()).To(MatchRegexp(regexp.QuoteMeta(validFile) + `\s+team-a\s+identity/oidc/token/valid\s+test\s+\S+\s+(59m|1h0m)`))
+			Expect(buf.String()).To(MatchRegexp(regexp.QuoteMeta(oldFile) + `\s+-\s+-\s+test\s+\S+\s+expired\n`))
+			Expect(buf.String()).To(MatchRegexp(regexp.QuoteMeta(badFile) + `(\s+-){4}\s+unparsable\n`))
+
+			_, err = os.Stat(badFile)
+			Expect(err).NotTo(HaveOccurred(), "list must not remove unparsable files")
+		})
+
+		It("should remove expired and unparsable tokens with prune", func() {
+			buf, err := executeCommand("cache", "prune")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("Removed " + oldFile + " (expired)"))
+			Expect(buf.String()).To(ContainSubstring("Removed " + badFile + " (unparsable)"))
+			Expect(buf.String()).To(ContainSubstring("Pruned 2 cached token(s)"))
+
+			caches, err := cache.List()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(caches).To(HaveLen(1))
+			Expect(caches[0].FilePath()).To(Equal(validFile))
+		})
+
+		It("should clear the token of a token path", func() {
+			buf, err := executeCommand("cache", "clear", "--token-path", "identity/oidc/token/valid", "--namespace", "team-a")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("Removed " + validFile))
+			_, err = os.Stat(validFile)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+
+			buf, err = executeCommand("cache", "clear", "--token-path", "identity/oidc/token/valid", "--namespace", "team-a")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("No cached token"))
+		})
+
+		It("should clear all tokens and the cached Vault tokens, keeping the lock files", func() {
+			Expect(os.WriteFile(validFile+".lock", nil, 0600)).To(Succeed())
+			authFile := cache.DefaultAuthCacheFile("http://127.0.0.1:8200", "", "approle", "role")
+			Expect(cache.New(authFile).Save("hvs.token", time.Now().Add(time.Hour).Unix())).To(Succeed())
+
+			buf, err := executeCommand("cache", "clear", "--all")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("Removed " + authFile))
+
+			caches, err := cache.List()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(caches).To(BeEmpty())
+			Expect(validFile + ".lock").To(BeAnExistingFile())
+			Expect(authFile).NotTo(BeAnExistingFile())
+		})
+
+		It("should clear the credential of the source of a profile", func() {
+			GinkgoT().Setenv("KUBECTL_AUTH_VAULT_CONFIG", filepath.Join(tmpDir, "config.yaml"))
+			Expect(os.WriteFile(filepath.Join(tmpDir, "config.yaml"), []byte(`profiles:
+  pk:
+    namespace: team-a
+    token-path: identity/oidc/token/valid
+    source: pki
+    pki-role: pki/issue/kubernetes
+`), 0600)).To(Succeed())
+			certPEM, keyPEM := createTestCertificate("jane", time.Now().Add(time.Hour))
+			certFile := cache.DefaultCacheFile("team-a", "pki/issue/kubernetes")
+			Expect(cache.New(certFile).SaveEntry(&cache.TokenCache{
+				ClientCertificate: certPEM,
+				ClientKey:         keyPEM,
+				Exp:               time.Now().Add(time.Hour).Unix(),
+			})).To(Succeed())
+
+			buf, err := executeCommand("cache", "clear", "--profile", "pk")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring("Removed " + certFile))
+			Expect(certFile).NotTo(BeAnExistingFile())
+			Expect(validFile).To(BeAnExistingFile())
+		})
+
+		It("should require a token to clear", func() {
+			_, err := executeCommand("cache", "clear")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Token Inspect Command", func() {
+		var (
+			tmpDir    string
+			testToken string
+			exp       int64
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "cmd-token-test")
+			Expect(err).NotTo(HaveOccurred())
+			GinkgoT().Setenv("HOME", tmpDir)
+			GinkgoT().Setenv("VAULT_ADDR", "")
+			GinkgoT().Setenv("VAULT_NAMESPACE", "")
+			GinkgoT().Setenv("KUBECTL_AUTH_VAULT_PROFILE", "")
+
+			exp = time.Now().Add(time.Hour).Unix()
+			header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"key-1"}`))
+			claims, _ := json.Marshal(map[string]interface{}{
+				"exp":       exp,
+				"iat":       time.Now().Unix(),
+				"sub":       "entity-1",
+				"aud":       "kubernetes",
+				"groups":    []string{"admins", "devs"},
+				"namespace": map[string]string{"id": "root"},
+			})
+			testToken = header + "." + base64.RawURLEncoding.EncodeToString(claims) + "." + base64.RawURLEncoding.EncodeToString([]byte("sig"))
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("should print the header, claims and lifetime of a token from stdin", func() {
+			buf, err := executeCommandWithInput(testToken+"\n", "token", "inspect", "-")
+			Expect(err).NotTo(HaveOccurred())
+			out := buf.String()
+			Expect(out).To(MatchRegexp(`kid\s+key-1\n`))
+			Expect(out).To(MatchRegexp(`groups\s+\["admins","devs"\]\n`))
+			Expect(out).To(MatchRegexp(`namespace\s+\{"id":"root"\}\n`))
+			Expect(out).To(MatchRegexp(fmt.Sprintf(`exp\s+%d \(%s\)\n`, exp, time.Unix(exp, 0).UTC().Format(time.RFC3339))))
+			Expect(out).To(MatchRegexp(`Remaining\s+(59m|1h0m)`))
+		})
+
+		It("should print the token as JSON", func() {
+			buf, err := executeCommandWithInput(testToken, "token", "inspect", "-", "-o", "json")
+			Expect(err).NotTo(HaveOccurred())
+
+			var out struct {
+				Header   map[string]string      `json:"header"`
+				Claims   map[string]interface{} `json:"claims"`
+				Lifetime map[string]interface{} `json:"lifetime"`
+			}
+			Expect(json.Unmarshal(buf.Bytes(), &out)).To(Succeed())
+			Expect(out.Header).To(Equal(map[string]string{"alg": "RS256", "kid": "key-1"}))
+			Expect(out.Claims).To(HaveKeyWithValue("sub", "entity-1"))
+			Expect(out.Claims).To(HaveKeyWithValue("exp", float64(exp)))
+			Expect(out.Lifetime).To(HaveKeyWithValue("expiresAt", time.Unix(exp, 0).UTC().Format(time.RFC3339)))
+			Expect(out.Lifetime).To(HaveKeyWithValue("expired", false))
+		})
+
+		It("should print numeric claims as YAML numbers", func() {
+			buf, err := executeCommandWithInput(testToken, "token", "inspect", "-", "-o", "yaml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring(fmt.Sprintf("  exp: %d\n", exp)))
+			Expect(buf.String()).To(ContainSubstring("  groups:\n    - admins\n"))
+		})
+
+		It("should read the token from the cache", func() {
+			cacheFile := cache.DefaultCacheFile("", "identity/oidc/token/test")
+			Expect(cache.New(cacheFile).Save(testToken, exp)).To(Succeed())
+
+			buf, err := executeCommand("token", "inspect", "--token-path", "identity/oidc/token/test")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(MatchRegexp(`sub\s+entity-1\n`))
+
+			_, err = executeCommand("token", "inspect", "--token-path", "identity/oidc/token/other")
+			Expect(err).To(MatchError(ContainSubstring("no cached token")))
+		})
+
+		It("should read the cached token of the source of a profile", func() {
+			GinkgoT().Setenv("KUBECTL_AUTH_VAULT_CONFIG", filepath.Join(tmpDir, "config.yaml"))
+			Expect(os.WriteFile(filepath.Join(tmpDir, "config.yaml"), []byte(`profiles:
+  legacy:
+    namespace: team-a
+    kv:
+      path: secret/clusters/legacy
+`), 0600)).To(Succeed())
+			Expect(cache.New(cache.DefaultCacheFile("team-a", "secret/clusters/legacy#token")).Save(testToken, exp)).To(Succeed())
+
+			buf, err := executeCommand("token", "inspect", "--profile", "legacy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(MatchRegexp(`sub\s+entity-1\n`))
+		})
+
+		It("should require a token path like get", func() {
+			Expect(cache.New(cache.DefaultCacheFile("", "identity/oidc/token/kubernetes")).Save(testToken, exp)).To(Succeed())
+
+			_, err := executeCommand("token", "inspect")
+			Expect(err).To(MatchError(ContainSubstring("--token-path")))
+		})
+
+		It("should fetch a new token from Vault with --fetch and verify it", func() {
+			key := newSigningKey()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if serveKeySet(w, r, key) {
+					return
+				}
+				writeVaultResponse(w, vault.OIDCTokenResponse{
+					Data: vault.OIDCTokenData{Token: signTestJWT(key, map[string]interface{}{
+						"iss": testIssuer, "aud": "kubernetes", "exp": exp,
+					})},
+				})
+			}))
+			defer server.Close()
+
+			buf, err := executeCommand("token", "inspect", "--vault-addr", server.URL, "--token-path", "identity/oidc/token/test", "--fetch")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(MatchRegexp(`aud\s+kubernetes\n`))
+			Expect(buf.String()).To(MatchRegexp(`Signature\s+verified with key test-key\n`))
+		})
+
+		It("should fail when the token does not verify", func() {
+			key := newSigningKey()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !serveKeySet(w, r, key) {
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			forged := signTestJWT(newSigningKey(), map[string]interface{}{"iss": testIssuer, "exp": exp})
+			buf, err := executeCommandWithInput(forged, "token", "inspect", "-", "--vault-addr", server.URL, "-o", "json")
+			Expect(err).To(MatchError(ContainSubstring("token failed verification")))
+			Expect(buf.String()).To(ContainSubstring(`"verified": false`))
+		})
+
+		It("should not verify without a Vault address", func() {
+			buf, err := executeCommandWithInput(testToken, "token", "inspect", "-")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(MatchRegexp(`Signature\s+not verified: VAULT_ADDR is not set\n`))
+		})
+
+		It("should reject an unsupported output format", func() {
+			_, err := executeCommandWithInput(testToken, "token", "inspect", "-", "-o", "xml")
+			Expect(err).To(MatchError(ContainSubstring("unsupported output format")))
+		})
+
+		It("should not accept the token as an argument", func() {
+			_, err := executeCommand("token", "inspect", testToken)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Config Test Command", func() {
+		Context("without VAULT_ADDR", func() {
+			BeforeEach(func() {
+				_ = os.Unsetenv("VAULT_ADDR")
+			})
+
+			It("should return an error", func() {
+				_, err := executeCommand("config", "test")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("with mock vault server", func() {
+			var server *httptest.Server
+
+			BeforeEach(func() {
+				exp := time.Now().Add(time.Hour).Unix()
+				testToken := createTestJWT(exp)
+
+				server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					writeVaultResponse(w, vault.OIDCTokenResponse{
+						Data: vault.OIDCTokenData{Token: testToken},
+					})
+				}))
+			})
+
+			AfterEach(func() {
+				server.Close()
+			})
+
+			It("should show success message", func() {
+				buf, err := executeCommand(
+					"config", "test",
+					"--vault-addr", server.URL,
+					"--token-path", "identity/oidc/token/test",
+				)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(buf.String()).To(ContainSubstring("Successfully"))
+			})
+		})
+
+		Context("with the flags of another source", func() {
+			var (
+				server   *httptest.Server
+				requests []string
+			)
+
+			BeforeEach(func() {
+				requests = nil
+				certPEM, keyPEM := createTestCertificate("jane", time.Now().Add(time.Hour))
+				server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					requests = append(requests, r.URL.Path)
+					w.Header().Set("Content-Type", "application/json")
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{
+						"data": map[string]interface{}{
+							"certificate": certPEM,
+							"private_key": keyPEM,
+						},
+					})
+				}))
+			})
+
+			AfterEach(func() {
+				server.Close()
+			})
+
+			It("should fetch the credential of that source", func() {
+				buf, err := executeCommand(
+					"config", "test",
+					"--vault-addr", server.URL,
+					"--pki-role", "pki/issue/kubernetes",
+				)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(buf.String()).To(ContainSubstring("Source:        pki"))
+				Expect(buf.String()).To(ContainSubstring("Successfully retrieved client certificate"))
+				Expect(buf.String()).To(ContainSubstring("CN=jane"))
+				Expect(requests).To(Equal([]string{"/v1/pki/issue/kubernetes"}))
+			})
+
+			It("should reject token verification options", func() {
+				_, err := executeCommand(
+					"config", "test",
+					"--vault-addr", server.URL,
+					"--pki-role", "pki/issue/kubernetes",
+					"--verify",
+				)
+				Expect(err).To(MatchError(ContainSubstring("cannot be used with the pki source")))
+				Expect(requests).To(BeEmpty())
+			})
+		})
+
+		Context("with --expected-audience", func() {
+			var server *httptest.Server
+
+			BeforeEach(func() {
+				token := signTestJWT(newSigningKey(), map[string]interface{}{"aud": "staging", "exp": time.Now().Add(time.Hour).Unix()})
+				server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					writeVaultResponse(w, vault.OIDCTokenResponse{
+						Data: vault.OIDCTokenData{Token: token},
+					})
+				}))
+			})
+
+			AfterEach(func() {
+				server.Close()
+			})
+
+			It("should fail for a token issued for another audience", func() {
+				buf, err := executeCommand(
+					"config", "test",
+					"--vault-addr", server.URL,
+					"--token-path", "identity/oidc/token/test",
+					"--expected-audience", "prod",
+				)
+				Expect(err).To(MatchError(ContainSubstring(`does not include "prod"`)))
+				Expect(buf.String()).To(ContainSubstring("Token failed verification"))
+			})
+		})
+
+		Context("with a TLS vault server", func() {
+			var (
+				server *httptest.Server
+				caFile string
+			)
+
+			BeforeEach(func() {
+				testToken := createTestJWT(time.Now().Add(time.Hour).Unix())
+				server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					writeVaultResponse(w, vault.OIDCTokenResponse{
+						Data: vault.OIDCTokenData{Token: testToken},
+					})
+				}))
+
+				caFile = filepath.Join(GinkgoT().TempDir(), "ca.pem")
+				Expect(os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				server.Close()
+			})
+
+			It("should validate the CA bundle and fetch a token", func() {
+				buf, err := executeCommand(
+					"config", "test",
+					"--vault-addr", server.URL,
+					"--ca-cert", caFile,
+				)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(buf.String()).To(ContainSubstring("TLS configuration is valid"))
+				Expect(buf.String()).To(ContainSubstring("Successfully"))
+			})
+
+			It("should report an invalid CA bundle before contacting Vault", func() {
+				buf, err := executeCommand(
+					"config", "test",
+					"--vault-addr", server.URL,
+					"--ca-cert", filepath.Join(filepath.Dir(caFile), "missing.pem"),
+				)
+				Expect(err).To(HaveOccurred())
+				Expect(buf.String()).To(ContainSubstring("Invalid TLS configuration"))
 			})
 		})
 
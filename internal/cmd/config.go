@@ -3,9 +3,15 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
+	"github.com/efortin/kubectl-auth-vault/internal/credential"
+	"github.com/efortin/kubectl-auth-vault/internal/kubeconfig"
+	"github.com/efortin/kubectl-auth-vault/internal/source"
 	"github.com/efortin/kubectl-auth-vault/internal/vault"
 )
 
@@ -14,9 +20,26 @@ func printf(cmd *cobra.Command, format string, args ...interface{}) {
 	cmd.Printf(format, args...)
 }
 
+// defaultTokenPath is the OIDC token path tested and installed when none is
+// given.
+const defaultTokenPath = "identity/oidc/token/kubernetes"
+
+// configOptions take the flags of get, so that the settings tested or shown
+// are the ones installed in the kubeconfig.
 type configOptions struct {
-	vaultAddr string
-	tokenPath string
+	get getOptions
+}
+
+func (o *configOptions) addFlags(fs *pflag.FlagSet) {
+	o.get.addFlags(fs)
+}
+
+// tokenPath returns the OIDC token path, defaulting to defaultTokenPath.
+func (o *configOptions) tokenPath() string {
+	if path := source.Settings(source.OIDCName, o.get.vault.flags)["token-path"]; path != "" {
+		return path
+	}
+	return defaultTokenPath
 }
 
 func addConfigCommand(rootCmd *cobra.Command) {
@@ -31,8 +54,9 @@ This is useful for validating your setup before using it in kubeconfig.`,
 	configTestCmd := &cobra.Command{
 		Use:   "test",
 		Short: "Test Vault connectivity and token retrieval",
-		Long: `Attempts to connect to Vault and fetch an OIDC token.
-Displays detailed information about the token on success.`,
+		Long: `Attempts to connect to Vault and fetch a credential from the source get
+would use, checking it with --verify and --expected-audience like get does.
+Displays detailed information about the credential on success.`,
 		Example: `  # Test with environment variable
   export VAULT_ADDR=https://vault.example.com
   kubectl-auth_vault config test --token-path identity/oidc/token/my_role
@@ -54,11 +78,8 @@ Displays detailed information about the token on success.`,
 		},
 	}
 
-	configTestCmd.Flags().StringVar(&testOpts.vaultAddr, "vault-addr", "", "Vault server address (env: VAULT_ADDR)")
-	configTestCmd.Flags().StringVar(&testOpts.tokenPath, "token-path", "identity/oidc/token/kubernetes", "Vault OIDC token path")
-
-	configShowCmd.Flags().StringVar(&showOpts.vaultAddr, "vault-addr", "", "Vault server address (env: VAULT_ADDR)")
-	configShowCmd.Flags().StringVar(&showOpts.tokenPath, "token-path", "identity/oidc/token/kubernetes", "Vault OIDC token path")
+	testOpts.addFlags(configTestCmd.Flags())
+	showOpts.addFlags(configShowCmd.Flags())
 
 	configCmd.AddCommand(configTestCmd)
 	configCmd.AddCommand(configShowCmd)
@@ -66,79 +87,305 @@ Displays detailed information about the token on success.`,
 }
 
 func runConfigTest(cmd *cobra.Command, opts *configOptions) error {
-	vaultAddr := opts.vaultAddr
-	if vaultAddr == "" {
-		vaultAddr = os.Getenv("VAULT_ADDR")
+	if err := opts.get.profile.apply(cmd.Flags()); err != nil {
+		return err
 	}
-	if vaultAddr == "" {
+
+	if opts.get.vault.resolvedAddr() == "" {
 		return fmt.Errorf("VAULT_ADDR is required (use --vault-addr or VAULT_ADDR env var)")
 	}
 
+	tls, err := opts.get.vault.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	// The credential is fetched like get does, from the same source.
+	sourceName, src, err := buildSource(opts.get.source, opts.get.sources)
+	if err != nil {
+		return err
+	}
+	if sourceName == source.OIDCName {
+		src = &source.OIDC{TokenPath: opts.tokenPath()}
+	} else if opts.get.verify || opts.get.expectedAudience != "" {
+		return fmt.Errorf("--verify and --expected-audience apply to OIDC tokens and cannot be used with the %s source", sourceName)
+	}
+
 	printf(cmd, "Testing Vault configuration...\n")
-	printf(cmd, "  Vault Address: %s\n", vaultAddr)
-	printf(cmd, "  Token Path:    %s\n\n", opts.tokenPath)
+	if profile := opts.get.profile.resolvedName(); profile != "" {
+		printf(cmd, "  Profile:       %s\n", profile)
+	}
+	printf(cmd, "  Vault Address: %s\n", opts.get.vault.resolvedAddr())
+	printf(cmd, "  Namespace:     %s\n", valueOrDefault(opts.get.vault.resolvedNamespace(), "(root)"))
+	printf(cmd, "  Source:        %s\n", sourceName)
+	printf(cmd, "  Path:          %s\n", src.CacheKey())
+	printf(cmd, "  Auth Method:   %s\n\n", opts.get.auth.resolvedMethod())
+
+	if !tls.IsZero() {
+		printf(cmd, "Checking TLS configuration...\n")
+		if err := tls.Validate(); err != nil {
+			printf(cmd, "❌ Invalid TLS configuration: %v\n", err)
+			return err
+		}
+		if tls.Insecure {
+			printf(cmd, "⚠️  Server certificate verification is disabled (--tls-skip-verify)\n")
+		}
+		if notAfter := tls.ClientCertificateExpiry(); !notAfter.IsZero() {
+			printf(cmd, "  Client certificate expires: %s\n", notAfter.Format(time.RFC3339))
+		}
+		printf(cmd, "✅ TLS configuration is valid\n\n")
+	}
 
-	client, err := vault.NewClient(vaultAddr)
+	client, err := opts.get.newClient(cmd)
 	if err != nil {
-		return fmt.Errorf("failed to create Vault client: %w", err)
+		return err
 	}
 
-	printf(cmd, "Fetching OIDC token...\n")
+	validator := &tokenValidator{audience: opts.get.expectedAudience}
+	if opts.get.verify {
+		validator.verifier = opts.get.vault.verifier(client)
+	}
 
-	token, exp, err := client.GetOIDCToken(cmd.Context(), opts.tokenPath)
+	if opts.get.auth.resolvedMethod() != authMethodToken {
+		printf(cmd, "Logging in to Vault...\n")
+		if err := login(cmd.Context(), cmd, client, &opts.get.auth, false); err != nil {
+			printf(cmd, "❌ Failed to log in: %v\n", err)
+			return err
+		}
+	} else if client.Token() != "" {
+		printf(cmd, "Checking Vault token...\n")
+		info, err := checkVaultToken(cmd.Context(), cmd, client)
+		if err != nil {
+			printf(cmd, "❌ %v\n", err)
+			return err
+		}
+		if info == nil {
+			printf(cmd, "⚠️  Could not look up the Vault token, its expiry is unknown\n\n")
+		} else if info.ExpireTime.IsZero() {
+			printf(cmd, "✅ Vault token does not expire\n\n")
+		} else {
+			printf(cmd, "✅ Vault token expires at %s (renewable: %t)\n\n", info.ExpireTime.Local().Format(time.RFC3339), info.Renewable)
+		}
+	}
+
+	printf(cmd, "Fetching credential from the %s source...\n", sourceName)
+
+	cred, err := src.Fetch(cmd.Context(), client)
+	if vault.IsPermissionDenied(err) && opts.get.auth.resolvedMethod() == authMethodToken && client.Token() != "" {
+		err = vaultTokenDenied(cmd.Context(), client, err)
+	}
+	if vault.IsPermissionDenied(err) && opts.get.oidcLogin && opts.get.auth.resolvedMethod() == authMethodToken {
+		printf(cmd, "Logging in to Vault with OIDC...\n")
+		if err := oidcLogin(cmd, client, &opts.get.oidc); err != nil {
+			printf(cmd, "❌ Failed to log in: %v\n", err)
+			return err
+		}
+		cred, err = src.Fetch(cmd.Context(), client)
+	}
 	if err != nil {
-		printf(cmd, "❌ Failed to fetch token: %v\n", err)
+		printf(cmd, "❌ Failed to fetch credential: %v\n", err)
 		return err
 	}
 
+	if cred.ClientCertificate != "" {
+		printf(cmd, "✅ Successfully retrieved client certificate!\n\n")
+		printf(cmd, "Certificate Details:\n")
+		printf(cmd, "  Served By:  %s\n", client.Address())
+		if cert, err := parseCertificate(cred.ClientCertificate); err == nil {
+			printf(cmd, "  Subject:    CN=%s\n", cert.Subject.CommonName)
+		}
+		printf(cmd, "  Expiration: %d (Unix timestamp)\n", cred.Exp)
+		return nil
+	}
+
+	if err := validator.validate(cmd.Context(), cred.Token); err != nil {
+		printf(cmd, "❌ Token failed verification: %v\n", err)
+		return fmt.Errorf("token from Vault failed verification: %w", err)
+	}
+
 	printf(cmd, "✅ Successfully retrieved token!\n\n")
 	printf(cmd, "Token Details:\n")
-	printf(cmd, "  Length:     %d characters\n", len(token))
-	printf(cmd, "  Expiration: %d (Unix timestamp)\n", exp)
-	printf(cmd, "  Preview:    %s...\n", token[:min(50, len(token))])
+	printf(cmd, "  Served By:  %s\n", client.Address())
+	printf(cmd, "  Length:     %d characters\n", len(cred.Token))
+	printf(cmd, "  Expiration: %d (Unix timestamp)\n", cred.Exp)
+	if validator.verifier != nil {
+		printf(cmd, "  Verified:   signature, issuer and validity\n")
+	}
+	if validator.audience != "" {
+		printf(cmd, "  Audience:   includes %s\n", validator.audience)
+	}
+	printf(cmd, "  Preview:    %s...\n", cred.Token[:min(50, len(cred.Token))])
 
 	return nil
 }
 
 func runConfigShow(cmd *cobra.Command, opts *configOptions) error {
-	vaultAddr := opts.vaultAddr
-	if vaultAddr == "" {
-		vaultAddr = os.Getenv("VAULT_ADDR")
+	if err := opts.get.profile.apply(cmd.Flags()); err != nil {
+		return err
+	}
+
+	vaultAddr := opts.get.vault.resolvedAddr()
+	namespace := opts.get.vault.resolvedNamespace()
+	tls, err := opts.get.vault.tlsConfig()
+	if err != nil {
+		return err
+	}
+	timeout, retry, err := opts.get.vault.retryConfig()
+	if err != nil {
+		return err
 	}
 
 	printf(cmd, "Current Configuration:\n\n")
 	printf(cmd, "Environment Variables:\n")
-	printf(cmd, "  VAULT_ADDR:  %s\n", envOrDefault("VAULT_ADDR", "(not set)"))
-	printf(cmd, "  VAULT_TOKEN: %s\n", envOrDefault("VAULT_TOKEN", "(not set)"))
+	printf(cmd, "  VAULT_ADDR:            %s\n", envOrDefault("VAULT_ADDR", "(not set)"))
+	printf(cmd, "  VAULT_TOKEN:           %s\n", envOrDefault("VAULT_TOKEN", "(not set)"))
+	printf(cmd, "  VAULT_NAMESPACE:       %s\n", envOrDefault("VAULT_NAMESPACE", "(not set)"))
+	printf(cmd, "  VAULT_CACERT:          %s\n", envOrDefault("VAULT_CACERT", "(not set)"))
+	printf(cmd, "  VAULT_CAPATH:          %s\n", envOrDefault("VAULT_CAPATH", "(not set)"))
+	printf(cmd, "  VAULT_CLIENT_CERT:     %s\n", envOrDefault("VAULT_CLIENT_CERT", "(not set)"))
+	printf(cmd, "  VAULT_CLIENT_KEY:      %s\n", envOrDefault("VAULT_CLIENT_KEY", "(not set)"))
+	printf(cmd, "  VAULT_TLS_SERVER_NAME: %s\n", envOrDefault("VAULT_TLS_SERVER_NAME", "(not set)"))
+	printf(cmd, "  VAULT_SKIP_VERIFY:     %s\n", envOrDefault("VAULT_SKIP_VERIFY", "(not set)"))
+	printf(cmd, "  VAULT_CLIENT_TIMEOUT:  %s\n", envOrDefault("VAULT_CLIENT_TIMEOUT", "(not set)"))
+	printf(cmd, "  VAULT_MAX_RETRIES:     %s\n", envOrDefault("VAULT_MAX_RETRIES", "(not set)"))
+	printf(cmd, "  VAULT_AUTH_METHOD:     %s\n", envOrDefault("VAULT_AUTH_METHOD", "(not set)"))
+	printf(cmd, "  VAULT_ROLE_ID:         %s\n", envOrDefault("VAULT_ROLE_ID", "(not set)"))
+	printf(cmd, "  VAULT_SECRET_ID:       %s\n", envOrDefault("VAULT_SECRET_ID", "(not set)"))
+	printf(cmd, "  VAULT_KUBERNETES_ROLE: %s\n", envOrDefault("VAULT_KUBERNETES_ROLE", "(not set)"))
+	printf(cmd, "\n")
+	printf(cmd, "Config File: %s\n", opts.get.profile.resolvedConfigFile())
 	printf(cmd, "\n")
 	printf(cmd, "Effective Settings:\n")
+	printf(cmd, "  Profile:       %s\n", valueOrDefault(opts.get.profile.resolvedName(), "(none)"))
 	printf(cmd, "  Vault Address: %s\n", valueOrDefault(vaultAddr, "(not set)"))
-	printf(cmd, "  Token Path:    %s\n", opts.tokenPath)
+	printf(cmd, "  Namespace:     %s\n", valueOrDefault(namespace, "(root)"))
+	printf(cmd, "  Token Path:    %s\n", opts.tokenPath())
+	printf(cmd, "  Auth Method:   %s\n", opts.get.auth.resolvedMethod())
+	printf(cmd, "  CA Cert:       %s\n", valueOrDefault(tls.CACert, "(system)"))
+	printf(cmd, "  CA Path:       %s\n", valueOrDefault(tls.CAPath, "(not set)"))
+	printf(cmd, "  Client Cert:   %s\n", valueOrDefault(tls.ClientCert, "(not set)"))
+	printf(cmd, "  Client Key:    %s\n", valueOrDefault(tls.ClientKey, "(not set)"))
+	printf(cmd, "  TLS Server:    %s\n", valueOrDefault(tls.ServerName, "(from address)"))
+	printf(cmd, "  Skip Verify:   %t\n", tls.Insecure)
+	printf(cmd, "  Timeout:       %s\n", timeout)
+	printf(cmd, "  Max Retries:   %d\n", retry.MaxRetries)
 	printf(cmd, "\n")
 	printf(cmd, "Kubeconfig Example:\n")
-	printf(cmd, "  users:\n")
-	printf(cmd, "  - name: vault-user\n")
-	printf(cmd, "    user:\n")
-	printf(cmd, "      exec:\n")
-	printf(cmd, "        apiVersion: client.authentication.k8s.io/v1\n")
-	printf(cmd, "        command: kubectl-auth_vault\n")
-	printf(cmd, "        interactiveMode: Never\n")
-	if vaultAddr != "" {
-		printf(cmd, "        env:\n")
-		printf(cmd, "        - name: VAULT_ADDR\n")
-		printf(cmd, "          value: %s\n", vaultAddr)
-	}
-	printf(cmd, "        args:\n")
-	printf(cmd, "        - get\n")
-	printf(cmd, "        - --token-path\n")
-	printf(cmd, "        - %s\n", opts.tokenPath)
+	exec, err := opts.execConfig()
+	if err != nil {
+		return err
+	}
+	example, err := kubeconfig.Snippet("vault-user", exec)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(string(example), "\n"), "\n") {
+		printf(cmd, "  %s", line)
+	}
+	printf(cmd, "\n")
 
 	return nil
 }
 
+// execEnvFlags are the get flags passed to the exec stanza as the Vault CLI
+// environment variables, which get honors as well.
+var execEnvFlags = map[string]bool{
+	"vault-addr": true, "namespace": true, "ca-cert": true, "ca-path": true,
+	"client-cert": true, "client-key": true, "tls-server-name": true, "tls-skip-verify": true,
+}
+
+// execSecretFlags are left to the environment of the user rather than
+// written to the kubeconfig.
+var execSecretFlags = map[string]bool{
+	"role-id": true, "secret-id": true,
+}
+
+// execConfig returns the kubeconfig exec stanza running get with the current
+// settings: the get flags that were set, except those coming from the profile,
+// which are picked up through --profile. Secrets are left to the environment
+// of the user.
+func (o *configOptions) execConfig() (*kubeconfig.ExecConfig, error) {
+	exec := &kubeconfig.ExecConfig{
+		APIVersion:      credential.APIVersionV1,
+		Command:         "kubectl-auth_vault",
+		InteractiveMode: "Never",
+		Args:            []string{"get"},
+	}
+	// The browser login needs kubectl to hand over the terminal.
+	if o.get.oidcLogin {
+		exec.InteractiveMode = "IfAvailable"
+	}
+
+	tls, _ := o.get.vault.tlsConfig()
+	env := []struct{ flag, name, value string }{
+		{"vault-addr", "VAULT_ADDR", o.get.vault.resolvedAddr()},
+		{"namespace", "VAULT_NAMESPACE", o.get.vault.resolvedNamespace()},
+		{"ca-cert", "VAULT_CACERT", tls.CACert},
+		{"ca-path", "VAULT_CAPATH", tls.CAPath},
+		{"client-cert", "VAULT_CLIENT_CERT", tls.ClientCert},
+		{"client-key", "VAULT_CLIENT_KEY", tls.ClientKey},
+		{"tls-server-name", "VAULT_TLS_SERVER_NAME", tls.ServerName},
+	}
+	if tls.Insecure {
+		env = append(env, struct{ flag, name, value string }{"tls-skip-verify", "VAULT_SKIP_VERIFY", "true"})
+	}
+	for _, e := range env {
+		if e.value != "" && !o.get.profile.fromProfile(e.flag) {
+			exec.Env = append(exec.Env, kubeconfig.ExecEnvVar{Name: e.name, Value: e.value})
+		}
+	}
+
+	if profile := o.get.profile.resolvedName(); profile != "" {
+		exec.Args = append(exec.Args, "--profile", profile)
+	}
+
+	sourceName, err := source.Select(o.get.source, o.get.sources)
+	if err != nil {
+		return nil, err
+	}
+	if sourceName == source.OIDCName && !o.get.profile.fromProfile("token-path") {
+		exec.Args = append(exec.Args, "--token-path", o.tokenPath())
+	}
+
+	// Only the flags of get are installed, not those of the command running.
+	getFlags := pflag.NewFlagSet("get", pflag.ContinueOnError)
+	(&getOptions{}).addFlags(getFlags)
+	fs := o.get.vault.flags
+	getFlags.VisitAll(func(f *pflag.Flag) {
+		name := f.Name
+		if name == "profile" || name == "token-path" || execEnvFlags[name] || execSecretFlags[name] {
+			return
+		}
+		if !fs.Changed(name) || o.get.profile.fromProfile(name) {
+			return
+		}
+		exec.Args = append(exec.Args, execArgs(fs.Lookup(name))...)
+	})
+
+	return exec, nil
+}
+
+// execArgs returns the command line arguments setting f to its value.
+func execArgs(f *pflag.Flag) []string {
+	if f.Value.Type() == "bool" {
+		if f.Value.String() == "true" {
+			return []string{"--" + f.Name}
+		}
+		return []string{"--" + f.Name + "=" + f.Value.String()}
+	}
+	if slice, ok := f.Value.(pflag.SliceValue); ok {
+		var args []string
+		for _, v := range slice.GetSlice() {
+			args = append(args, "--"+f.Name, v)
+		}
+		return args
+	}
+	return []string{"--" + f.Name, f.Value.String()}
+}
+
 func envOrDefault(key, def string) string {
 	if v := os.Getenv(key); v != "" {
-		if key == "VAULT_TOKEN" {
+		if key == "VAULT_TOKEN" || key == "VAULT_SECRET_ID" {
 			return "(set, hidden)"
 		}
 		return v
@@ -1,21 +1,41 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/efortin/kubectl-auth-vault/internal/cache"
 	"github.com/efortin/kubectl-auth-vault/internal/credential"
+	"github.com/efortin/kubectl-auth-vault/internal/jwt"
+	"github.com/efortin/kubectl-auth-vault/internal/source"
 	"github.com/efortin/kubectl-auth-vault/internal/vault"
 )
 
 type getOptions struct {
-	vaultAddr string
-	tokenPath string
-	cacheFile string
-	noCache   bool
+	profile              profileOptions
+	vault                vaultOptions
+	source               string
+	sources              map[string]source.Builder
+	cacheFile            string
+	noCache              bool
+	agentSocket          string
+	noAgent              bool
+	refreshBefore        time.Duration
+	refreshBeforePercent int
+	lockTimeout          time.Duration
+	auth                 authOptions
+	oidcLogin            bool
+	oidc                 oidcLoginOptions
+	verify               bool
+	expectedAudience     string
+	failOnRefreshError   bool
+	verbose              bool
 }
 
 func addGetCommand(rootCmd *cobra.Command) {
@@ -27,7 +47,38 @@ func addGetCommand(rootCmd *cobra.Command) {
 		Long: `Fetches an OIDC token from HashiCorp Vault and outputs it in the
 ExecCredential format expected by kubectl.
 
-The token is cached locally and reused until expiration.`,
+The token is cached locally and reused until it gets close to expiration
+(see --refresh-before and --refresh-before-percent). --timeout bounds the
+whole command, including all Vault requests and their retries. When Vault is
+unavailable, a cached token that has not expired yet is used instead, with a
+warning, unless --fail-on-refresh-error is set.
+
+When invoked by kubectl, the KUBERNETES_EXEC_INFO environment variable is
+honored: the requested apiVersion (client.authentication.k8s.io/v1 or v1beta1)
+is echoed back in the output. When the kubeconfig cluster sets
+provideClusterInfo, an "audience" in the client.authentication.k8s.io/exec
+extension of the cluster is used as --expected-audience.
+
+--source selects another credential source, and is implied by the flags
+specific to a source:
+
+  oidc              OIDC token from the identity secrets engine (default)
+  pki               Client certificate and key issued by the PKI secrets
+                    engine (--pki-role), for clusters trusting a CA managed by
+                    Vault rather than OIDC tokens. They are cached until the
+                    certificate expires.
+  kubernetes-creds  Service account token generated by the Kubernetes secrets
+                    engine (--kubernetes-creds-role), e.g. for break-glass
+                    access. It is cached for the duration of its lease, which
+                    "cache clear" revokes.
+  kv                Static token read from a field of a KV v1 or v2 secret
+                    (--kv-path), for clusters without an OIDC integration. It
+                    is cached for --kv-ttl, or until its exp claim if it is a
+                    JWT expiring sooner.
+
+When the socket of the agent exists, the credential is taken from the agent
+(see "agent --help"), falling back to getting it directly when the agent
+fails. --no-agent and --no-cache bypass the agent.`,
 		Example: `  # Using environment variable for vault address
   export VAULT_ADDR=https://vault.example.com
   kubectl-auth_vault get --token-path identity/oidc/token/my_role
@@ -36,57 +87,330 @@ The token is cached locally and reused until expiration.`,
   kubectl-auth_vault get --vault-addr https://vault.example.com --token-path identity/oidc/token/my_role
 
   # Disable caching
-  kubectl-auth_vault get --token-path identity/oidc/token/my_role --no-cache`,
+  kubectl-auth_vault get --token-path identity/oidc/token/my_role --no-cache
+
+  # Fetch the token from a Vault Enterprise namespace
+  kubectl-auth_vault get --namespace team-a --token-path identity/oidc/token/my_role
+
+  # Log in with AppRole (e.g. in CI)
+  export VAULT_ROLE_ID=... VAULT_SECRET_ID=...
+  kubectl-auth_vault get --token-path identity/oidc/token/my_role --auth-method approle
+
+  # Log in with the pod's service account (Kubernetes auth)
+  kubectl-auth_vault get --token-path identity/oidc/token/my_role --auth-method kubernetes --kubernetes-role fleet
+
+  # Fall back to a browser login when the Vault token is missing or expired
+  # (requires interactiveMode: IfAvailable in the kubeconfig exec stanza)
+  kubectl-auth_vault get --token-path identity/oidc/token/my_role --oidc-login
+
+  # Use the settings of the "prod" profile from ~/.config/kubectl-auth-vault/config.yaml
+  kubectl-auth_vault get --profile prod
+
+  # Verify the token signature against the keys of the Vault OIDC provider
+  kubectl-auth_vault get --token-path identity/oidc/token/my_role --verify
+
+  # Fail unless the token is issued for the "prod" cluster
+  kubectl-auth_vault get --token-path identity/oidc/token/my_role --expected-audience prod
+
+  # Issue a client certificate for the user "jane" from the PKI role "kubernetes"
+  kubectl-auth_vault get --pki-role pki/issue/kubernetes --pki-common-name jane
+
+  # Get a break-glass service account token in the namespace "default" for 15 minutes
+  kubectl-auth_vault get --kubernetes-creds-role kubernetes/creds/breakglass --kubernetes-creds-namespace default --kubernetes-creds-ttl 15m
+
+  # Read a static token from the "token" field of a KV secret, pinned to version 3
+  kubectl-auth_vault get --kv-path secret/clusters/legacy --kv-version 3
+
+  # Refresh tokens with less than 5 minutes or 20% of their lifetime left
+  kubectl-auth_vault get --token-path identity/oidc/token/my_role --refresh-before 5m --refresh-before-percent 20`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runGet(cmd, opts)
 		},
 	}
 
-	getCmd.Flags().StringVar(&opts.vaultAddr, "vault-addr", "", "Vault server address (env: VAULT_ADDR)")
-	getCmd.Flags().StringVar(&opts.tokenPath, "token-path", "", "Vault OIDC token path")
-	getCmd.Flags().StringVar(&opts.cacheFile, "cache-file", "", "Token cache file path (default: ~/.kube/vault_<sanitized_path>_token.json)")
-	getCmd.Flags().BoolVar(&opts.noCache, "no-cache", false, "Disable token caching")
+	opts.addFlags(getCmd.Flags())
 
 	rootCmd.AddCommand(getCmd)
 }
 
+func (o *getOptions) addFlags(fs *pflag.FlagSet) {
+	o.sources = source.Builders()
+	o.profile.addFlags(fs)
+	o.vault.addFlags(fs)
+	fs.StringVar(&o.source, "source", "", fmt.Sprintf("Credential source: %s (default: implied by the source flags, or %s)", strings.Join(source.Names(), ", "), source.Default))
+	for _, name := range source.Names() {
+		o.sources[name].AddFlags(fs)
+	}
+	fs.StringVar(&o.cacheFile, "cache-file", "", "Token cache file path (default: ~/.kube/vault_<sanitized_path>_token.json)")
+	fs.BoolVar(&o.noCache, "no-cache", false, "Disable token caching")
+	fs.StringVar(&o.agentSocket, "agent-socket", "", "Socket of the agent to get the credential from when it exists (env: KUBECTL_AUTH_VAULT_AGENT_SOCKET, default: ~/.kube/vault_agent.sock)")
+	fs.BoolVar(&o.noAgent, "no-agent", false, "Get the credential without the agent even if it is running")
+	fs.DurationVar(&o.refreshBefore, "refresh-before", 30*time.Second, "Refresh cached tokens with less than this lifetime left")
+	fs.IntVar(&o.refreshBeforePercent, "refresh-before-percent", 0, "Refresh cached tokens with less than this percentage of their lifetime left (0 disables)")
+	fs.DurationVar(&o.lockTimeout, "lock-timeout", 10*time.Second, "Maximum time to wait for another process refreshing the same token")
+	o.auth.addFlags(fs)
+	fs.BoolVar(&o.oidcLogin, "oidc-login", false, "Log in via the Vault OIDC browser flow when the Vault token is missing or expired and kubectl runs interactively")
+	o.oidc.addFlags(fs)
+	fs.BoolVar(&o.verify, "verify", false, "Verify the token signature, issuer and validity against the Vault OIDC provider keys before using it")
+	fs.BoolVarP(&o.verbose, "verbose", "v", false, "Print which Vault node served the token, and skipped unavailable nodes, to stderr")
+	fs.BoolVar(&o.failOnRefreshError, "fail-on-refresh-error", false, "Fail when Vault is unavailable instead of using a cached token that has not expired yet")
+	fs.StringVar(&o.expectedAudience, "expected-audience", "", "Fail unless the token aud claim includes this audience (default: the audience of the cluster in KUBERNETES_EXEC_INFO)")
+}
+
 func runGet(cmd *cobra.Command, opts *getOptions) error {
-	vaultAddr := opts.vaultAddr
-	if vaultAddr == "" {
-		vaultAddr = os.Getenv("VAULT_ADDR")
+	if err := opts.profile.apply(cmd.Flags()); err != nil {
+		return err
 	}
-	if vaultAddr == "" {
+
+	execInfo, err := credential.ExecInfoFromEnv()
+	if err != nil {
+		return err
+	}
+
+	if opts.vault.resolvedAddr() == "" {
 		return fmt.Errorf("VAULT_ADDR is required (use --vault-addr or VAULT_ADDR env var)")
 	}
 
+	if opts.refreshBeforePercent < 0 || opts.refreshBeforePercent > 100 {
+		return fmt.Errorf("--refresh-before-percent must be between 0 and 100")
+	}
+
+	parent := cmd.Context()
+	ctx, cancel, err := opts.vault.withDeadline(parent)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	cmd.SetContext(ctx)
+
+	refreshPolicy := cache.RefreshPolicy{
+		MinRemaining:     opts.refreshBefore,
+		RemainingPercent: opts.refreshBeforePercent,
+	}
+
+	sourceName, src, err := buildSource(opts.source, opts.sources)
+	if err != nil {
+		return err
+	}
+	if sourceName != source.OIDCName && (opts.verify || opts.expectedAudience != "") {
+		return fmt.Errorf("--verify and --expected-audience apply to OIDC tokens and cannot be used with the %s source", sourceName)
+	}
+
 	cacheFile := opts.cacheFile
 	if cacheFile == "" {
-		cacheFile = cache.DefaultCacheFile(opts.tokenPath)
+		cacheFile = cache.DefaultCacheFile(opts.vault.resolvedNamespace(), src.CacheKey())
 	}
 
 	tokenCache := cache.New(cacheFile)
 
+	validator := &tokenValidator{audience: opts.expectedAudience}
+	if validator.audience == "" && sourceName == source.OIDCName {
+		if validator.audience, err = execInfo.Spec.Cluster.Audience(); err != nil {
+			return err
+		}
+	}
+
+	// With --verify, the client is also needed to verify cached tokens.
+	var client *vault.Client
+	if opts.verify {
+		if client, err = opts.newClient(cmd); err != nil {
+			return err
+		}
+		validator.verifier = opts.vault.verifier(client)
+	}
+
+	if !opts.noAgent && !opts.noCache {
+		if entry, ok := opts.fromAgent(cmd, sourceName, refreshPolicy, validator); ok {
+			return writeCredential(cmd, execInfo, entry)
+		}
+	}
+
 	if !opts.noCache {
-		if token, ok := tokenCache.Load(); ok {
-			return credential.Output(cmd.OutOrStdout(), token)
+		if entry, ok := loadFresh(cmd, tokenCache, refreshPolicy, validator); ok {
+			return writeCredential(cmd, execInfo, entry)
+		}
+
+		// Only one process refreshes the token; the others wait for the lock
+		// and then pick up the freshly saved token.
+		unlock, err := tokenCache.Lock(cmd.Context(), opts.lockTimeout)
+		if err != nil {
+			cmd.PrintErrf("warning: failed to lock token cache: %v\n", err)
+		} else {
+			defer unlock()
+			if entry, ok := loadFresh(cmd, tokenCache, refreshPolicy, validator); ok {
+				return writeCredential(cmd, execInfo, entry)
+			}
 		}
 	}
 
-	client, err := vault.NewClient(vaultAddr)
-	if err != nil {
-		return fmt.Errorf("failed to create Vault client: %w", err)
+	if client == nil {
+		if client, err = opts.newClient(cmd); err != nil {
+			return err
+		}
 	}
 
-	token, exp, err := client.GetOIDCToken(cmd.Context(), opts.tokenPath)
+	var entry *cache.TokenCache
+	err = login(cmd.Context(), cmd, client, &opts.auth, !opts.noCache)
+	if err == nil {
+		entry, err = fetch(cmd.Context(), client, src)
+		if vault.IsPermissionDenied(err) && opts.auth.resolvedMethod() == authMethodToken && client.Token() != "" {
+			err = vaultTokenDenied(cmd.Context(), client, err)
+		}
+	}
+	if vault.IsPermissionDenied(err) && opts.oidcLogin && opts.auth.resolvedMethod() == authMethodToken {
+		if !execInfo.Spec.Interactive {
+			return fmt.Errorf("%w (not running interactively, run `kubectl auth-vault login` first)", err)
+		}
+		// The browser login waits for the user with a timeout of its own, and
+		// fetching the credential afterwards gets a new deadline.
+		cmd.SetContext(parent)
+		if err := oidcLogin(cmd, client, &opts.oidc); err != nil {
+			return err
+		}
+		ctx, cancel, _ := opts.vault.withDeadline(parent)
+		defer cancel()
+		cmd.SetContext(ctx)
+		entry, err = fetch(cmd.Context(), client, src)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to fetch token from Vault: %w", err)
+		return opts.useStale(cmd, tokenCache, validator, execInfo, err)
+	}
+
+	if err := validator.validate(cmd.Context(), entry.Token); err != nil {
+		return fmt.Errorf("token from Vault failed verification: %w", err)
+	}
+
+	if opts.verbose {
+		cmd.PrintErrf("Token served by %s\n", client.Address())
 	}
 
 	if !opts.noCache {
-		if err := tokenCache.Save(token, exp); err != nil {
+		if err := tokenCache.SaveEntry(entry); err != nil {
 			cmd.PrintErrf("warning: failed to cache token: %v\n", err)
 		}
 	}
 
-	return credential.Output(cmd.OutOrStdout(), token)
+	return writeCredential(cmd, execInfo, entry)
+}
+
+// buildSource selects the source among builders like source.Select and
+// builds it from its flags.
+func buildSource(name string, builders map[string]source.Builder) (string, source.Source, error) {
+	name, err := source.Select(name, builders)
+	if err != nil {
+		return "", nil, err
+	}
+	src, err := builders[name].Build()
+	if err != nil {
+		return "", nil, err
+	}
+	return name, src, nil
+}
+
+// fetch gets a new credential from src as a cache entry.
+func fetch(ctx context.Context, client *vault.Client, src source.Source) (*cache.TokenCache, error) {
+	cred, err := src.Fetch(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return &cache.TokenCache{
+		Token:             cred.Token,
+		ClientCertificate: cred.ClientCertificate,
+		ClientKey:         cred.ClientKey,
+		Exp:               cred.Exp,
+		TokenPath:         src.CacheKey(),
+		Namespace:         client.Namespace(),
+		LeaseID:           cred.LeaseID,
+	}, nil
+}
+
+// writeCredential writes the ExecCredential holding the token or client
+// certificate of entry.
+func writeCredential(cmd *cobra.Command, execInfo *credential.ExecInfo, entry *cache.TokenCache) error {
+	if entry.ClientCertificate != "" {
+		return execInfo.NewClientCertificateCredential(entry.ClientCertificate, entry.ClientKey, entry.Exp).Write(cmd.OutOrStdout())
+	}
+	return execInfo.NewCredential(entry.Token, entry.Exp).Write(cmd.OutOrStdout())
+}
+
+// newClient returns the Vault client, reporting skipped unavailable nodes
+// with --verbose.
+func (o *getOptions) newClient(cmd *cobra.Command) (*vault.Client, error) {
+	client, err := o.vault.newClient()
+	if err != nil {
+		return nil, err
+	}
+	if o.verbose {
+		client.SetFailoverHandler(func(address string, err error) {
+			cmd.PrintErrf("Vault at %s is unavailable: %v\n", address, err)
+		})
+	}
+	return client, nil
+}
+
+// loadFresh returns the cached entry unless it is missing, due for a refresh
+// or fails validation.
+func loadFresh(cmd *cobra.Command, tokenCache *cache.Cache, policy cache.RefreshPolicy, validator *tokenValidator) (*cache.TokenCache, bool) {
+	entry, err := tokenCache.Read()
+	if errors.Is(err, cache.ErrCorrupt) {
+		cmd.PrintErrf("warning: %v\n", err)
+	}
+	if err != nil || policy.NeedsRefreshEntry(entry, time.Now()) {
+		return nil, false
+	}
+	if err := validator.validate(cmd.Context(), entry.Token); err != nil {
+		cmd.PrintErrf("warning: discarding cached token: %v\n", err)
+		return nil, false
+	}
+	return entry, true
+}
+
+// useStale answers with the cached token when refreshing it failed because
+// Vault is unavailable and the cached token has not expired yet, so that a
+// Vault outage does not cut access to the cluster before it has to. It
+// returns err otherwise.
+func (o *getOptions) useStale(cmd *cobra.Command, tokenCache *cache.Cache, validator *tokenValidator, execInfo *credential.ExecInfo, err error) error {
+	if o.noCache || o.failOnRefreshError || !vault.IsUnavailable(err) {
+		return err
+	}
+
+	entry, cacheErr := tokenCache.Peek()
+	if cacheErr != nil || entry.Exp <= time.Now().Unix() {
+		return err
+	}
+	if validator.validate(cmd.Context(), entry.Token) != nil {
+		return err
+	}
+
+	cmd.PrintErrf("warning: %v\n", err)
+	cmd.PrintErrf("warning: Vault is unavailable, using the cached token expiring at %s\n",
+		time.Unix(entry.Exp, 0).UTC().Format(time.RFC3339))
+	return writeCredential(cmd, execInfo, entry)
+}
+
+// tokenValidator checks tokens before they are handed to kubectl, so that a
+// token that does not verify or is meant for another cluster is never used.
+type tokenValidator struct {
+	// verifier checks the signature, issuer and validity period when set.
+	verifier *jwt.Verifier
+	// audience must be in the aud claim when set.
+	audience string
+}
+
+func (v *tokenValidator) validate(ctx context.Context, token string) error {
+	if v.verifier != nil {
+		if _, err := v.verifier.Verify(ctx, token, time.Now()); err != nil {
+			return err
+		}
+	}
+	if v.audience != "" {
+		payload, err := jwt.DecodePayload(token)
+		if err != nil {
+			return fmt.Errorf("%w: %v", jwt.ErrInvalidToken, err)
+		}
+		if err := payload.ValidateAudience(v.audience); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/efortin/kubectl-auth-vault/internal/kubeconfig"
+)
+
+type kubeconfigInstallOptions struct {
+	config     configOptions
+	user       string
+	contexts   []string
+	clusters   []string
+	kubeconfig string
+	dryRun     bool
+}
+
+func addKubeconfigCommand(rootCmd *cobra.Command) {
+	kubeconfigCmd := &cobra.Command{
+		Use:   "kubeconfig",
+		Short: "Manage kubeconfig entries using the plugin",
+	}
+
+	opts := &kubeconfigInstallOptions{}
+	installCmd := &cobra.Command{
+		Use:   "install",
+		Short: "Add or update a kubeconfig user running the plugin",
+		Long: `Adds a user whose exec stanza runs get with the current settings to the
+kubeconfig, or replaces the credentials of the user if it already exists.
+
+Like kubectl, the files listed in KUBECONFIG are honored: an existing user or
+context is updated in the file defining it, new entries are added to the first
+existing file. Files are rewritten in a normalized format, and the diff shown
+by --dry-run ignores formatting-only changes.`,
+		Example: `  # Add the vault-user user running the "prod" profile
+  kubectl-auth_vault kubeconfig install --profile prod
+
+  # Use the user in existing contexts
+  kubectl-auth_vault kubeconfig install --vault-addr https://vault.example.com \
+    --token-path identity/oidc/token/my_role --context prod --context staging
+
+  # Create the context vault-user@prod-cluster and show the changes without writing them
+  kubectl-auth_vault kubeconfig install --profile prod --cluster prod-cluster --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKubeconfigInstall(cmd, opts)
+		},
+	}
+
+	opts.config.addFlags(installCmd.Flags())
+	installCmd.Flags().StringVar(&opts.user, "user", "vault-user", "Name of the kubeconfig user")
+	installCmd.Flags().StringArrayVar(&opts.contexts, "context", nil, "Existing context to authenticate as the user (repeatable)")
+	installCmd.Flags().StringArrayVar(&opts.clusters, "cluster", nil, "Cluster to bind to the user with a <user>@<cluster> context (repeatable)")
+	installCmd.Flags().StringVar(&opts.kubeconfig, "kubeconfig", "", "Kubeconfig file to edit (default: KUBECONFIG or ~/.kube/config)")
+	installCmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Print the changes as a diff instead of writing them")
+
+	kubeconfigCmd.AddCommand(installCmd)
+	rootCmd.AddCommand(kubeconfigCmd)
+}
+
+func runKubeconfigInstall(cmd *cobra.Command, opts *kubeconfigInstallOptions) error {
+	if err := opts.config.get.profile.apply(cmd.Flags()); err != nil {
+		return err
+	}
+
+	if opts.config.get.vault.resolvedAddr() == "" {
+		return fmt.Errorf("VAULT_ADDR is required (use --vault-addr, VAULT_ADDR env var or a profile)")
+	}
+	if _, err := opts.config.get.vault.tlsConfig(); err != nil {
+		return err
+	}
+
+	paths := kubeconfig.Paths()
+	if opts.kubeconfig != "" {
+		paths = []string{opts.kubeconfig}
+	}
+
+	kc, err := kubeconfig.Load(paths...)
+	if err != nil {
+		return err
+	}
+
+	exec, err := opts.config.execConfig()
+	if err != nil {
+		return err
+	}
+	if err := kc.SetUser(opts.user, exec); err != nil {
+		return err
+	}
+	for _, context := range opts.contexts {
+		if err := kc.SetContextUser(context, opts.user); err != nil {
+			return err
+		}
+	}
+	for _, cluster := range opts.clusters {
+		if err := kc.SetContext(opts.user+"@"+cluster, cluster, opts.user); err != nil {
+			return err
+		}
+	}
+
+	changes, err := kc.Changes()
+	if err != nil {
+		return err
+	}
+
+	if opts.dryRun {
+		for _, change := range changes {
+			printf(cmd, "%s", kubeconfig.Diff(change.Path, change.Before, change.After))
+		}
+		return nil
+	}
+
+	if err := kc.Save(); err != nil {
+		return err
+	}
+	for _, change := range changes {
+		printf(cmd, "Updated %s\n", change.Path)
+	}
+	if len(changes) == 0 {
+		printf(cmd, "Kubeconfig is up to date\n")
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+type oidcLoginOptions struct {
+	mountPath     string
+	role          string
+	listenAddress string
+	noBrowser     bool
+	timeout       time.Duration
+}
+
+func (o *oidcLoginOptions) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.mountPath, "oidc-mount", "oidc", "Mount path of the Vault OIDC auth method")
+	fs.StringVar(&o.role, "oidc-role", "", "Vault OIDC auth role (default: the mount's default role)")
+	fs.StringVar(&o.listenAddress, "oidc-listen-address", vault.DefaultOIDCListenAddress, "Local address receiving the OIDC callback")
+	fs.BoolVar(&o.noBrowser, "no-browser", false, "Print the login URL instead of opening a browser")
+	fs.DurationVar(&o.timeout, "oidc-login-timeout", 5*time.Minute, "Maximum time to wait for the browser login to complete")
+}
+
+type loginOptions struct {
+	profile profileOptions
+	vault   vaultOptions
+	oidc    oidcLoginOptions
+}
+
+func addLoginCommand(rootCmd *cobra.Command) {
+	opts := &loginOptions{}
+
+	loginCmd := &cobra.Command{
+		Use:   "login",
+		Short: "Log in to Vault with the OIDC auth method",
+		Long: `Runs the Vault OIDC auth flow in your browser and saves the resulting
+Vault token to ~/.vault-token, where get and the Vault CLI pick it up.
+
+The OIDC role must allow http://localhost:8250/oidc/callback (or the
+address given with --oidc-listen-address) as redirect URI.`,
+		Example: `  # Log in with the default OIDC role
+  kubectl-auth_vault login --vault-addr https://vault.example.com
+
+  # Log in with a specific role and print the URL instead of opening a browser
+  kubectl-auth_vault login --oidc-role k8s-users --no-browser`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runLogin(cmd, opts)
+		},
+	}
+
+	opts.profile.addFlags(loginCmd.Flags())
+	opts.vault.addFlags(loginCmd.Flags())
+	opts.oidc.addFlags(loginCmd.Flags())
+
+	rootCmd.AddCommand(loginCmd)
+}
+
+func runLogin(cmd *cobra.Command, opts *loginOptions) error {
+	if err := opts.profile.apply(cmd.Flags()); err != nil {
+		return err
+	}
+
+	client, err := opts.vault.newClient()
+	if err != nil {
+		return err
+	}
+
+	if err := oidcLogin(cmd, client, &opts.oidc); err != nil {
+		return err
+	}
+
+	printf(cmd, "✅ Successfully logged in to Vault, token saved to ~/.vault-token\n")
+	return nil
+}
+
+// oidcLogin runs the browser-based OIDC login and persists the Vault token.
+// Instructions go to stderr since stdout may carry an ExecCredential.
+func oidcLogin(cmd *cobra.Command, client *vault.Client, opts *oidcLoginOptions) error {
+	ctx, cancel := context.WithTimeout(cmd.Context(), opts.timeout)
+	defer cancel()
+
+	authenticator := &vault.OIDCAuth{
+		MountPath:     opts.mountPath,
+		Role:          opts.role,
+		ListenAddress: opts.listenAddress,
+		Out:           cmd.ErrOrStderr(),
+	}
+	if !opts.noBrowser {
+		authenticator.OpenURL = openBrowser
+	}
+
+	auth, err := client.Login(ctx, authenticator)
+	if err != nil {
+		return fmt.Errorf("failed to log in to Vault with oidc auth: %w", err)
+	}
+
+	return vault.SaveVaultToken(auth.ClientToken)
+}
+
+func openBrowser(url string) error {
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		c = exec.Command("open", url)
+	case "windows":
+		c = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		c = exec.Command("xdg-open", url)
+	}
+	return c.Start()
+}
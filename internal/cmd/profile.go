@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/pflag"
+
+	"github.com/efortin/kubectl-auth-vault/internal/config"
+)
+
+// profileOptions selects a profile from the config file. Profile values only
+// fill in settings that were given neither as a flag nor as an environment
+// variable, so the precedence is flags > env > profile > defaults.
+type profileOptions struct {
+	name       string
+	configFile string
+
+	// applied records the flags whose value came from the profile.
+	applied map[string]bool
+}
+
+func (o *profileOptions) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.name, "profile", "", "Profile from the config file to use (env: KUBECTL_AUTH_VAULT_PROFILE)")
+	fs.StringVar(&o.configFile, "config", "", "Config file path (env: KUBECTL_AUTH_VAULT_CONFIG, default: ~/.config/kubectl-auth-vault/config.yaml)")
+}
+
+func (o *profileOptions) resolvedName() string {
+	return flagOrEnv(o.name, "KUBECTL_AUTH_VAULT_PROFILE")
+}
+
+func (o *profileOptions) resolvedConfigFile() string {
+	if file := flagOrEnv(o.configFile, "KUBECTL_AUTH_VAULT_CONFIG"); file != "" {
+		return file
+	}
+	return config.DefaultPath()
+}
+
+// profileSetting maps a profile value to the flag it provides a value for and
+// the environment variable taking precedence over it.
+type profileSetting struct {
+	flag  string
+	env   string
+	value string
+}
+
+func profileSettings(p *config.Profile) []profileSetting {
+	return []profileSetting{
+		{"vault-addr", "VAULT_ADDR", p.VaultAddr.String()},
+		{"namespace", "VAULT_NAMESPACE", p.Namespace},
+		{"source", "", p.Source},
+		{"token-path", "", p.TokenPath},
+		{"verify", "", formatBool(p.Verify)},
+		{"expected-audience", "", p.ExpectedAudience},
+		{"pki-role", "", p.PKIRole},
+		{"pki-common-name", "", p.PKICommonName},
+		{"pki-ttl", "", p.PKITTL},
+		{"kubernetes-creds-role", "", p.KubernetesCreds.Role},
+		{"kubernetes-creds-namespace", "", p.KubernetesCreds.Namespace},
+		{"kubernetes-creds-ttl", "", p.KubernetesCreds.TTL},
+		{"kubernetes-creds-cluster-role-binding", "", formatBool(p.KubernetesCreds.ClusterRoleBinding)},
+		{"kv-path", "", p.KV.Path},
+		{"kv-field", "", p.KV.Field},
+		{"kv-version", "", formatInt(p.KV.Version)},
+		{"kv-ttl", "", p.KV.TTL},
+		{"timeout", "VAULT_CLIENT_TIMEOUT", p.Timeout},
+		{"max-retries", "VAULT_MAX_RETRIES", formatInt(p.MaxRetries)},
+
+		{"auth-method", "VAULT_AUTH_METHOD", p.Auth.Method},
+		{"approle-mount", "", p.Auth.AppRoleMount},
+		{"role-id", "VAULT_ROLE_ID", p.Auth.RoleID},
+		{"role-id-file", "VAULT_ROLE_ID", p.Auth.RoleIDFile},
+		{"secret-id-file", "VAULT_SECRET_ID", p.Auth.SecretIDFile},
+		{"kubernetes-mount", "", p.Auth.KubernetesMount},
+		{"kubernetes-role", "VAULT_KUBERNETES_ROLE", p.Auth.KubernetesRole},
+		{"service-account-token-path", "", p.Auth.ServiceAccountTokenPath},
+		{"oidc-login", "", formatBool(p.Auth.OIDCLogin)},
+		{"oidc-mount", "", p.Auth.OIDCMount},
+		{"oidc-role", "", p.Auth.OIDCRole},
+
+		{"cache-file", "", p.Cache.File},
+		{"no-cache", "", formatBool(p.Cache.Disabled)},
+		{"refresh-before", "", p.Cache.RefreshBefore},
+		{"refresh-before-percent", "", formatInt(p.Cache.RefreshBeforePercent)},
+		{"lock-timeout", "", p.Cache.LockTimeout},
+		{"fail-on-refresh-error", "", formatBool(p.Cache.FailOnRefreshError)},
+
+		{"ca-cert", "VAULT_CACERT", p.TLS.CACert},
+		{"ca-path", "VAULT_CAPATH", p.TLS.CAPath},
+		{"client-cert", "VAULT_CLIENT_CERT", p.TLS.ClientCert},
+		{"client-key", "VAULT_CLIENT_KEY", p.TLS.ClientKey},
+		{"tls-server-name", "VAULT_TLS_SERVER_NAME", p.TLS.ServerName},
+		{"tls-skip-verify", "VAULT_SKIP_VERIFY", formatBool(p.TLS.SkipVerify)},
+	}
+}
+
+// apply loads the selected profile, if any, and sets the flags of fs that
+// were not given on the command line or through the environment.
+func (o *profileOptions) apply(fs *pflag.FlagSet) error {
+	name := o.resolvedName()
+	if name == "" {
+		return nil
+	}
+
+	f, err := config.Load(o.resolvedConfigFile())
+	if err != nil {
+		return err
+	}
+	p, err := f.Profile(name)
+	if err != nil {
+		return err
+	}
+
+	o.applied = make(map[string]bool)
+	for _, s := range profileSettings(p) {
+		if s.value == "" || fs.Lookup(s.flag) == nil || fs.Changed(s.flag) {
+			continue
+		}
+		if s.env != "" && os.Getenv(s.env) != "" {
+			continue
+		}
+		if err := fs.Set(s.flag, s.value); err != nil {
+			return fmt.Errorf("profile %q: invalid %s: %w", name, s.flag, err)
+		}
+		o.applied[s.flag] = true
+	}
+
+	return nil
+}
+
+// fromProfile reports whether the value of flag came from the profile.
+func (o *profileOptions) fromProfile(flag string) bool {
+	return o.applied[flag]
+}
+
+func formatBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
+
+func formatInt(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
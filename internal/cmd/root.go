@@ -39,6 +39,11 @@ Usage in kubeconfig:
 
 	addGetCommand(rootCmd)
 	addConfigCommand(rootCmd)
+	addLoginCommand(rootCmd)
+	addKubeconfigCommand(rootCmd)
+	addCacheCommand(rootCmd)
+	addTokenCommand(rootCmd)
+	addAgentCommand(rootCmd)
 	addVersionCommand(rootCmd)
 
 	return rootCmd
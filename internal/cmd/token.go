@@ -0,0 +1,379 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/efortin/kubectl-auth-vault/internal/cache"
+	"github.com/efortin/kubectl-auth-vault/internal/jwt"
+	"github.com/efortin/kubectl-auth-vault/internal/source"
+)
+
+// timeClaims are the claims holding a NumericDate, shown as times.
+var timeClaims = map[string]bool{"exp": true, "iat": true, "nbf": true, "auth_time": true}
+
+type tokenInspectOptions struct {
+	profile   profileOptions
+	vault     vaultOptions
+	source    string
+	sources   map[string]source.Builder
+	auth      authOptions
+	cacheFile string
+	fetch     bool
+	output    string
+}
+
+func addTokenCommand(rootCmd *cobra.Command) {
+	tokenCmd := &cobra.Command{
+		Use:   "token",
+		Short: "Work with OIDC tokens",
+	}
+
+	opts := &tokenInspectOptions{}
+	inspectCmd := &cobra.Command{
+		Use:   "inspect [-]",
+		Short: "Decode and display an OIDC token",
+		Long: `Decodes the header and all claims of an OIDC token and shows when it
+was issued and how long it remains valid.
+
+The signature and issuer are verified against the keys of the Vault OIDC
+provider when a Vault address is configured; the command fails if the token
+does not verify.
+
+The token is read from stdin when the argument is "-", fetched from Vault
+with --fetch, and otherwise read from the cache. The token to fetch or read
+from the cache is selected like get does, with the source flags
+(--token-path, --kv-path...) given on the command line or by --profile. The
+lease of a service account token fetched with --fetch is revoked right away.`,
+		Example: `  # Inspect the cached token of a token path
+  kubectl-auth_vault token inspect --token-path identity/oidc/token/my_role
+
+  # Fetch a new token from Vault and print its claims as JSON
+  kubectl-auth_vault token inspect --token-path identity/oidc/token/my_role --fetch -o json
+
+  # Inspect the token of an ExecCredential or any JWT
+  kubectl-auth_vault get --token-path identity/oidc/token/my_role | jq -r .status.token | kubectl-auth_vault token inspect -`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTokenInspect(cmd, opts, args)
+		},
+	}
+
+	opts.profile.addFlags(inspectCmd.Flags())
+	opts.vault.addFlags(inspectCmd.Flags())
+	opts.sources = source.Builders()
+	inspectCmd.Flags().StringVar(&opts.source, "source", "", fmt.Sprintf("Credential source of the token: %s (default: implied by the source flags, or %s)", strings.Join(source.Names(), ", "), source.Default))
+	for _, name := range source.Names() {
+		opts.sources[name].AddFlags(inspectCmd.Flags())
+	}
+	opts.auth.addFlags(inspectCmd.Flags())
+	inspectCmd.Flags().StringVar(&opts.cacheFile, "cache-file", "", "Token cache file to read (default: the cache of the source, as written by get)")
+	inspectCmd.Flags().BoolVar(&opts.fetch, "fetch", false, "Fetch a new token from Vault instead of reading the cache")
+	inspectCmd.Flags().StringVarP(&opts.output, "output", "o", "table", "Output format: table, json or yaml")
+
+	tokenCmd.AddCommand(inspectCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
+
+func runTokenInspect(cmd *cobra.Command, opts *tokenInspectOptions, args []string) error {
+	if err := opts.profile.apply(cmd.Flags()); err != nil {
+		return err
+	}
+
+	switch opts.output {
+	case "table", "json", "yaml":
+	default:
+		return fmt.Errorf("unsupported output format %q (use table, json or yaml)", opts.output)
+	}
+
+	raw, err := inspectedToken(cmd, opts, args)
+	if err != nil {
+		return err
+	}
+
+	token, err := jwt.Decode(raw)
+	if err != nil {
+		return err
+	}
+
+	out := newTokenInspection(token, time.Now())
+	verifyErr := opts.verify(cmd, token, &out.Verification)
+
+	switch opts.output {
+	case "json":
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(out)
+	case "yaml":
+		out.Claims = yamlClaims(out.Claims).(map[string]interface{})
+		encoder := yaml.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent(2)
+		if err = encoder.Encode(out); err == nil {
+			err = encoder.Close()
+		}
+	default:
+		err = printTokenTable(cmd, token, out)
+	}
+	if err != nil {
+		return err
+	}
+
+	return verifyErr
+}
+
+// verify checks the signature and issuer of token against the keys of the
+// Vault OIDC provider and records the outcome. Verification is skipped when
+// no Vault address is configured, e.g. for a token read from stdin.
+func (o *tokenInspectOptions) verify(cmd *cobra.Command, token *jwt.Token, result *tokenVerification) error {
+	if o.vault.resolvedAddr() == "" {
+		result.Error = "not verified: VAULT_ADDR is not set"
+		return nil
+	}
+
+	client, err := o.vault.newClient()
+	if err != nil {
+		return err
+	}
+
+	key, err := o.vault.verifier(client).VerifySignature(cmd.Context(), token)
+	if err != nil {
+		result.Error = err.Error()
+		return fmt.Errorf("token failed verification: %w", err)
+	}
+
+	result.Verified = true
+	result.Key = key.Kid
+	return nil
+}
+
+// inspectedToken returns the raw token read from stdin, Vault or the cache.
+func inspectedToken(cmd *cobra.Command, opts *tokenInspectOptions, args []string) (string, error) {
+	if len(args) == 1 {
+		if args[0] != "-" {
+			return "", fmt.Errorf(`pass the token on stdin with "-" instead of as an argument`)
+		}
+		data, err := io.ReadAll(bufio.NewReader(cmd.InOrStdin()))
+		if err != nil {
+			return "", fmt.Errorf("failed to read token from stdin: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	var src source.Source
+	if opts.fetch || opts.cacheFile == "" {
+		sourceName, built, err := buildSource(opts.source, opts.sources)
+		if err != nil {
+			return "", err
+		}
+		if sourceName == source.PKIName {
+			return "", fmt.Errorf("the %s source issues client certificates, not tokens", sourceName)
+		}
+		if built.CacheKey() == "" {
+			return "", fmt.Errorf("--token-path, another source flag, --cache-file or --profile is required")
+		}
+		src = built
+	}
+
+	if opts.fetch {
+		return fetchInspectedToken(cmd, opts, src)
+	}
+
+	cacheFile := opts.cacheFile
+	if cacheFile == "" {
+		cacheFile = cache.DefaultCacheFile(opts.vault.resolvedNamespace(), src.CacheKey())
+	}
+	entry, err := cache.New(cacheFile).Peek()
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("no cached token in %s (use --fetch to fetch one from Vault)", cacheFile)
+	}
+	if err != nil {
+		return "", err
+	}
+	if entry.Token == "" {
+		return "", fmt.Errorf("%s holds a client certificate, not a token", cacheFile)
+	}
+	return entry.Token, nil
+}
+
+// fetchInspectedToken fetches a new token from src within --timeout. The
+// lease of a service account token is revoked right away, since the token is
+// neither cached nor used.
+func fetchInspectedToken(cmd *cobra.Command, opts *tokenInspectOptions, src source.Source) (string, error) {
+	ctx, cancel, err := opts.vault.withDeadline(cmd.Context())
+	if err != nil {
+		return "", err
+	}
+	defer cancel()
+
+	client, err := opts.vault.newClient()
+	if err != nil {
+		return "", err
+	}
+	if err := login(ctx, cmd, client, &opts.auth, true); err != nil {
+		return "", err
+	}
+	cred, err := src.Fetch(ctx, client)
+	if err != nil {
+		return "", err
+	}
+	if cred.LeaseID != "" {
+		if err := client.RevokeLease(ctx, cred.LeaseID); err != nil {
+			return "", err
+		}
+		cmd.PrintErrf("Revoked lease %s\n", cred.LeaseID)
+	}
+	return cred.Token, nil
+}
+
+// tokenInspection is the json and yaml output of token inspect.
+type tokenInspection struct {
+	Header       jwt.Header             `json:"header" yaml:"header"`
+	Claims       map[string]interface{} `json:"claims" yaml:"claims"`
+	Lifetime     tokenLifetime          `json:"lifetime" yaml:"lifetime"`
+	Verification tokenVerification      `json:"verification" yaml:"verification"`
+}
+
+type tokenVerification struct {
+	Verified bool   `json:"verified" yaml:"verified"`
+	Key      string `json:"key,omitempty" yaml:"key,omitempty"`
+	Error    string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type tokenLifetime struct {
+	IssuedAt  string `json:"issuedAt,omitempty" yaml:"issuedAt,omitempty"`
+	NotBefore string `json:"notBefore,omitempty" yaml:"notBefore,omitempty"`
+	ExpiresAt string `json:"expiresAt,omitempty" yaml:"expiresAt,omitempty"`
+	Remaining string `json:"remaining,omitempty" yaml:"remaining,omitempty"`
+	Expired   bool   `json:"expired" yaml:"expired"`
+}
+
+func newTokenInspection(token *jwt.Token, now time.Time) *tokenInspection {
+	out := &tokenInspection{Header: token.Header, Claims: token.Claims}
+	if iat, ok := numericClaim(token.Claims["iat"]); ok {
+		out.Lifetime.IssuedAt = time.Unix(iat, 0).UTC().Format(time.RFC3339)
+	}
+	if nbf, ok := numericClaim(token.Claims["nbf"]); ok {
+		out.Lifetime.NotBefore = time.Unix(nbf, 0).UTC().Format(time.RFC3339)
+	}
+	if exp, ok := numericClaim(token.Claims["exp"]); ok {
+		out.Lifetime.ExpiresAt = time.Unix(exp, 0).UTC().Format(time.RFC3339)
+		out.Lifetime.Remaining = remaining(exp, now)
+		out.Lifetime.Expired = exp <= now.Unix()
+	}
+	return out
+}
+
+func printTokenTable(cmd *cobra.Command, token *jwt.Token, out *tokenInspection) error {
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(w, "Header:")
+	_, _ = fmt.Fprintf(w, "  alg\t%s\n", token.Header.Alg)
+	if token.Header.Typ != "" {
+		_, _ = fmt.Fprintf(w, "  typ\t%s\n", token.Header.Typ)
+	}
+	if token.Header.Kid != "" {
+		_, _ = fmt.Fprintf(w, "  kid\t%s\n", token.Header.Kid)
+	}
+
+	_, _ = fmt.Fprintln(w, "Claims:")
+	names := make([]string, 0, len(token.Claims))
+	for name := range token.Claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, _ = fmt.Fprintf(w, "  %s\t%s\n", name, formatClaim(name, token.Claims[name]))
+	}
+
+	_, _ = fmt.Fprintln(w, "Lifetime:")
+	_, _ = fmt.Fprintf(w, "  Issued At\t%s\n", valueOrDefault(out.Lifetime.IssuedAt, "-"))
+	if out.Lifetime.NotBefore != "" {
+		_, _ = fmt.Fprintf(w, "  Not Before\t%s\n", out.Lifetime.NotBefore)
+	}
+	_, _ = fmt.Fprintf(w, "  Expires At\t%s\n", valueOrDefault(out.Lifetime.ExpiresAt, "-"))
+	_, _ = fmt.Fprintf(w, "  Remaining\t%s\n", valueOrDefault(out.Lifetime.Remaining, "-"))
+
+	_, _ = fmt.Fprintln(w, "Verification:")
+	if out.Verification.Verified {
+		_, _ = fmt.Fprintf(w, "  Signature\tverified with key %s\n", out.Verification.Key)
+	} else {
+		_, _ = fmt.Fprintf(w, "  Signature\t%s\n", out.Verification.Error)
+	}
+
+	return w.Flush()
+}
+
+// formatClaim renders time claims as "<value> (<RFC3339 time>)" and nested
+// values as compact JSON.
+func formatClaim(name string, value interface{}) string {
+	if n, ok := numericClaim(value); ok && timeClaims[name] {
+		return fmt.Sprintf("%d (%s)", n, time.Unix(n, 0).UTC().Format(time.RFC3339))
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+// yamlClaims converts the json.Number values of claims to YAML numbers, which
+// would otherwise be encoded as strings.
+func yamlClaims(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(v.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: v.String()}
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[key] = yamlClaims(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = yamlClaims(item)
+		}
+		return converted
+	default:
+		return v
+	}
+}
+
+func numericClaim(value interface{}) (int64, bool) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	i, err := n.Int64()
+	if err != nil {
+		f, err := n.Float64()
+		if err != nil {
+			return 0, false
+		}
+		i = int64(f)
+	}
+	return i, true
+}
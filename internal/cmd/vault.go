@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/efortin/kubectl-auth-vault/internal/cache"
+	"github.com/efortin/kubectl-auth-vault/internal/jwt"
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+// tokenLeeway tolerates clock skew between Vault and this host when
+// verifying the validity period of tokens.
+const tokenLeeway = time.Minute
+
+// vaultOptions are the Vault connection settings shared by the commands
+// talking to Vault. Flags and environment variables match the Vault CLI.
+type vaultOptions struct {
+	addr      string
+	namespace string
+
+	caCert        string
+	caPath        string
+	clientCert    string
+	clientKey     string
+	tlsServerName string
+	tlsSkipVerify bool
+
+	timeout    time.Duration
+	maxRetries int
+
+	flags *pflag.FlagSet
+}
+
+func (o *vaultOptions) addFlags(fs *pflag.FlagSet) {
+	o.flags = fs
+	fs.StringVar(&o.addr, "vault-addr", "", "Vault server address, or comma-separated addresses of several Vault clusters to fail over between (env: VAULT_ADDR)")
+	fs.StringVar(&o.namespace, "namespace", "", "Vault Enterprise namespace (env: VAULT_NAMESPACE)")
+	fs.StringVar(&o.caCert, "ca-cert", "", "PEM-encoded CA bundle used to verify Vault (env: VAULT_CACERT)")
+	fs.StringVar(&o.caPath, "ca-path", "", "Directory of PEM-encoded CA certificates used to verify Vault (env: VAULT_CAPATH)")
+	fs.StringVar(&o.clientCert, "client-cert", "", "PEM-encoded client certificate for TLS authentication to Vault (env: VAULT_CLIENT_CERT)")
+	fs.StringVar(&o.clientKey, "client-key", "", "PEM-encoded private key for the client certificate (env: VAULT_CLIENT_KEY)")
+	fs.StringVar(&o.tlsServerName, "tls-server-name", "", "Server name used for SNI and certificate verification (env: VAULT_TLS_SERVER_NAME)")
+	fs.BoolVar(&o.tlsSkipVerify, "tls-skip-verify", false, "Skip verification of the Vault server certificate (insecure, env: VAULT_SKIP_VERIFY)")
+	fs.DurationVar(&o.timeout, "timeout", vault.DefaultTimeout, "Total time allowed to get a credential from Vault, across all requests, retries and Vault nodes (env: VAULT_CLIENT_TIMEOUT)")
+	fs.IntVar(&o.maxRetries, "max-retries", vault.DefaultMaxRetries, "Number of retries of Vault requests failing with a network, 429 or 5xx error, 0 disables retries (env: VAULT_MAX_RETRIES)")
+}
+
+func (o *vaultOptions) resolvedAddr() string {
+	return flagOrEnv(o.addr, "VAULT_ADDR")
+}
+
+func (o *vaultOptions) resolvedNamespace() string {
+	return flagOrEnv(o.namespace, "VAULT_NAMESPACE")
+}
+
+func (o *vaultOptions) tlsConfig() (vault.TLSConfig, error) {
+	tls := vault.TLSConfig{
+		CACert:     flagOrEnv(o.caCert, "VAULT_CACERT"),
+		CAPath:     flagOrEnv(o.caPath, "VAULT_CAPATH"),
+		ClientCert: flagOrEnv(o.clientCert, "VAULT_CLIENT_CERT"),
+		ClientKey:  flagOrEnv(o.clientKey, "VAULT_CLIENT_KEY"),
+		ServerName: flagOrEnv(o.tlsServerName, "VAULT_TLS_SERVER_NAME"),
+		Insecure:   o.tlsSkipVerify,
+	}
+
+	if o.flags == nil || !o.flags.Changed("tls-skip-verify") {
+		if v := os.Getenv("VAULT_SKIP_VERIFY"); v != "" {
+			insecure, err := strconv.ParseBool(v)
+			if err != nil {
+				return vault.TLSConfig{}, fmt.Errorf("invalid VAULT_SKIP_VERIFY value %q: %w", v, err)
+			}
+			tls.Insecure = insecure
+		}
+	}
+
+	return tls, nil
+}
+
+// retryConfig returns the timeout and retry settings. Like the Vault CLI,
+// VAULT_CLIENT_TIMEOUT accepts a duration or a number of seconds.
+func (o *vaultOptions) retryConfig() (time.Duration, vault.RetryConfig, error) {
+	timeout, retry := o.timeout, vault.DefaultRetryConfig()
+	retry.MaxRetries = o.maxRetries
+
+	if o.flags == nil || !o.flags.Changed("timeout") {
+		if v := os.Getenv("VAULT_CLIENT_TIMEOUT"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				seconds, serr := strconv.Atoi(v)
+				if serr != nil {
+					return 0, vault.RetryConfig{}, fmt.Errorf("invalid VAULT_CLIENT_TIMEOUT value %q: %w", v, err)
+				}
+				d = time.Duration(seconds) * time.Second
+			}
+			timeout = d
+		}
+	}
+	if o.flags == nil || !o.flags.Changed("max-retries") {
+		if v := os.Getenv("VAULT_MAX_RETRIES"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return 0, vault.RetryConfig{}, fmt.Errorf("invalid VAULT_MAX_RETRIES value %q: %w", v, err)
+			}
+			retry.MaxRetries = n
+		}
+	}
+
+	if timeout <= 0 {
+		return 0, vault.RetryConfig{}, fmt.Errorf("--timeout must be positive")
+	}
+	if retry.MaxRetries < 0 {
+		return 0, vault.RetryConfig{}, fmt.Errorf("--max-retries must not be negative")
+	}
+
+	return timeout, retry, nil
+}
+
+// withDeadline bounds ctx by the timeout, so that getting a credential takes
+// at most that long in total, whatever the number of requests, retries and
+// Vault nodes involved.
+func (o *vaultOptions) withDeadline(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	timeout, _, err := o.retryConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
+
+func (o *vaultOptions) newClient() (*vault.Client, error) {
+	return o.newNamespaceClient(o.resolvedNamespace())
+}
+
+// newNamespaceClient returns a client sending requests to namespace instead
+// of the configured one.
+func (o *vaultOptions) newNamespaceClient(namespace string) (*vault.Client, error) {
+	addr := o.resolvedAddr()
+	if addr == "" {
+		return nil, fmt.Errorf("VAULT_ADDR is required (use --vault-addr or VAULT_ADDR env var)")
+	}
+
+	tls, err := o.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, retry, err := o.retryConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := vault.NewClient(addr,
+		vault.WithNamespace(namespace),
+		vault.WithTLS(tls),
+		vault.WithTimeout(timeout),
+		vault.WithRetry(retry),
+		vault.WithAddressStore(cache.NewAddressFile(cache.DefaultAddressFile(addr))),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vault client: %w", err)
+	}
+
+	return client, nil
+}
+
+// verifier returns a verifier checking tokens against the keys of the Vault
+// identity OIDC provider, cached per Vault server and namespace.
+func (o *vaultOptions) verifier(client *vault.Client) *jwt.Verifier {
+	return &jwt.Verifier{
+		Fetcher: client,
+		Cache:   cache.NewKeySetFile(cache.DefaultKeySetFile(client.Namespace(), o.resolvedAddr())),
+		Leeway:  tokenLeeway,
+	}
+}
+
+func flagOrEnv(value, envKey string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(envKey)
+}
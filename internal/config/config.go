@@ -0,0 +1,178 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNotFound is returned by Load when the config file does not exist.
+var ErrNotFound = errors.New("config file not found")
+
+// File is the plugin config file. It holds named profiles so kubeconfig
+// entries only need to reference a profile instead of repeating every flag.
+type File struct {
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// Profile holds the settings of a named profile. Keys match the command line
+// flags; unset values fall back to the flag defaults.
+type Profile struct {
+	VaultAddr        Addresses       `yaml:"vault-addr"`
+	Namespace        string          `yaml:"namespace"`
+	Source           string          `yaml:"source"`
+	TokenPath        string          `yaml:"token-path"`
+	Verify           *bool           `yaml:"verify"`
+	ExpectedAudience string          `yaml:"expected-audience"`
+	PKIRole          string          `yaml:"pki-role"`
+	PKICommonName    string          `yaml:"pki-common-name"`
+	PKITTL           string          `yaml:"pki-ttl"`
+	Timeout          string          `yaml:"timeout"`
+	MaxRetries       *int            `yaml:"max-retries"`
+	KubernetesCreds  KubernetesCreds `yaml:"kubernetes-creds"`
+	KV               KV              `yaml:"kv"`
+	Auth             Auth            `yaml:"auth"`
+	Cache            Cache           `yaml:"cache"`
+	TLS              TLS             `yaml:"tls"`
+}
+
+// Addresses are the addresses of the Vault clusters of a profile, written
+// either as a single (possibly comma-separated) string or as a list.
+type Addresses []string
+
+func (a *Addresses) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		var address string
+		if err := value.Decode(&address); err != nil {
+			return err
+		}
+		*a = Addresses{address}
+	case yaml.SequenceNode:
+		var addresses []string
+		if err := value.Decode(&addresses); err != nil {
+			return err
+		}
+		*a = addresses
+	default:
+		return fmt.Errorf("line %d: vault-addr must be a string or a list of strings", value.Line)
+	}
+	return nil
+}
+
+// String returns the addresses as a comma-separated list, as accepted by
+// --vault-addr.
+func (a Addresses) String() string {
+	return strings.Join(a, ",")
+}
+
+// KubernetesCreds selects a service account token generated by the Vault
+// Kubernetes secrets engine. Keys match the kubernetes-creds-* flags.
+type KubernetesCreds struct {
+	Role               string `yaml:"role"`
+	Namespace          string `yaml:"namespace"`
+	TTL                string `yaml:"ttl"`
+	ClusterRoleBinding *bool  `yaml:"cluster-role-binding"`
+}
+
+// KV selects a static token read from the Vault KV secrets engine. Keys
+// match the kv-* flags.
+type KV struct {
+	Path    string `yaml:"path"`
+	Field   string `yaml:"field"`
+	Version *int   `yaml:"version"`
+	TTL     string `yaml:"ttl"`
+}
+
+type Auth struct {
+	Method                  string `yaml:"method"`
+	AppRoleMount            string `yaml:"approle-mount"`
+	RoleID                  string `yaml:"role-id"`
+	RoleIDFile              string `yaml:"role-id-file"`
+	SecretIDFile            string `yaml:"secret-id-file"`
+	KubernetesMount         string `yaml:"kubernetes-mount"`
+	KubernetesRole          string `yaml:"kubernetes-role"`
+	ServiceAccountTokenPath string `yaml:"service-account-token-path"`
+	OIDCLogin               *bool  `yaml:"oidc-login"`
+	OIDCMount               string `yaml:"oidc-mount"`
+	OIDCRole                string `yaml:"oidc-role"`
+}
+
+type Cache struct {
+	File                 string `yaml:"file"`
+	Disabled             *bool  `yaml:"disabled"`
+	RefreshBefore        string `yaml:"refresh-before"`
+	RefreshBeforePercent *int   `yaml:"refresh-before-percent"`
+	LockTimeout          string `yaml:"lock-timeout"`
+	FailOnRefreshError   *bool  `yaml:"fail-on-refresh-error"`
+}
+
+type TLS struct {
+	CACert     string `yaml:"ca-cert"`
+	CAPath     string `yaml:"ca-path"`
+	ClientCert string `yaml:"client-cert"`
+	ClientKey  string `yaml:"client-key"`
+	ServerName string `yaml:"server-name"`
+	SkipVerify *bool  `yaml:"skip-verify"`
+}
+
+// DefaultPath returns $XDG_CONFIG_HOME/kubectl-auth-vault/config.yaml,
+// defaulting to ~/.config when XDG_CONFIG_HOME is not set.
+func DefaultPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			homeDir = os.TempDir()
+		}
+		dir = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(dir, "kubectl-auth-vault", "config.yaml")
+}
+
+// Load reads the config file at path. Unknown keys are rejected so typos do
+// not silently fall back to defaults.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var f File
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return &f, nil
+}
+
+// Profile returns the named profile.
+func (f *File) Profile(name string) (*Profile, error) {
+	p, ok := f.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found (available: %v)", name, f.ProfileNames())
+	}
+	return &p, nil
+}
+
+// ProfileNames returns the profile names in alphabetical order.
+func (f *File) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,148 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/config"
+)
+
+var _ = Describe("Config", func() {
+	var (
+		tmpDir     string
+		configFile string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "config-test")
+		Expect(err).NotTo(HaveOccurred())
+		configFile = filepath.Join(tmpDir, "config.yaml")
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(tmpDir)
+	})
+
+	Describe("Load", func() {
+		It("should parse profiles", func() {
+			Expect(os.WriteFile(configFile, []byte(`profiles:
+  prod:
+    vault-addr: https://vault.example.com
+    namespace: team-a
+    token-path: identity/oidc/token/prod
+    expected-audience: prod
+    pki-role: pki/issue/kubernetes
+    pki-ttl: 1h
+    kubernetes-creds:
+      role: kubernetes/creds/breakglass
+      namespace: default
+      cluster-role-binding: true
+    kv:
+      path: secret/clusters/legacy
+      version: 3
+    timeout: 10s
+    max-retries: 5
+    auth:
+      method: kubernetes
+      kubernetes-role: fleet
+    cache:
+      disabled: false
+      refresh-before: 5m
+      refresh-before-percent: 20
+    tls:
+      ca-cert: /etc/vault/ca.pem
+      skip-verify: true
+  dev:
+    vault-addr: http://127.0.0.1:8200
+`), 0600)).To(Succeed())
+
+			f, err := config.Load(configFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.ProfileNames()).To(Equal([]string{"dev", "prod"}))
+
+			p, err := f.Profile("prod")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.VaultAddr).To(Equal(config.Addresses{"https://vault.example.com"}))
+			Expect(p.Namespace).To(Equal("team-a"))
+			Expect(p.TokenPath).To(Equal("identity/oidc/token/prod"))
+			Expect(p.ExpectedAudience).To(Equal("prod"))
+			Expect(p.PKIRole).To(Equal("pki/issue/kubernetes"))
+			Expect(p.PKITTL).To(Equal("1h"))
+			Expect(p.KubernetesCreds.Role).To(Equal("kubernetes/creds/breakglass"))
+			Expect(p.KubernetesCreds.Namespace).To(Equal("default"))
+			Expect(p.KubernetesCreds.ClusterRoleBinding).To(HaveValue(BeTrue()))
+			Expect(p.KV.Path).To(Equal("secret/clusters/legacy"))
+			Expect(p.KV.Version).To(HaveValue(Equal(3)))
+			Expect(p.Timeout).To(Equal("10s"))
+			Expect(*p.MaxRetries).To(Equal(5))
+			Expect(p.Auth.Method).To(Equal("kubernetes"))
+			Expect(p.Auth.KubernetesRole).To(Equal("fleet"))
+			Expect(p.Cache.Disabled).To(HaveValue(BeFalse()))
+			Expect(p.Cache.RefreshBefore).To(Equal("5m"))
+			Expect(p.Cache.RefreshBeforePercent).To(HaveValue(Equal(20)))
+			Expect(p.Cache.LockTimeout).To(BeEmpty())
+			Expect(p.TLS.CACert).To(Equal("/etc/vault/ca.pem"))
+			Expect(p.TLS.SkipVerify).To(HaveValue(BeTrue()))
+		})
+
+		It("should accept a list of Vault addresses", func() {
+			Expect(os.WriteFile(configFile, []byte(`profiles:
+  prod:
+    vault-addr:
+    - https://vault.eu.example.com
+    - https://vault.us.example.com
+`), 0600)).To(Succeed())
+
+			f, err := config.Load(configFile)
+			Expect(err).NotTo(HaveOccurred())
+			p, err := f.Profile("prod")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.VaultAddr.String()).To(Equal("https://vault.eu.example.com,https://vault.us.example.com"))
+		})
+
+		It("should reject a vault-addr mapping", func() {
+			Expect(os.WriteFile(configFile, []byte("profiles:\n  prod:\n    vault-addr: {eu: https://vault.eu.example.com}\n"), 0600)).To(Succeed())
+			_, err := config.Load(configFile)
+			Expect(err).To(MatchError(ContainSubstring("vault-addr must be a string or a list of strings")))
+		})
+
+		It("should accept an empty file", func() {
+			Expect(os.WriteFile(configFile, nil, 0600)).To(Succeed())
+			f, err := config.Load(configFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.ProfileNames()).To(BeEmpty())
+		})
+
+		It("should return ErrNotFound for a missing file", func() {
+			_, err := config.Load(filepath.Join(tmpDir, "missing.yaml"))
+			Expect(errors.Is(err, config.ErrNotFound)).To(BeTrue())
+		})
+
+		It("should reject unknown keys", func() {
+			Expect(os.WriteFile(configFile, []byte("profiles:\n  prod:\n    vault-address: https://vault.example.com\n"), 0600)).To(Succeed())
+			_, err := config.Load(configFile)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("vault-address"))
+		})
+	})
+
+	Describe("Profile", func() {
+		It("should list the available profiles for an unknown profile", func() {
+			f := &config.File{Profiles: map[string]config.Profile{"dev": {}, "prod": {}}}
+			_, err := f.Profile("staging")
+			Expect(err).To(MatchError(ContainSubstring("[dev prod]")))
+		})
+	})
+
+	Describe("DefaultPath", func() {
+		It("should honor XDG_CONFIG_HOME", func() {
+			GinkgoT().Setenv("XDG_CONFIG_HOME", tmpDir)
+			Expect(config.DefaultPath()).To(Equal(filepath.Join(tmpDir, "kubectl-auth-vault", "config.yaml")))
+		})
+	})
+})
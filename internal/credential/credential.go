@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"time"
 )
 
 type ExecCredential struct {
@@ -12,23 +13,47 @@ type ExecCredential struct {
 	Status     ExecCredentialStatus `json:"status"`
 }
 
+// ExecCredentialStatus holds either a bearer token or a PEM-encoded client
+// certificate and key.
 type ExecCredentialStatus struct {
-	Token string `json:"token"`
+	Token                 string `json:"token,omitempty"`
+	ClientCertificateData string `json:"clientCertificateData,omitempty"`
+	ClientKeyData         string `json:"clientKeyData,omitempty"`
+	ExpirationTimestamp   string `json:"expirationTimestamp,omitempty"`
 }
 
-func New(token string) *ExecCredential {
-	return &ExecCredential{
-		APIVersion: "client.authentication.k8s.io/v1",
+// New builds an ExecCredential for the given token. exp is the token
+// expiration as a Unix timestamp; zero leaves expirationTimestamp unset.
+func New(token string, exp int64) *ExecCredential {
+	cred := &ExecCredential{
+		APIVersion: APIVersionV1,
 		Kind:       "ExecCredential",
 		Status: ExecCredentialStatus{
 			Token: token,
 		},
 	}
+	if exp > 0 {
+		cred.Status.ExpirationTimestamp = time.Unix(exp, 0).UTC().Format(time.RFC3339)
+	}
+	return cred
+}
+
+// NewClientCertificate builds an ExecCredential for the given PEM-encoded
+// client certificate and key, expiring at exp like New.
+func NewClientCertificate(certData, keyData string, exp int64) *ExecCredential {
+	cred := New("", exp)
+	cred.Status.ClientCertificateData = certData
+	cred.Status.ClientKeyData = keyData
+	return cred
+}
+
+func Output(w io.Writer, token string, exp int64) error {
+	return New(token, exp).Write(w)
 }
 
-func Output(w io.Writer, token string) error {
-	cred := New(token)
-	data, err := json.Marshal(cred)
+// Write writes the ExecCredential to w as a single JSON line.
+func (e *ExecCredential) Write(w io.Writer) error {
+	data, err := json.Marshal(e)
 	if err != nil {
 		return fmt.Errorf("failed to marshal ExecCredential: %w", err)
 	}
@@ -14,11 +14,34 @@ var _ = Describe("Credential", func() {
 	Describe("New", func() {
 		It("should create an ExecCredential with correct values", func() {
 			token := "test-token-12345"
-			cred := credential.New(token)
+			cred := credential.New(token, 0)
 
 			Expect(cred.APIVersion).To(Equal("client.authentication.k8s.io/v1"))
 			Expect(cred.Kind).To(Equal("ExecCredential"))
 			Expect(cred.Status.Token).To(Equal(token))
+			Expect(cred.Status.ExpirationTimestamp).To(BeEmpty())
+		})
+
+		It("should set expirationTimestamp in RFC3339 UTC", func() {
+			cred := credential.New("test-token", 1700000000)
+			Expect(cred.Status.ExpirationTimestamp).To(Equal("2023-11-14T22:13:20Z"))
+		})
+	})
+
+	Describe("NewClientCertificate", func() {
+		It("should hold the client certificate and key instead of a token", func() {
+			var buf bytes.Buffer
+			Expect(credential.NewClientCertificate("cert-pem", "key-pem", 1700000000).Write(&buf)).To(Succeed())
+
+			var cred struct {
+				Status map[string]interface{} `json:"status"`
+			}
+			Expect(json.Unmarshal(buf.Bytes(), &cred)).To(Succeed())
+			Expect(cred.Status).To(Equal(map[string]interface{}{
+				"clientCertificateData": "cert-pem",
+				"clientKeyData":         "key-pem",
+				"expirationTimestamp":   "2023-11-14T22:13:20Z",
+			}))
 		})
 	})
 
@@ -27,7 +50,7 @@ var _ = Describe("Credential", func() {
 			token := "test-token-12345"
 			var buf bytes.Buffer
 
-			err := credential.Output(&buf, token)
+			err := credential.Output(&buf, token, 0)
 			Expect(err).NotTo(HaveOccurred())
 
 			var cred credential.ExecCredential
@@ -38,9 +61,23 @@ var _ = Describe("Credential", func() {
 			Expect(cred.Status.Token).To(Equal(token))
 		})
 
+		It("should include expirationTimestamp when exp is known", func() {
+			var buf bytes.Buffer
+			err := credential.Output(&buf, "test-token", 1700000000)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring(`"expirationTimestamp":"2023-11-14T22:13:20Z"`))
+		})
+
+		It("should omit expirationTimestamp when exp is unknown", func() {
+			var buf bytes.Buffer
+			err := credential.Output(&buf, "test-token", 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).NotTo(ContainSubstring("expirationTimestamp"))
+		})
+
 		It("should handle empty token", func() {
 			var buf bytes.Buffer
-			err := credential.Output(&buf, "")
+			err := credential.Output(&buf, "", 0)
 			Expect(err).NotTo(HaveOccurred())
 
 			var cred credential.ExecCredential
@@ -52,7 +89,7 @@ var _ = Describe("Credential", func() {
 
 	Describe("JSON", func() {
 		It("should return valid JSON bytes", func() {
-			cred := credential.New("test-token")
+			cred := credential.New("test-token", 0)
 			data, err := cred.JSON()
 			Expect(err).NotTo(HaveOccurred())
 
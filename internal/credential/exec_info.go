@@ -0,0 +1,111 @@
+package credential
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	// APIVersionV1 is the client.authentication.k8s.io/v1 ExecCredential version.
+	APIVersionV1 = "client.authentication.k8s.io/v1"
+	// APIVersionV1Beta1 is the client.authentication.k8s.io/v1beta1 ExecCredential version.
+	APIVersionV1Beta1 = "client.authentication.k8s.io/v1beta1"
+
+	// ExecInfoEnv is the environment variable client-go uses to pass the
+	// ExecCredential request to the plugin.
+	ExecInfoEnv = "KUBERNETES_EXEC_INFO"
+)
+
+// ExecInfo is the ExecCredential request passed by client-go in KUBERNETES_EXEC_INFO.
+type ExecInfo struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Spec       ExecCredentialSpec `json:"spec"`
+}
+
+// ExecCredentialSpec holds the request-specific fields of an ExecCredential.
+type ExecCredentialSpec struct {
+	// Cluster is only set when provideClusterInfo is enabled in the kubeconfig.
+	Cluster     *Cluster `json:"cluster,omitempty"`
+	Interactive bool     `json:"interactive"`
+}
+
+// Cluster describes the cluster the credential is requested for.
+type Cluster struct {
+	Server                   string          `json:"server"`
+	TLSServerName            string          `json:"tls-server-name,omitempty"`
+	InsecureSkipTLSVerify    bool            `json:"insecure-skip-tls-verify,omitempty"`
+	CertificateAuthorityData []byte          `json:"certificate-authority-data,omitempty"`
+	ProxyURL                 string          `json:"proxy-url,omitempty"`
+	DisableCompression       bool            `json:"disable-compression,omitempty"`
+	Config                   json.RawMessage `json:"config,omitempty"`
+}
+
+// clusterConfig is the plugin configuration set in the
+// client.authentication.k8s.io/exec extension of the kubeconfig cluster.
+type clusterConfig struct {
+	Audience string `json:"audience"`
+}
+
+// Audience returns the token audience the cluster expects, set as
+// "audience" in the client.authentication.k8s.io/exec extension of the
+// kubeconfig cluster. It returns an empty string when it is not set.
+func (c *Cluster) Audience() (string, error) {
+	if c == nil || len(c.Config) == 0 || string(c.Config) == "null" {
+		return "", nil
+	}
+
+	var config clusterConfig
+	if err := json.Unmarshal(c.Config, &config); err != nil {
+		return "", fmt.Errorf("failed to parse the cluster config in %s: %w", ExecInfoEnv, err)
+	}
+	return config.Audience, nil
+}
+
+// ExecInfoFromEnv parses the KUBERNETES_EXEC_INFO environment variable.
+func ExecInfoFromEnv() (*ExecInfo, error) {
+	return ParseExecInfo(os.Getenv(ExecInfoEnv))
+}
+
+// ParseExecInfo parses an ExecCredential request. An empty input yields a
+// non-interactive v1 request, which is what older clients implicitly expect.
+func ParseExecInfo(data string) (*ExecInfo, error) {
+	if data == "" {
+		return &ExecInfo{APIVersion: APIVersionV1, Kind: "ExecCredential"}, nil
+	}
+
+	var info ExecInfo
+	if err := json.Unmarshal([]byte(data), &info); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ExecInfoEnv, err)
+	}
+
+	if info.Kind != "" && info.Kind != "ExecCredential" {
+		return nil, fmt.Errorf("unexpected kind %q in %s", info.Kind, ExecInfoEnv)
+	}
+
+	switch info.APIVersion {
+	case APIVersionV1, APIVersionV1Beta1:
+	default:
+		return nil, fmt.Errorf("unsupported ExecCredential apiVersion %q (supported: %s, %s)",
+			info.APIVersion, APIVersionV1, APIVersionV1Beta1)
+	}
+
+	return &info, nil
+}
+
+// NewCredential builds an ExecCredential answering this request, echoing back
+// the requested apiVersion.
+func (i *ExecInfo) NewCredential(token string, exp int64) *ExecCredential {
+	cred := New(token, exp)
+	cred.APIVersion = i.APIVersion
+	return cred
+}
+
+// NewClientCertificateCredential builds an ExecCredential with a client
+// certificate answering this request, echoing back the requested apiVersion.
+func (i *ExecInfo) NewClientCertificateCredential(certData, keyData string, exp int64) *ExecCredential {
+	cred := NewClientCertificate(certData, keyData, exp)
+	cred.APIVersion = i.APIVersion
+	return cred
+}
@@ -0,0 +1,108 @@
+package credential_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/credential"
+)
+
+var _ = Describe("ExecInfo", func() {
+	Describe("ParseExecInfo", func() {
+		Context("with an empty input", func() {
+			It("should default to a non-interactive v1 request", func() {
+				info, err := credential.ParseExecInfo("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.APIVersion).To(Equal(credential.APIVersionV1))
+				Expect(info.Spec.Interactive).To(BeFalse())
+				Expect(info.Spec.Cluster).To(BeNil())
+			})
+		})
+
+		Context("with a v1beta1 request", func() {
+			It("should keep the requested apiVersion", func() {
+				info, err := credential.ParseExecInfo(`{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential","spec":{"interactive":true}}`)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.APIVersion).To(Equal(credential.APIVersionV1Beta1))
+				Expect(info.Spec.Interactive).To(BeTrue())
+			})
+		})
+
+		Context("with cluster info", func() {
+			It("should parse the cluster fields", func() {
+				info, err := credential.ParseExecInfo(`{
+					"apiVersion": "client.authentication.k8s.io/v1",
+					"kind": "ExecCredential",
+					"spec": {
+						"interactive": false,
+						"cluster": {
+							"server": "https://k8s.example.com",
+							"tls-server-name": "k8s.internal",
+							"certificate-authority-data": "Y2EtZGF0YQ==",
+							"config": {"audience": "prod"}
+						}
+					}
+				}`)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Spec.Cluster).NotTo(BeNil())
+				Expect(info.Spec.Cluster.Server).To(Equal("https://k8s.example.com"))
+				Expect(info.Spec.Cluster.TLSServerName).To(Equal("k8s.internal"))
+				Expect(string(info.Spec.Cluster.CertificateAuthorityData)).To(Equal("ca-data"))
+				Expect(string(info.Spec.Cluster.Config)).To(MatchJSON(`{"audience": "prod"}`))
+			})
+		})
+
+		Context("with an unsupported apiVersion", func() {
+			It("should return an error", func() {
+				_, err := credential.ParseExecInfo(`{"apiVersion":"client.authentication.k8s.io/v1alpha1","kind":"ExecCredential"}`)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("unsupported ExecCredential apiVersion"))
+			})
+		})
+
+		Context("with an unexpected kind", func() {
+			It("should return an error", func() {
+				_, err := credential.ParseExecInfo(`{"apiVersion":"client.authentication.k8s.io/v1","kind":"Pod"}`)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("with invalid JSON", func() {
+			It("should return an error", func() {
+				_, err := credential.ParseExecInfo("not json")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("NewCredential", func() {
+		It("should echo back the requested apiVersion", func() {
+			info, err := credential.ParseExecInfo(`{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential"}`)
+			Expect(err).NotTo(HaveOccurred())
+
+			cred := info.NewCredential("test-token", 0)
+			Expect(cred.APIVersion).To(Equal(credential.APIVersionV1Beta1))
+			Expect(cred.Kind).To(Equal("ExecCredential"))
+			Expect(cred.Status.Token).To(Equal("test-token"))
+		})
+	})
+
+	Describe("Cluster.Audience", func() {
+		It("should return the audience of the cluster config", func() {
+			cluster := &credential.Cluster{Config: []byte(`{"audience": "prod", "other": true}`)}
+			Expect(cluster.Audience()).To(Equal("prod"))
+		})
+
+		It("should return an empty audience without cluster config", func() {
+			var cluster *credential.Cluster
+			Expect(cluster.Audience()).To(BeEmpty())
+			Expect((&credential.Cluster{Server: "https://k8s.example.com"}).Audience()).To(BeEmpty())
+		})
+
+		It("should fail on an invalid cluster config", func() {
+			cluster := &credential.Cluster{Config: []byte(`["prod"]`)}
+			_, err := cluster.Audience()
+			Expect(err).To(MatchError(ContainSubstring("failed to parse the cluster config")))
+		})
+	})
+})
@@ -1,6 +1,7 @@
 package jwt
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -8,10 +9,75 @@ import (
 )
 
 type Payload struct {
-	Exp int64  `json:"exp"`
-	Iat int64  `json:"iat"`
-	Iss string `json:"iss"`
-	Sub string `json:"sub"`
+	Exp int64    `json:"exp"`
+	Iat int64    `json:"iat"`
+	Nbf int64    `json:"nbf,omitempty"`
+	Iss string   `json:"iss"`
+	Sub string   `json:"sub"`
+	Aud Audience `json:"aud,omitempty"`
+
+	// audErr records a malformed aud claim, reported by ValidateAudience
+	// only, so that tokens whose audience is not checked still decode.
+	audErr error
+}
+
+func (p *Payload) UnmarshalJSON(data []byte) error {
+	type plain Payload
+	var raw struct {
+		plain
+		Aud json.RawMessage `json:"aud"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*p = Payload(raw.plain)
+	p.Aud, p.audErr = nil, nil
+	if len(raw.Aud) > 0 {
+		p.audErr = json.Unmarshal(raw.Aud, &p.Aud)
+	}
+	return nil
+}
+
+// Audience is the aud claim. RFC 7519 allows either a single string or an
+// array of strings; a single audience is encoded back as a string.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	if string(bytes.TrimSpace(data)) == "null" {
+		*a = nil
+		return nil
+	}
+
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("aud claim must be a string or an array of strings")
+	}
+	*a = multiple
+	return nil
+}
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// Contains reports whether aud is one of the audiences.
+func (a Audience) Contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
 }
 
 func ExtractExp(token string) (int64, error) {
@@ -33,17 +99,9 @@ func DecodePayload(token string) (*Payload, error) {
 		return nil, fmt.Errorf("invalid JWT format: expected 3 parts, got %d", len(parts))
 	}
 
-	payloadB64 := parts[1]
-	if l := len(payloadB64) % 4; l != 0 {
-		payloadB64 += strings.Repeat("=", 4-l)
-	}
-
-	decoded, err := base64.URLEncoding.DecodeString(payloadB64)
+	decoded, err := decodeSegment(parts[1])
 	if err != nil {
-		decoded, err = base64.StdEncoding.DecodeString(payloadB64)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode JWT payload: %w", err)
-		}
+		return nil, fmt.Errorf("failed to decode JWT payload: %w", err)
 	}
 
 	var payload Payload
@@ -53,3 +111,72 @@ func DecodePayload(token string) (*Payload, error) {
 
 	return &payload, nil
 }
+
+// Header is the JOSE header of a JWT.
+type Header struct {
+	Alg string `json:"alg" yaml:"alg"`
+	Typ string `json:"typ,omitempty" yaml:"typ,omitempty"`
+	Kid string `json:"kid,omitempty" yaml:"kid,omitempty"`
+}
+
+// Token is a decoded JWT. Claims holds every claim of the payload, including
+// custom claims from Vault identity token templates; numbers are kept as
+// json.Number so large values round-trip exactly.
+type Token struct {
+	Header    Header
+	Claims    map[string]interface{}
+	Payload   Payload
+	Signature []byte
+
+	signingInput string
+}
+
+// Decode decodes the header, claims and signature of token without verifying it.
+func Decode(token string) (*Token, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid JWT format: expected 3 parts, got %d", len(parts))
+	}
+
+	headerJSON, err := decodeSegment(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode JWT header: %w", err)
+	}
+	t := Token{signingInput: parts[0] + "." + parts[1]}
+	if err := json.Unmarshal(headerJSON, &t.Header); err != nil {
+		return nil, fmt.Errorf("failed to parse JWT header: %w", err)
+	}
+
+	payloadJSON, err := decodeSegment(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode JWT payload: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payloadJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&t.Claims); err != nil {
+		return nil, fmt.Errorf("failed to parse JWT payload: %w", err)
+	}
+	if err := json.Unmarshal(payloadJSON, &t.Payload); err != nil {
+		return nil, fmt.Errorf("failed to parse JWT payload: %w", err)
+	}
+
+	if t.Signature, err = decodeSegment(parts[2]); err != nil {
+		return nil, fmt.Errorf("failed to decode JWT signature: %w", err)
+	}
+
+	return &t, nil
+}
+
+// decodeSegment decodes a base64url JWT segment, tolerating padding and the
+// standard alphabet.
+func decodeSegment(segment string) ([]byte, error) {
+	if l := len(segment) % 4; l != 0 {
+		segment += strings.Repeat("=", 4-l)
+	}
+
+	decoded, err := base64.URLEncoding.DecodeString(segment)
+	if err != nil {
+		decoded, err = base64.StdEncoding.DecodeString(segment)
+	}
+	return decoded, err
+}
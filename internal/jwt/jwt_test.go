@@ -85,6 +85,46 @@ var _ = Describe("JWT", func() {
 			})
 		})
 
+		Context("with an aud claim", func() {
+			It("should accept a single audience", func() {
+				payload, err := jwt.DecodePayload(createTestJWT(jwt.Payload{Exp: 1, Aud: jwt.Audience{"kube"}}))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(payload.Aud).To(Equal(jwt.Audience{"kube"}))
+			})
+
+			It("should accept several audiences", func() {
+				payload, err := jwt.DecodePayload(createTestJWT(jwt.Payload{Exp: 1, Aud: jwt.Audience{"kube", "other"}}))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(payload.Aud).To(Equal(jwt.Audience{"kube", "other"}))
+				Expect(payload.Aud.Contains("other")).To(BeTrue())
+				Expect(payload.Aud.Contains("staging")).To(BeFalse())
+			})
+
+			It("should encode a single audience as a string", func() {
+				data, err := json.Marshal(jwt.Payload{Aud: jwt.Audience{"kube"}})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(data)).To(ContainSubstring(`"aud":"kube"`))
+			})
+
+			It("should decode a null aud claim as no audience", func() {
+				payload := base64.RawURLEncoding.EncodeToString([]byte(`{"exp": 1, "aud": null}`))
+				result, err := jwt.DecodePayload("header." + payload + ".sig")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Aud).To(BeEmpty())
+			})
+
+			It("should decode a token with an aud claim of another type", func() {
+				payload := base64.RawURLEncoding.EncodeToString([]byte(`{"exp": 1, "aud": 42}`))
+				result, err := jwt.DecodePayload("header." + payload + ".sig")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Exp).To(Equal(int64(1)))
+
+				err = result.ValidateAudience("kube")
+				Expect(err).To(MatchError(jwt.ErrInvalidToken))
+				Expect(err).To(MatchError(ContainSubstring("aud claim")))
+			})
+		})
+
 		Context("with standard base64 encoding", func() {
 			It("should handle standard base64 encoded payload", func() {
 				payload := jwt.Payload{Exp: 1234567890}
@@ -107,4 +147,42 @@ var _ = Describe("JWT", func() {
 			})
 		})
 	})
+
+	Describe("Decode", func() {
+		It("should decode the header and all claims", func() {
+			header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","kid":"key-1"}`))
+			payload := base64.RawURLEncoding.EncodeToString([]byte(`{
+				"exp": 1234567890,
+				"iat": 1234567800,
+				"aud": ["kube", "other"],
+				"groups": ["admins"],
+				"namespace": {"id": "root", "path": ""},
+				"big": 12345678901234567890
+			}`))
+			signature := base64.RawURLEncoding.EncodeToString([]byte("sig"))
+
+			token, err := jwt.Decode(header + "." + payload + "." + signature)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token.Header).To(Equal(jwt.Header{Alg: "ES256", Kid: "key-1"}))
+			Expect(token.Payload.Exp).To(Equal(int64(1234567890)))
+			Expect(token.Claims).To(HaveKeyWithValue("exp", json.Number("1234567890")))
+			Expect(token.Claims).To(HaveKeyWithValue("big", json.Number("12345678901234567890")))
+			Expect(token.Claims).To(HaveKeyWithValue("aud", []interface{}{"kube", "other"}))
+			Expect(token.Claims).To(HaveKeyWithValue("namespace", map[string]interface{}{"id": "root", "path": ""}))
+			Expect(token.Signature).To(Equal([]byte("sig")))
+		})
+
+		It("should reject an invalid header", func() {
+			payload := base64.RawURLEncoding.EncodeToString([]byte(`{"exp": 1}`))
+			_, err := jwt.Decode("!!!." + payload + ".sig")
+			Expect(err).To(MatchError(ContainSubstring("JWT header")))
+		})
+
+		It("should reject a payload that is not an object", func() {
+			header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`))
+			payload := base64.RawURLEncoding.EncodeToString([]byte(`[1, 2]`))
+			_, err := jwt.Decode(header + "." + payload + ".sig")
+			Expect(err).To(MatchError(ContainSubstring("JWT payload")))
+		})
+	})
 })
@@ -0,0 +1,250 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	_ "crypto/sha256" // hash implementations used by signature verification
+	_ "crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// ErrInvalidToken is returned by Verify when the token signature or claims
+// are not valid.
+var ErrInvalidToken = errors.New("invalid token")
+
+// KeySetFetcher fetches the key set of the issuer from its provider.
+type KeySetFetcher interface {
+	FetchKeySet(ctx context.Context) (*KeySet, error)
+}
+
+// KeySetCache persists a key set between invocations.
+type KeySetCache interface {
+	LoadKeySet() (*KeySet, error)
+	SaveKeySet(keys *KeySet) error
+}
+
+// DefaultKeySetMaxAge is how long a key set is trusted after it was fetched
+// when Verifier.MaxAge is zero.
+const DefaultKeySetMaxAge = 24 * time.Hour
+
+// DefaultKeySetMinRefreshInterval is how long after a key set was fetched a
+// token signed by an unknown key is rejected without fetching it again, when
+// Verifier.MinRefreshInterval is zero.
+const DefaultKeySetMinRefreshInterval = time.Minute
+
+// Verifier verifies token signatures against the key set of the issuer. The
+// key set is loaded from Cache when set, and fetched again when a token is
+// signed by an unknown key, so key rotations are picked up, or when it is
+// older than MaxAge, so keys removed by the issuer stop being trusted. A key
+// set fetched less than MinRefreshInterval ago is not fetched again for an
+// unknown key, so that bogus tokens do not each cost a request to the issuer.
+type Verifier struct {
+	Fetcher KeySetFetcher
+	Cache   KeySetCache
+
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+	// MaxAge defaults to DefaultKeySetMaxAge.
+	MaxAge time.Duration
+	// MinRefreshInterval defaults to DefaultKeySetMinRefreshInterval.
+	MinRefreshInterval time.Duration
+
+	keys *KeySet
+}
+
+// Verify decodes token and checks its signature, issuer and validity period.
+func (v *Verifier) Verify(ctx context.Context, token string, now time.Time) (*Token, error) {
+	t, err := Decode(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if _, err := v.VerifySignature(ctx, t); err != nil {
+		return nil, err
+	}
+	if err := t.Payload.Validate(now, v.Leeway); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// VerifySignature checks the signature and issuer of t and returns the key
+// that signed it.
+func (v *Verifier) VerifySignature(ctx context.Context, t *Token) (*JSONWebKey, error) {
+	keys, err := v.keySet(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	key := keys.Key(t.Header.Kid)
+	if key == nil && !v.recentlyFetched(keys, time.Now()) {
+		// The issuer may have rotated its keys since the key set was cached.
+		if keys, err = v.keySet(ctx, true); err != nil {
+			return nil, err
+		}
+		key = keys.Key(t.Header.Kid)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w: signing key %q not found in the issuer key set", ErrInvalidToken, t.Header.Kid)
+	}
+
+	if err := verifySignature(t, key); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if keys.Issuer != "" && t.Payload.Iss != keys.Issuer {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ErrInvalidToken, t.Payload.Iss, keys.Issuer)
+	}
+
+	return key, nil
+}
+
+// Validate checks that the token is valid at now: exp is required and must
+// be in the future, nbf must not be in the future.
+func (p *Payload) Validate(now time.Time, leeway time.Duration) error {
+	if p.Exp == 0 {
+		return fmt.Errorf("%w: no exp claim", ErrInvalidToken)
+	}
+	if now.Add(-leeway).Unix() >= p.Exp {
+		return fmt.Errorf("%w: expired at %s", ErrInvalidToken, time.Unix(p.Exp, 0).UTC().Format(time.RFC3339))
+	}
+	if p.Nbf != 0 && now.Add(leeway).Unix() < p.Nbf {
+		return fmt.Errorf("%w: not valid before %s", ErrInvalidToken, time.Unix(p.Nbf, 0).UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// ValidateAudience checks that aud is one of the audiences of the token.
+func (p *Payload) ValidateAudience(aud string) error {
+	if p.audErr != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidToken, p.audErr)
+	}
+	if !p.Aud.Contains(aud) {
+		if len(p.Aud) == 0 {
+			return fmt.Errorf("%w: no aud claim, expected %q", ErrInvalidToken, aud)
+		}
+		return fmt.Errorf("%w: audience %q does not include %q", ErrInvalidToken, []string(p.Aud), aud)
+	}
+	return nil
+}
+
+// keySet returns the current key set, fetching it from the provider when it
+// is not known yet, too old or refresh is set.
+func (v *Verifier) keySet(ctx context.Context, refresh bool) (*KeySet, error) {
+	now := time.Now()
+	if !refresh {
+		if v.keys != nil && v.fresh(v.keys, now) {
+			return v.keys, nil
+		}
+		if v.Cache != nil {
+			if keys, err := v.Cache.LoadKeySet(); err == nil && v.fresh(keys, now) {
+				v.keys = keys
+				return keys, nil
+			}
+		}
+	}
+
+	keys, err := v.Fetcher.FetchKeySet(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the issuer key set: %w", err)
+	}
+	keys.FetchedAt = now.Unix()
+	v.keys = keys
+
+	if v.Cache != nil {
+		// A key set that cannot be cached is fetched again next time.
+		_ = v.Cache.SaveKeySet(keys)
+	}
+
+	return keys, nil
+}
+
+// fresh reports whether keys were fetched less than MaxAge before now. Key
+// sets cached without a fetch time are never fresh.
+func (v *Verifier) fresh(keys *KeySet, now time.Time) bool {
+	maxAge := v.MaxAge
+	if maxAge == 0 {
+		maxAge = DefaultKeySetMaxAge
+	}
+	return keys.FetchedAt > 0 && now.Sub(time.Unix(keys.FetchedAt, 0)) < maxAge
+}
+
+// recentlyFetched reports whether keys were fetched less than
+// MinRefreshInterval before now. The fetch time is cached along with the key
+// set, so this holds across invocations.
+func (v *Verifier) recentlyFetched(keys *KeySet, now time.Time) bool {
+	interval := v.MinRefreshInterval
+	if interval == 0 {
+		interval = DefaultKeySetMinRefreshInterval
+	}
+	return keys.FetchedAt > 0 && now.Sub(time.Unix(keys.FetchedAt, 0)) < interval
+}
+
+func verifySignature(t *Token, key *JSONWebKey) error {
+	if key.Alg != "" && key.Alg != t.Header.Alg {
+		return fmt.Errorf("token algorithm %q does not match key algorithm %q", t.Header.Alg, key.Alg)
+	}
+
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		return err
+	}
+
+	var hash crypto.Hash
+	switch t.Header.Alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+	default:
+		return fmt.Errorf("unsupported algorithm %q", t.Header.Alg)
+	}
+
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		if t.Header.Alg[:2] != "RS" {
+			break
+		}
+		h := hash.New()
+		h.Write([]byte(t.signingInput))
+		if err := rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), t.Signature); err != nil {
+			return errors.New("signature verification failed")
+		}
+		return nil
+
+	case *ecdsa.PublicKey:
+		if t.Header.Alg[:2] != "ES" {
+			break
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(t.Signature) != 2*size {
+			return errors.New("signature verification failed")
+		}
+		h := hash.New()
+		h.Write([]byte(t.signingInput))
+		r := new(big.Int).SetBytes(t.Signature[:size])
+		s := new(big.Int).SetBytes(t.Signature[size:])
+		if !ecdsa.Verify(pub, h.Sum(nil), r, s) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+
+	case ed25519.PublicKey:
+		if t.Header.Alg != "EdDSA" {
+			break
+		}
+		if !ed25519.Verify(pub, []byte(t.signingInput), t.Signature) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("algorithm %q cannot be used with %s key %q", t.Header.Alg, key.Kty, key.Kid)
+}
@@ -0,0 +1,337 @@
+package jwt_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/jwt"
+)
+
+const testIssuer = "https://vault.example.com/v1/identity/oidc"
+
+type testKey struct {
+	alg     string
+	private crypto.Signer
+	jwk     jwt.JSONWebKey
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func newRSAKey(kid string) *testKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).NotTo(HaveOccurred())
+	return &testKey{alg: "RS256", private: key, jwk: jwt.JSONWebKey{
+		Kty: "RSA", Kid: kid, Alg: "RS256", Use: "sig",
+		N: b64(key.N.Bytes()), E: b64(big.NewInt(int64(key.E)).Bytes()),
+	}}
+}
+
+func newECKey(kid string) *testKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	return &testKey{alg: "ES256", private: key, jwk: jwt.JSONWebKey{
+		Kty: "EC", Kid: kid, Alg: "ES256", Crv: "P-256",
+		X: b64(key.X.FillBytes(make([]byte, 32))), Y: b64(key.Y.FillBytes(make([]byte, 32))),
+	}}
+}
+
+func newEd25519Key(kid string) *testKey {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	return &testKey{alg: "EdDSA", private: key, jwk: jwt.JSONWebKey{
+		Kty: "OKP", Kid: kid, Alg: "EdDSA", Crv: "Ed25519", X: b64(pub),
+	}}
+}
+
+func (k *testKey) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(jwt.Header{Alg: k.alg, Kid: k.jwk.Kid})
+	payload, _ := json.Marshal(claims)
+	signingInput := b64(header) + "." + b64(payload)
+
+	var signature []byte
+	switch key := k.private.(type) {
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signingInput))
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		Expect(err).NotTo(HaveOccurred())
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signingInput))
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		Expect(err).NotTo(HaveOccurred())
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, []byte(signingInput))
+	}
+
+	return signingInput + "." + b64(signature)
+}
+
+func validClaims() map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss": testIssuer,
+		"sub": "entity-1",
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+}
+
+type fakeFetcher struct {
+	keys  []*jwt.KeySet
+	calls int
+}
+
+func (f *fakeFetcher) FetchKeySet(ctx context.Context) (*jwt.KeySet, error) {
+	if f.calls >= len(f.keys) {
+		return nil, errors.New("unavailable")
+	}
+	f.calls++
+	return f.keys[f.calls-1], nil
+}
+
+type memoryCache struct {
+	keys  *jwt.KeySet
+	saves int
+}
+
+func (c *memoryCache) LoadKeySet() (*jwt.KeySet, error) {
+	if c.keys == nil {
+		return nil, errors.New("not cached")
+	}
+	return c.keys, nil
+}
+
+func (c *memoryCache) SaveKeySet(keys *jwt.KeySet) error {
+	c.keys = keys
+	c.saves++
+	return nil
+}
+
+func keySet(keys ...*testKey) *jwt.KeySet {
+	set := &jwt.KeySet{Issuer: testIssuer}
+	for _, k := range keys {
+		set.Keys = append(set.Keys, k.jwk)
+	}
+	return set
+}
+
+var _ = Describe("Verifier", func() {
+	var (
+		rsaKey   *testKey
+		ecKey    *testKey
+		edKey    *testKey
+		fetcher  *fakeFetcher
+		verifier *jwt.Verifier
+	)
+
+	BeforeEach(func() {
+		rsaKey, ecKey, edKey = newRSAKey("rsa-1"), newECKey("ec-1"), newEd25519Key("ed-1")
+		fetcher = &fakeFetcher{keys: []*jwt.KeySet{keySet(rsaKey, ecKey, edKey)}}
+		verifier = &jwt.Verifier{Fetcher: fetcher}
+	})
+
+	DescribeTable("should verify signatures",
+		func(key func() *testKey) {
+			token, err := verifier.Verify(context.Background(), key().sign(validClaims()), time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token.Payload.Sub).To(Equal("entity-1"))
+		},
+		Entry("RS256", func() *testKey { return rsaKey }),
+		Entry("ES256", func() *testKey { return ecKey }),
+		Entry("EdDSA", func() *testKey { return edKey }),
+	)
+
+	It("should reject a tampered payload", func() {
+		parts := strings.Split(rsaKey.sign(validClaims()), ".")
+		claims := validClaims()
+		claims["sub"] = "someone-else"
+		payload, _ := json.Marshal(claims)
+		parts[1] = b64(payload)
+
+		_, err := verifier.Verify(context.Background(), strings.Join(parts, "."), time.Now())
+		Expect(errors.Is(err, jwt.ErrInvalidToken)).To(BeTrue())
+	})
+
+	It("should reject a token signed with a key of another type", func() {
+		parts := strings.Split(ecKey.sign(validClaims()), ".")
+		header, _ := json.Marshal(jwt.Header{Alg: "RS256", Kid: "ec-1"})
+		parts[0] = b64(header)
+
+		_, err := verifier.Verify(context.Background(), strings.Join(parts, "."), time.Now())
+		Expect(errors.Is(err, jwt.ErrInvalidToken)).To(BeTrue())
+	})
+
+	It("should reject another issuer", func() {
+		claims := validClaims()
+		claims["iss"] = "https://attacker.example.com"
+		_, err := verifier.Verify(context.Background(), rsaKey.sign(claims), time.Now())
+		Expect(err).To(MatchError(ContainSubstring("issuer")))
+	})
+
+	It("should reject an expired token", func() {
+		claims := validClaims()
+		claims["exp"] = time.Now().Add(-2 * time.Minute).Unix()
+		_, err := verifier.Verify(context.Background(), rsaKey.sign(claims), time.Now())
+		Expect(err).To(MatchError(ContainSubstring("expired")))
+	})
+
+	It("should reject a token that is not valid yet", func() {
+		claims := validClaims()
+		claims["nbf"] = time.Now().Add(10 * time.Minute).Unix()
+		_, err := verifier.Verify(context.Background(), rsaKey.sign(claims), time.Now())
+		Expect(err).To(MatchError(ContainSubstring("not valid before")))
+	})
+
+	It("should tolerate clock skew within the leeway", func() {
+		verifier.Leeway = time.Minute
+		claims := validClaims()
+		claims["nbf"] = time.Now().Add(30 * time.Second).Unix()
+		_, err := verifier.Verify(context.Background(), rsaKey.sign(claims), time.Now())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should fetch the key set again when the signing key is unknown", func() {
+		rotated := newRSAKey("rsa-2")
+		keyCache := &memoryCache{keys: keySet(rsaKey)}
+		keyCache.keys.FetchedAt = time.Now().Add(-time.Hour).Unix()
+		verifier.Cache = keyCache
+		fetcher.keys = []*jwt.KeySet{keySet(rsaKey, rotated)}
+
+		_, err := verifier.Verify(context.Background(), rsaKey.sign(validClaims()), time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetcher.calls).To(BeZero())
+
+		_, err = verifier.Verify(context.Background(), rotated.sign(validClaims()), time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetcher.calls).To(Equal(1))
+	})
+
+	It("should reject a key missing from the fresh key set", func() {
+		fetcher.keys = []*jwt.KeySet{keySet(rsaKey), keySet(rsaKey)}
+		_, err := verifier.Verify(context.Background(), newRSAKey("unknown").sign(validClaims()), time.Now())
+		Expect(err).To(MatchError(ContainSubstring(`signing key "unknown" not found`)))
+	})
+
+	It("should not fetch the key set again for unknown keys within MinRefreshInterval", func() {
+		keyCache := &memoryCache{keys: keySet(rsaKey)}
+		keyCache.keys.FetchedAt = time.Now().Add(-time.Hour).Unix()
+		verifier.Cache = keyCache
+		fetcher.keys = []*jwt.KeySet{keySet(rsaKey), keySet(rsaKey)}
+
+		for i := 0; i < 2; i++ {
+			_, err := verifier.Verify(context.Background(), newRSAKey("unknown").sign(validClaims()), time.Now())
+			Expect(err).To(MatchError(ContainSubstring(`signing key "unknown" not found`)))
+		}
+		Expect(fetcher.calls).To(Equal(1))
+
+		// Another invocation loads the fetch time from the cache.
+		verifier = &jwt.Verifier{Fetcher: fetcher, Cache: keyCache}
+		_, err := verifier.Verify(context.Background(), newRSAKey("unknown").sign(validClaims()), time.Now())
+		Expect(err).To(MatchError(ContainSubstring(`signing key "unknown" not found`)))
+		Expect(fetcher.calls).To(Equal(1))
+	})
+
+	It("should use the cached key set and save fetched ones", func() {
+		keyCache := &memoryCache{keys: keySet(rsaKey)}
+		keyCache.keys.FetchedAt = time.Now().Add(-time.Hour).Unix()
+		verifier.Cache = keyCache
+
+		_, err := verifier.Verify(context.Background(), rsaKey.sign(validClaims()), time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetcher.calls).To(BeZero())
+
+		_, err = verifier.Verify(context.Background(), ecKey.sign(validClaims()), time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetcher.calls).To(Equal(1))
+		Expect(keyCache.saves).To(Equal(1))
+		Expect(keyCache.keys.Key("ec-1")).NotTo(BeNil())
+	})
+
+	It("should fetch a cached key set again once it is too old", func() {
+		removed := newRSAKey("removed")
+		keyCache := &memoryCache{keys: keySet(rsaKey, removed)}
+		keyCache.keys.FetchedAt = time.Now().Add(-25 * time.Hour).Unix()
+		verifier.Cache = keyCache
+		fetcher.keys = []*jwt.KeySet{keySet(rsaKey), keySet(rsaKey)}
+
+		_, err := verifier.Verify(context.Background(), removed.sign(validClaims()), time.Now())
+		Expect(err).To(MatchError(ContainSubstring(`signing key "removed" not found`)))
+		Expect(keyCache.keys.Key("removed")).To(BeNil())
+		Expect(keyCache.keys.FetchedAt).To(BeNumerically("~", time.Now().Unix(), 5))
+	})
+
+	It("should fetch a cached key set without a fetch time again", func() {
+		verifier.Cache = &memoryCache{keys: keySet(rsaKey)}
+		_, err := verifier.Verify(context.Background(), rsaKey.sign(validClaims()), time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetcher.calls).To(Equal(1))
+	})
+
+	It("should honor MaxAge", func() {
+		keyCache := &memoryCache{keys: keySet(rsaKey)}
+		keyCache.keys.FetchedAt = time.Now().Add(-2 * time.Hour).Unix()
+		verifier.Cache = keyCache
+		verifier.MaxAge = time.Hour
+
+		_, err := verifier.Verify(context.Background(), rsaKey.sign(validClaims()), time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetcher.calls).To(Equal(1))
+	})
+
+	It("should fail when the key set cannot be fetched", func() {
+		fetcher.keys = nil
+		_, err := verifier.Verify(context.Background(), rsaKey.sign(validClaims()), time.Now())
+		Expect(err).To(MatchError(ContainSubstring("failed to fetch the issuer key set")))
+	})
+})
+
+var _ = Describe("ValidateAudience", func() {
+	It("should accept a token issued for the audience", func() {
+		payload := jwt.Payload{Aud: jwt.Audience{"staging", "prod"}}
+		Expect(payload.ValidateAudience("prod")).To(Succeed())
+	})
+
+	It("should reject a token issued for other audiences", func() {
+		payload := jwt.Payload{Aud: jwt.Audience{"staging"}}
+		err := payload.ValidateAudience("prod")
+		Expect(errors.Is(err, jwt.ErrInvalidToken)).To(BeTrue())
+		Expect(err).To(MatchError(ContainSubstring(`audience ["staging"] does not include "prod"`)))
+	})
+
+	It("should reject a token without aud claim", func() {
+		payload := jwt.Payload{}
+		Expect(payload.ValidateAudience("prod")).To(MatchError(ContainSubstring("no aud claim")))
+	})
+})
+
+var _ = Describe("JSONWebKey", func() {
+	It("should reject a point that is not on the curve", func() {
+		key := newECKey("ec-1").jwk
+		key.Y = key.X
+		_, err := key.PublicKey()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject an unsupported key type", func() {
+		_, err := (&jwt.JSONWebKey{Kty: "oct", Kid: "k"}).PublicKey()
+		Expect(err).To(MatchError(ContainSubstring("unsupported key type")))
+	})
+})
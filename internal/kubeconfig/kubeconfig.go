@@ -0,0 +1,318 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/efortin/kubectl-auth-vault/internal/atomicfile"
+)
+
+// ExecConfig is the exec stanza of a kubeconfig user running the plugin.
+type ExecConfig struct {
+	APIVersion      string       `yaml:"apiVersion"`
+	Command         string       `yaml:"command"`
+	InteractiveMode string       `yaml:"interactiveMode,omitempty"`
+	Env             []ExecEnvVar `yaml:"env,omitempty"`
+	Args            []string     `yaml:"args,omitempty"`
+}
+
+type ExecEnvVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+type namedUser struct {
+	Name string   `yaml:"name"`
+	User authInfo `yaml:"user"`
+}
+
+type authInfo struct {
+	Exec *ExecConfig `yaml:"exec"`
+}
+
+// Snippet returns the kubeconfig users section defining the user running exec.
+func Snippet(name string, exec *ExecConfig) ([]byte, error) {
+	var doc yaml.Node
+	if err := doc.Encode(map[string][]namedUser{"users": {{Name: name, User: authInfo{Exec: exec}}}}); err != nil {
+		return nil, err
+	}
+	return encode(&doc)
+}
+
+// Paths returns the kubeconfig files in the order kubectl merges them: the
+// files listed in KUBECONFIG, or ~/.kube/config.
+func Paths() []string {
+	var paths []string
+	for _, path := range filepath.SplitList(os.Getenv("KUBECONFIG")) {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) > 0 {
+		return paths
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = os.TempDir()
+	}
+	return []string{filepath.Join(homeDir, ".kube", "config")}
+}
+
+// Config is a set of kubeconfig files edited together. Existing entries are
+// updated in the file defining them, new entries go to the first existing
+// file (or the last one if none exists), like kubectl config does.
+type Config struct {
+	files []*file
+}
+
+type file struct {
+	path   string
+	exists bool
+	mode   os.FileMode
+	before []byte
+	doc    *yaml.Node
+}
+
+// Load reads the kubeconfig files at paths. Missing files are treated as empty.
+func Load(paths ...string) (*Config, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no kubeconfig file")
+	}
+
+	c := &Config{}
+	for _, path := range paths {
+		f := &file{path: path, mode: 0600}
+
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, fmt.Errorf("failed to read kubeconfig: %w", err)
+		default:
+			f.exists = true
+			if info, err := os.Stat(path); err == nil {
+				f.mode = info.Mode().Perm()
+			}
+		}
+
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse kubeconfig %s: %w", path, err)
+		}
+		f.doc = &doc
+		if f.exists {
+			if f.before, err = encode(f.doc); err != nil {
+				return nil, err
+			}
+		}
+
+		c.files = append(c.files, f)
+	}
+
+	return c, nil
+}
+
+// SetUser adds the user running exec, or replaces the credentials of an
+// existing user with the same name.
+func (c *Config) SetUser(name string, exec *ExecConfig) error {
+	var user yaml.Node
+	if err := user.Encode(authInfo{Exec: exec}); err != nil {
+		return err
+	}
+
+	entry := c.namedEntry("users", name)
+	setKey(entry, "user", &user)
+	return nil
+}
+
+// SetContextUser makes the existing context authenticate as user.
+func (c *Config) SetContextUser(context, user string) error {
+	f, entry := c.find("contexts", context)
+	if f == nil {
+		return fmt.Errorf("context %q not found in kubeconfig", context)
+	}
+	setKey(contextNode(entry), "user", stringNode(user))
+	return nil
+}
+
+// SetContext adds or updates the context binding cluster to user. The
+// cluster must already be defined.
+func (c *Config) SetContext(name, cluster, user string) error {
+	if f, _ := c.find("clusters", cluster); f == nil {
+		return fmt.Errorf("cluster %q not found in kubeconfig", cluster)
+	}
+
+	context := contextNode(c.namedEntry("contexts", name))
+	setKey(context, "cluster", stringNode(cluster))
+	setKey(context, "user", stringNode(user))
+	return nil
+}
+
+// Change is the normalized content of a kubeconfig file before and after edits.
+type Change struct {
+	Path   string
+	Before []byte
+	After  []byte
+}
+
+// Changes returns the files modified by the edits.
+func (c *Config) Changes() ([]Change, error) {
+	var changes []Change
+	for _, f := range c.files {
+		after, err := encode(f.doc)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(f.before, after) {
+			changes = append(changes, Change{Path: f.path, Before: f.before, After: after})
+		}
+	}
+	return changes, nil
+}
+
+// Save writes the modified files. Files are replaced atomically so kubectl
+// never reads a partially written kubeconfig.
+func (c *Config) Save() error {
+	changes, err := c.Changes()
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		f := c.file(change.Path)
+		if err := atomicfile.Write(f.path, change.After, f.mode); err != nil {
+			return fmt.Errorf("failed to write kubeconfig: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) file(path string) *file {
+	for _, f := range c.files {
+		if f.path == path {
+			return f
+		}
+	}
+	return nil
+}
+
+// defaultFile returns the file receiving new entries.
+func (c *Config) defaultFile() *file {
+	for _, f := range c.files {
+		if f.exists {
+			return f
+		}
+	}
+	return c.files[len(c.files)-1]
+}
+
+// find returns the first file defining the named entry of section, and the entry.
+func (c *Config) find(section, name string) (*file, *yaml.Node) {
+	for _, f := range c.files {
+		if len(f.doc.Content) == 0 {
+			continue
+		}
+		seq := lookup(f.doc.Content[0], section)
+		if seq == nil || seq.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, entry := range seq.Content {
+			if n := lookup(entry, "name"); n != nil && n.Value == name {
+				return f, entry
+			}
+		}
+	}
+	return nil, nil
+}
+
+// namedEntry returns the named entry of section, appending it to the default
+// file if it does not exist yet.
+func (c *Config) namedEntry(section, name string) *yaml.Node {
+	if f, entry := c.find(section, name); f != nil {
+		return entry
+	}
+
+	root := c.defaultFile().root()
+	seq := lookup(root, section)
+	if seq == nil || seq.Kind != yaml.SequenceNode {
+		seq = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		setKey(root, section, seq)
+	}
+
+	entry := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setKey(entry, "name", stringNode(name))
+	// An empty list is usually written as [], keep the new entries readable.
+	seq.Style &^= yaml.FlowStyle
+	seq.Content = append(seq.Content, entry)
+	return entry
+}
+
+// root returns the top-level mapping of the file, initializing an empty file
+// as a kubeconfig.
+func (f *file) root() *yaml.Node {
+	if f.doc.Kind != yaml.DocumentNode || len(f.doc.Content) == 0 || f.doc.Content[0].Kind != yaml.MappingNode {
+		root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		setKey(root, "apiVersion", stringNode("v1"))
+		setKey(root, "kind", stringNode("Config"))
+		f.doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}
+	}
+	return f.doc.Content[0]
+}
+
+func contextNode(entry *yaml.Node) *yaml.Node {
+	context := lookup(entry, "context")
+	if context == nil || context.Kind != yaml.MappingNode {
+		context = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		setKey(entry, "context", context)
+	}
+	return context
+}
+
+func lookup(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func setKey(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, stringNode(key), value)
+}
+
+func stringNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+func encode(doc *yaml.Node) ([]byte, error) {
+	if doc.Kind == 0 {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to encode kubeconfig: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode kubeconfig: %w", err)
+	}
+	return buf.Bytes(), nil
+}
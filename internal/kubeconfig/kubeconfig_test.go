@@ -0,0 +1,298 @@
+package kubeconfig_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+
+	"github.com/efortin/kubectl-auth-vault/internal/kubeconfig"
+)
+
+const baseKubeconfig = `apiVersion: v1
+kind: Config
+# managed by hand
+clusters:
+- name: prod-cluster
+  cluster:
+    server: https://prod.example.com
+contexts:
+- name: prod
+  context:
+    cluster: prod-cluster
+    user: admin
+current-context: prod
+users:
+- name: admin
+  user:
+    token: abc
+`
+
+type kubeconfigFile struct {
+	Clusters []struct {
+		Name string `yaml:"name"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	CurrentContext string `yaml:"current-context"`
+	Users          []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token string                 `yaml:"token"`
+			Exec  *kubeconfig.ExecConfig `yaml:"exec"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+func readKubeconfig(path string) kubeconfigFile {
+	data, err := os.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred())
+	var kc kubeconfigFile
+	Expect(yaml.Unmarshal(data, &kc)).To(Succeed())
+	return kc
+}
+
+var _ = Describe("Kubeconfig", func() {
+	var (
+		tmpDir string
+		exec   *kubeconfig.ExecConfig
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "kubeconfig-test")
+		Expect(err).NotTo(HaveOccurred())
+
+		exec = &kubeconfig.ExecConfig{
+			APIVersion: "client.authentication.k8s.io/v1",
+			Command:    "kubectl-auth_vault",
+			Env:        []kubeconfig.ExecEnvVar{{Name: "VAULT_ADDR", Value: "https://vault.example.com"}},
+			Args:       []string{"get", "--token-path", "identity/oidc/token/test"},
+		}
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(tmpDir)
+	})
+
+	Describe("Paths", func() {
+		It("should split KUBECONFIG", func() {
+			GinkgoT().Setenv("KUBECONFIG", "a"+string(os.PathListSeparator)+string(os.PathListSeparator)+"b")
+			Expect(kubeconfig.Paths()).To(Equal([]string{"a", "b"}))
+		})
+
+		It("should default to ~/.kube/config", func() {
+			GinkgoT().Setenv("KUBECONFIG", "")
+			GinkgoT().Setenv("HOME", tmpDir)
+			Expect(kubeconfig.Paths()).To(Equal([]string{filepath.Join(tmpDir, ".kube", "config")}))
+		})
+	})
+
+	Describe("SetUser", func() {
+		It("should add the user and keep the other entries", func() {
+			path := filepath.Join(tmpDir, "config")
+			Expect(os.WriteFile(path, []byte(baseKubeconfig), 0640)).To(Succeed())
+
+			kc, err := kubeconfig.Load(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kc.SetUser("vault-user", exec)).To(Succeed())
+			Expect(kc.Save()).To(Succeed())
+
+			data, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(ContainSubstring("# managed by hand"))
+
+			written := readKubeconfig(path)
+			Expect(written.CurrentContext).To(Equal("prod"))
+			Expect(written.Users).To(HaveLen(2))
+			Expect(written.Users[0].User.Token).To(Equal("abc"))
+			Expect(written.Users[1].Name).To(Equal("vault-user"))
+			Expect(written.Users[1].User.Exec).To(Equal(exec))
+
+			if runtime.GOOS != "windows" {
+				info, err := os.Stat(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0640)))
+			}
+		})
+
+		It("should replace the credentials of an existing user", func() {
+			path := filepath.Join(tmpDir, "config")
+			Expect(os.WriteFile(path, []byte(baseKubeconfig), 0600)).To(Succeed())
+
+			kc, err := kubeconfig.Load(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kc.SetUser("admin", exec)).To(Succeed())
+			Expect(kc.Save()).To(Succeed())
+
+			written := readKubeconfig(path)
+			Expect(written.Users).To(HaveLen(1))
+			Expect(written.Users[0].User.Token).To(BeEmpty())
+			Expect(written.Users[0].User.Exec).To(Equal(exec))
+		})
+
+		It("should keep a symlinked kubeconfig", func() {
+			if runtime.GOOS == "windows" {
+				Skip("symlinks need privileges on Windows")
+			}
+			target := filepath.Join(tmpDir, "dotfiles", "kubeconfig")
+			Expect(os.MkdirAll(filepath.Dir(target), 0700)).To(Succeed())
+			Expect(os.WriteFile(target, []byte(baseKubeconfig), 0600)).To(Succeed())
+			path := filepath.Join(tmpDir, "config")
+			Expect(os.Symlink(target, path)).To(Succeed())
+
+			kc, err := kubeconfig.Load(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kc.SetUser("vault-user", exec)).To(Succeed())
+			Expect(kc.Save()).To(Succeed())
+
+			info, err := os.Lstat(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode() & os.ModeSymlink).NotTo(BeZero())
+			Expect(readKubeconfig(target).Users).To(HaveLen(2))
+		})
+
+		It("should create a missing kubeconfig", func() {
+			path := filepath.Join(tmpDir, ".kube", "config")
+
+			kc, err := kubeconfig.Load(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kc.SetUser("vault-user", exec)).To(Succeed())
+			Expect(kc.Save()).To(Succeed())
+
+			data, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(HavePrefix("apiVersion: v1\nkind: Config\n"))
+			Expect(readKubeconfig(path).Users).To(HaveLen(1))
+		})
+
+		It("should update the file defining the user among several files", func() {
+			first := filepath.Join(tmpDir, "first")
+			second := filepath.Join(tmpDir, "second")
+			Expect(os.WriteFile(first, []byte("apiVersion: v1\nkind: Config\nusers: []\n"), 0600)).To(Succeed())
+			Expect(os.WriteFile(second, []byte(baseKubeconfig), 0600)).To(Succeed())
+
+			kc, err := kubeconfig.Load(filepath.Join(tmpDir, "missing"), first, second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kc.SetUser("admin", exec)).To(Succeed())
+			Expect(kc.SetUser("vault-user", exec)).To(Succeed())
+
+			changes, err := kc.Changes()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes).To(HaveLen(2))
+			Expect(kc.Save()).To(Succeed())
+
+			Expect(readKubeconfig(first).Users[0].Name).To(Equal("vault-user"))
+			Expect(readKubeconfig(second).Users[0].User.Exec).To(Equal(exec))
+			_, err = os.Stat(filepath.Join(tmpDir, "missing"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("should report no changes when the user is up to date", func() {
+			path := filepath.Join(tmpDir, "config")
+			Expect(os.WriteFile(path, []byte(baseKubeconfig), 0600)).To(Succeed())
+
+			kc, err := kubeconfig.Load(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kc.SetUser("vault-user", exec)).To(Succeed())
+			Expect(kc.Save()).To(Succeed())
+
+			kc, err = kubeconfig.Load(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kc.SetUser("vault-user", exec)).To(Succeed())
+			changes, err := kc.Changes()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes).To(BeEmpty())
+		})
+	})
+
+	Describe("contexts", func() {
+		var (
+			path string
+			kc   *kubeconfig.Config
+		)
+
+		BeforeEach(func() {
+			path = filepath.Join(tmpDir, "config")
+			Expect(os.WriteFile(path, []byte(baseKubeconfig), 0600)).To(Succeed())
+			var err error
+			kc, err = kubeconfig.Load(path)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should bind an existing context to the user", func() {
+			Expect(kc.SetContextUser("prod", "vault-user")).To(Succeed())
+			Expect(kc.Save()).To(Succeed())
+
+			written := readKubeconfig(path)
+			Expect(written.Contexts[0].Context.Cluster).To(Equal("prod-cluster"))
+			Expect(written.Contexts[0].Context.User).To(Equal("vault-user"))
+		})
+
+		It("should reject an unknown context", func() {
+			Expect(kc.SetContextUser("staging", "vault-user")).To(MatchError(ContainSubstring(`context "staging" not found`)))
+		})
+
+		It("should create a context for a cluster", func() {
+			Expect(kc.SetContext("vault-user@prod-cluster", "prod-cluster", "vault-user")).To(Succeed())
+			Expect(kc.Save()).To(Succeed())
+
+			written := readKubeconfig(path)
+			Expect(written.Contexts).To(HaveLen(2))
+			Expect(written.Contexts[1].Name).To(Equal("vault-user@prod-cluster"))
+			Expect(written.Contexts[1].Context.Cluster).To(Equal("prod-cluster"))
+			Expect(written.Contexts[1].Context.User).To(Equal("vault-user"))
+		})
+
+		It("should reject an unknown cluster", func() {
+			Expect(kc.SetContext("vault-user@staging", "staging", "vault-user")).To(MatchError(ContainSubstring(`cluster "staging" not found`)))
+		})
+	})
+
+	Describe("Snippet", func() {
+		It("should render a users section", func() {
+			data, err := kubeconfig.Snippet("vault-user", exec)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(HavePrefix("users:\n  - name: vault-user\n    user:\n      exec:\n"))
+		})
+	})
+
+	Describe("Diff", func() {
+		It("should return an empty diff for equal content", func() {
+			Expect(kubeconfig.Diff("config", []byte("a\nb\n"), []byte("a\nb\n"))).To(BeEmpty())
+		})
+
+		It("should render unified hunks with context", func() {
+			before := []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n")
+			after := []byte("1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n")
+			Expect(kubeconfig.Diff("config", before, after)).To(Equal(`--- config
++++ config
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -8,3 +8,4 @@
+ 8
+ 9
+ 10
++11
+`))
+		})
+
+		It("should diff against an empty file", func() {
+			Expect(kubeconfig.Diff("config", nil, []byte("a\n"))).To(Equal("--- config\n+++ config\n@@ -0,0 +1,1 @@\n+a\n"))
+		})
+	})
+})
@@ -0,0 +1,80 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/efortin/kubectl-auth-vault/internal/jwt"
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+// KubernetesCredsName is the name of the Kubernetes secrets engine source.
+const KubernetesCredsName = "kubernetes-creds"
+
+func init() {
+	Register(KubernetesCredsName, func() Builder { return &kubernetesCredsBuilder{} })
+}
+
+// KubernetesCreds gets service account tokens from the Kubernetes secrets
+// engine.
+type KubernetesCreds struct {
+	// Role is the creds path of a role, e.g. "kubernetes/creds/breakglass".
+	Role    string
+	Request vault.ServiceAccountTokenRequest
+}
+
+func (s *KubernetesCreds) CacheKey() string {
+	return s.Role
+}
+
+func (s *KubernetesCreds) Fetch(ctx context.Context, client *vault.Client) (*Credential, error) {
+	sa, err := client.GenerateServiceAccountToken(ctx, s.Role, s.Request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch service account token from Vault: %w", err)
+	}
+
+	// The service account is deleted when the lease ends, whatever the token
+	// exp claim says.
+	cred := &Credential{Token: sa.Token, LeaseID: sa.LeaseID}
+	if sa.LeaseDuration > 0 {
+		cred.Exp = time.Now().Add(sa.LeaseDuration).Unix()
+	} else if cred.Exp, err = jwt.ExtractExp(sa.Token); err != nil {
+		return nil, fmt.Errorf("service account token from Vault has neither a lease duration nor an expiration: %w", err)
+	}
+	return cred, nil
+}
+
+type kubernetesCredsBuilder struct {
+	role               string
+	namespace          string
+	ttl                time.Duration
+	clusterRoleBinding bool
+}
+
+func (b *kubernetesCredsBuilder) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&b.role, "kubernetes-creds-role", "", "Vault Kubernetes secrets engine path (e.g. kubernetes/creds/<role>) to get a service account token from instead of an OIDC token")
+	fs.StringVar(&b.namespace, "kubernetes-creds-namespace", "", "Kubernetes namespace of the generated service account token")
+	fs.DurationVar(&b.ttl, "kubernetes-creds-ttl", 0, "TTL of the generated service account token (default: the role TTL)")
+	fs.BoolVar(&b.clusterRoleBinding, "kubernetes-creds-cluster-role-binding", false, "Bind the role of the generated service account cluster-wide instead of in its namespace")
+}
+
+func (b *kubernetesCredsBuilder) Configured() bool {
+	return b.role != ""
+}
+
+func (b *kubernetesCredsBuilder) Build() (Source, error) {
+	if b.role == "" {
+		return nil, fmt.Errorf("--kubernetes-creds-role is required with the %s source", KubernetesCredsName)
+	}
+	return &KubernetesCreds{
+		Role: b.role,
+		Request: vault.ServiceAccountTokenRequest{
+			KubernetesNamespace: b.namespace,
+			TTL:                 b.ttl,
+			ClusterRoleBinding:  b.clusterRoleBinding,
+		},
+	}, nil
+}
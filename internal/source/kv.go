@@ -0,0 +1,104 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/efortin/kubectl-auth-vault/internal/jwt"
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+// KVName is the name of the KV source.
+const KVName = "kv"
+
+// DefaultKVField is the field of the KV secret holding the token.
+const DefaultKVField = "token"
+
+// DefaultKVTTL is how long a token read from KV is cached.
+const DefaultKVTTL = time.Hour
+
+func init() {
+	Register(KVName, func() Builder { return &kvBuilder{} })
+}
+
+// KV reads static bearer tokens from the KV secrets engine, v1 or v2.
+type KV struct {
+	// Path is the path of the secret, e.g. "secret/clusters/legacy".
+	Path  string
+	Field string
+	// Version pins a version of a KV v2 secret; zero reads the latest one.
+	Version int
+	// TTL is how long the token is cached, since static tokens do not expire.
+	TTL time.Duration
+}
+
+// CacheKey includes the field and the pinned version, which select another
+// token than the one of the latest version of the secret.
+func (s *KV) CacheKey() string {
+	key := s.Path + "#" + s.Field
+	if s.Version != 0 {
+		key += fmt.Sprintf("@%d", s.Version)
+	}
+	return key
+}
+
+func (s *KV) Fetch(ctx context.Context, client *vault.Client) (*Credential, error) {
+	secret, err := client.ReadKV(ctx, s.Path, s.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch token from Vault: %w", err)
+	}
+
+	value, ok := secret.Data[s.Field]
+	if !ok {
+		return nil, fmt.Errorf("no %q field in the secret at %s", s.Field, s.Path)
+	}
+	token, ok := value.(string)
+	if !ok || token == "" {
+		return nil, fmt.Errorf("the %q field of the secret at %s is not a token", s.Field, s.Path)
+	}
+
+	// Tokens that do expire, such as JWTs with an exp claim, are not cached
+	// beyond their expiration.
+	cred := &Credential{Token: token, Exp: time.Now().Add(s.TTL).Unix()}
+	if exp, err := jwt.ExtractExp(token); err == nil && exp < cred.Exp {
+		cred.Exp = exp
+	}
+	return cred, nil
+}
+
+type kvBuilder struct {
+	path    string
+	field   string
+	version int
+	ttl     time.Duration
+}
+
+func (b *kvBuilder) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&b.path, "kv-path", "", "Vault KV v1 or v2 secret path (e.g. secret/clusters/<name>) to read a static token from instead of an OIDC token")
+	fs.StringVar(&b.field, "kv-field", DefaultKVField, "Field of the KV secret holding the token")
+	fs.IntVar(&b.version, "kv-version", 0, "Version of the KV v2 secret to read (default: the latest version)")
+	fs.DurationVar(&b.ttl, "kv-ttl", DefaultKVTTL, "How long to cache the token read from KV")
+}
+
+func (b *kvBuilder) Configured() bool {
+	return b.path != ""
+}
+
+func (b *kvBuilder) Build() (Source, error) {
+	if b.path == "" {
+		return nil, fmt.Errorf("--kv-path is required with the %s source", KVName)
+	}
+	if b.field == "" {
+		return nil, fmt.Errorf("--kv-field must not be empty")
+	}
+	if b.version < 0 {
+		return nil, fmt.Errorf("--kv-version must not be negative")
+	}
+	if b.ttl <= 0 {
+		return nil, fmt.Errorf("--kv-ttl must be positive")
+	}
+	return &KV{Path: b.path, Field: b.field, Version: b.version, TTL: b.ttl}, nil
+}
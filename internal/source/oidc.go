@@ -0,0 +1,53 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/pflag"
+
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+// OIDCName is the name of the OIDC source.
+const OIDCName = "oidc"
+
+func init() {
+	Register(OIDCName, func() Builder { return &oidcBuilder{} })
+}
+
+// OIDC gets OIDC tokens from the identity secrets engine.
+type OIDC struct {
+	// TokenPath is the path of the token endpoint of a role, e.g.
+	// "identity/oidc/token/kubernetes".
+	TokenPath string
+}
+
+func (s *OIDC) CacheKey() string {
+	return s.TokenPath
+}
+
+func (s *OIDC) Fetch(ctx context.Context, client *vault.Client) (*Credential, error) {
+	token, exp, err := client.GetOIDCToken(ctx, s.TokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch token from Vault: %w", err)
+	}
+	return &Credential{Token: token, Exp: exp}, nil
+}
+
+type oidcBuilder struct {
+	tokenPath string
+}
+
+func (b *oidcBuilder) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&b.tokenPath, "token-path", "", "Vault OIDC token path")
+}
+
+// Configured is always false: the OIDC source is the default one.
+func (b *oidcBuilder) Configured() bool {
+	return false
+}
+
+func (b *oidcBuilder) Build() (Source, error) {
+	return &OIDC{TokenPath: b.tokenPath}, nil
+}
@@ -0,0 +1,67 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+// PKIName is the name of the PKI source.
+const PKIName = "pki"
+
+func init() {
+	Register(PKIName, func() Builder { return &pkiBuilder{} })
+}
+
+// PKI gets client certificates from the PKI secrets engine.
+type PKI struct {
+	// Role is the issue path of a role, e.g. "pki/issue/kubernetes".
+	Role    string
+	Request vault.CertificateRequest
+}
+
+func (s *PKI) CacheKey() string {
+	return s.Role
+}
+
+func (s *PKI) Fetch(ctx context.Context, client *vault.Client) (*Credential, error) {
+	cert, err := client.IssueCertificate(ctx, s.Role, s.Request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch client certificate from Vault: %w", err)
+	}
+	return &Credential{
+		ClientCertificate: cert.Certificate,
+		ClientKey:         cert.PrivateKey,
+		Exp:               cert.NotAfter.Unix(),
+	}, nil
+}
+
+type pkiBuilder struct {
+	role       string
+	commonName string
+	ttl        time.Duration
+}
+
+func (b *pkiBuilder) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&b.role, "pki-role", "", "Vault PKI issue path (e.g. pki/issue/<role>) to get a client certificate from instead of an OIDC token")
+	fs.StringVar(&b.commonName, "pki-common-name", "", "Common name of the client certificate, i.e. the Kubernetes user name (default: set by the PKI role)")
+	fs.DurationVar(&b.ttl, "pki-ttl", 0, "TTL of the client certificate (default: the PKI role TTL)")
+}
+
+func (b *pkiBuilder) Configured() bool {
+	return b.role != ""
+}
+
+func (b *pkiBuilder) Build() (Source, error) {
+	if b.role == "" {
+		return nil, fmt.Errorf("--pki-role is required with the %s source", PKIName)
+	}
+	return &PKI{
+		Role:    b.role,
+		Request: vault.CertificateRequest{CommonName: b.commonName, TTL: b.ttl},
+	}, nil
+}
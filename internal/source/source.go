@@ -0,0 +1,146 @@
+// Package source defines how the plugin gets the credential it hands to
+// kubectl from Vault. Each Source is registered under a name selected with
+// the --source flag of the get command.
+package source
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+// Default is the source used when none is selected or configured.
+const Default = OIDCName
+
+// Credential is a credential for the Kubernetes API server: either a bearer
+// token or a PEM-encoded client certificate and key.
+type Credential struct {
+	Token             string
+	ClientCertificate string
+	ClientKey         string
+	// Exp is the Unix timestamp at which the credential expires.
+	Exp int64
+	// LeaseID is the Vault lease of the credential, revoked when it is
+	// removed from the cache. It is empty for credentials without a lease.
+	LeaseID string
+}
+
+// Source gets credentials from Vault.
+type Source interface {
+	// CacheKey identifies the credential in the cache, typically the Vault
+	// path it is read from.
+	CacheKey() string
+	// Fetch gets a new credential with client, which is logged in already.
+	Fetch(ctx context.Context, client *vault.Client) (*Credential, error)
+}
+
+// Builder configures a Source from command line flags.
+type Builder interface {
+	// AddFlags registers the flags configuring the source.
+	AddFlags(fs *pflag.FlagSet)
+	// Configured reports whether the flags specific to the source are set,
+	// in which case it is used without being selected explicitly.
+	Configured() bool
+	// Build returns the source configured by the flags.
+	Build() (Source, error)
+}
+
+var registry = map[string]func() Builder{}
+
+// Register makes a source available under name. It panics if name is
+// already registered.
+func Register(name string, newBuilder func() Builder) {
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("source %q is already registered", name))
+	}
+	registry[name] = newBuilder
+}
+
+// Names returns the names of the registered sources, sorted.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Builders returns a new builder for each registered source, by name.
+func Builders() map[string]Builder {
+	builders := make(map[string]Builder, len(registry))
+	for name, newBuilder := range registry {
+		builders[name] = newBuilder()
+	}
+	return builders
+}
+
+// Select returns the name of the source to use among builders: name when it
+// is set, otherwise the only configured source, defaulting to Default.
+func Select(name string, builders map[string]Builder) (string, error) {
+	if name != "" {
+		if _, ok := builders[name]; !ok {
+			return "", fmt.Errorf("unknown source %q (available: %s)", name, strings.Join(Names(), ", "))
+		}
+		return name, nil
+	}
+
+	var configured []string
+	for name, b := range builders {
+		if b.Configured() {
+			configured = append(configured, name)
+		}
+	}
+	switch len(configured) {
+	case 0:
+		return Default, nil
+	case 1:
+		return configured[0], nil
+	}
+	sort.Strings(configured)
+	return "", fmt.Errorf("the flags of the %s sources cannot be used together, select one with --source", strings.Join(configured, " and "))
+}
+
+// Settings returns the values of the flags of the source name that are set
+// in fs, on the command line or from a profile, so that the same source can
+// be built elsewhere with Build.
+func Settings(name string, fs *pflag.FlagSet) map[string]string {
+	own := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	if newBuilder, ok := registry[name]; ok {
+		newBuilder().AddFlags(own)
+	}
+
+	settings := make(map[string]string)
+	own.VisitAll(func(f *pflag.Flag) {
+		if fs.Changed(f.Name) {
+			settings[f.Name] = fs.Lookup(f.Name).Value.String()
+		}
+	})
+	return settings
+}
+
+// Build returns the source name configured with the flag values settings.
+func Build(name string, settings map[string]string) (Source, error) {
+	newBuilder, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+
+	b := newBuilder()
+	fs := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	b.AddFlags(fs)
+	for flag, value := range settings {
+		if fs.Lookup(flag) == nil {
+			return nil, fmt.Errorf("the %s source has no --%s flag", name, flag)
+		}
+		if err := fs.Set(flag, value); err != nil {
+			return nil, fmt.Errorf("invalid --%s: %w", flag, err)
+		}
+	}
+	return b.Build()
+}
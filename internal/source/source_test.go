@@ -0,0 +1,146 @@
+package source_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/pflag"
+
+	"github.com/efortin/kubectl-auth-vault/internal/source"
+	"github.com/efortin/kubectl-auth-vault/internal/source/sourcetest"
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+var _ = Describe("Source", func() {
+	var builders map[string]source.Builder
+
+	// parse registers the flags of all builders and parses args.
+	parse := func(args ...string) {
+		builders = source.Builders()
+		fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		for _, name := range source.Names() {
+			builders[name].AddFlags(fs)
+		}
+		Expect(fs.Parse(args)).To(Succeed())
+	}
+
+	It("should register the built-in sources", func() {
+		Expect(source.Names()).To(ContainElements(source.OIDCName, source.PKIName, source.KubernetesCredsName, source.KVName))
+	})
+
+	It("should refuse to register a name twice", func() {
+		Expect(func() {
+			source.Register(source.OIDCName, func() source.Builder { return &sourcetest.Fake{} })
+		}).To(PanicWith(ContainSubstring("already registered")))
+	})
+
+	Describe("Select", func() {
+		It("should default to the OIDC source", func() {
+			parse("--token-path", "identity/oidc/token/test")
+			Expect(source.Select("", builders)).To(Equal(source.OIDCName))
+		})
+
+		It("should use the source whose flags are set", func() {
+			parse("--pki-role", "pki/issue/kubernetes")
+			Expect(source.Select("", builders)).To(Equal(source.PKIName))
+		})
+
+		It("should use the selected source", func() {
+			parse("--pki-role", "pki/issue/kubernetes")
+			Expect(source.Select(source.OIDCName, builders)).To(Equal(source.OIDCName))
+		})
+
+		It("should reject the flags of several sources", func() {
+			parse("--pki-role", "pki/issue/kubernetes", "--kubernetes-creds-role", "kubernetes/creds/breakglass")
+			_, err := source.Select("", builders)
+			Expect(err).To(MatchError(ContainSubstring("kubernetes-creds and pki sources cannot be used together")))
+		})
+
+		It("should reject unknown sources", func() {
+			parse()
+			_, err := source.Select("ldap", builders)
+			Expect(err).To(MatchError(ContainSubstring(`unknown source "ldap"`)))
+		})
+	})
+
+	Describe("Build", func() {
+		It("should configure the sources from their flags", func() {
+			parse("--token-path", "identity/oidc/token/test",
+				"--pki-role", "pki/issue/kubernetes", "--pki-common-name", "jane", "--pki-ttl", "1h",
+				"--kubernetes-creds-role", "kubernetes/creds/breakglass", "--kubernetes-creds-namespace", "default")
+
+			oidc, err := builders[source.OIDCName].Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(oidc).To(Equal(&source.OIDC{TokenPath: "identity/oidc/token/test"}))
+			Expect(oidc.CacheKey()).To(Equal("identity/oidc/token/test"))
+
+			pki, err := builders[source.PKIName].Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pki).To(Equal(&source.PKI{
+				Role:    "pki/issue/kubernetes",
+				Request: vault.CertificateRequest{CommonName: "jane", TTL: time.Hour},
+			}))
+
+			creds, err := builders[source.KubernetesCredsName].Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds.CacheKey()).To(Equal("kubernetes/creds/breakglass"))
+		})
+
+		It("should configure the KV source with its defaults", func() {
+			parse("--kv-path", "secret/clusters/legacy")
+			Expect(source.Select("", builders)).To(Equal(source.KVName))
+
+			kv, err := builders[source.KVName].Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kv).To(Equal(&source.KV{Path: "secret/clusters/legacy", Field: "token", TTL: time.Hour}))
+			Expect(kv.CacheKey()).To(Equal("secret/clusters/legacy#token"))
+		})
+
+		It("should cache pinned KV versions separately", func() {
+			parse("--kv-path", "secret/clusters/legacy", "--kv-field", "admin", "--kv-version", "3")
+			kv, err := builders[source.KVName].Build()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kv.CacheKey()).To(Equal("secret/clusters/legacy#admin@3"))
+		})
+
+		It("should require a positive KV TTL", func() {
+			parse("--kv-path", "secret/clusters/legacy", "--kv-ttl", "0s")
+			_, err := builders[source.KVName].Build()
+			Expect(err).To(MatchError(ContainSubstring("--kv-ttl must be positive")))
+		})
+
+		It("should require the role of the PKI source", func() {
+			parse()
+			_, err := builders[source.PKIName].Build()
+			Expect(err).To(MatchError(ContainSubstring("--pki-role is required")))
+		})
+	})
+
+	Describe("Settings", func() {
+		It("should rebuild a source from the flags set for it", func() {
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			builders := source.Builders()
+			for _, name := range source.Names() {
+				builders[name].AddFlags(fs)
+			}
+			Expect(fs.Parse([]string{"--token-path", "identity/oidc/token/test",
+				"--pki-role", "pki/issue/kubernetes", "--pki-ttl", "1h"})).To(Succeed())
+
+			settings := source.Settings(source.PKIName, fs)
+			Expect(settings).To(Equal(map[string]string{"pki-role": "pki/issue/kubernetes", "pki-ttl": "1h0m0s"}))
+
+			pki, err := source.Build(source.PKIName, settings)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pki).To(Equal(&source.PKI{
+				Role:    "pki/issue/kubernetes",
+				Request: vault.CertificateRequest{TTL: time.Hour},
+			}))
+		})
+
+		It("should reject the flags of other sources", func() {
+			_, err := source.Build(source.PKIName, map[string]string{"token-path": "identity/oidc/token/test"})
+			Expect(err).To(MatchError("the pki source has no --token-path flag"))
+		})
+	})
+})
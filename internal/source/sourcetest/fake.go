@@ -0,0 +1,51 @@
+// Package sourcetest provides a fake credential source for tests.
+package sourcetest
+
+import (
+	"context"
+
+	"github.com/spf13/pflag"
+
+	"github.com/efortin/kubectl-auth-vault/internal/source"
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+// Fake is a Source returning a fixed credential without calling Vault. It is
+// also its own Builder, so it can be registered with
+//
+//	source.Register("fake", func() source.Builder { return fake })
+type Fake struct {
+	// Key is returned by CacheKey.
+	Key string
+	// Credential and Err are returned by Fetch.
+	Credential *source.Credential
+	Err        error
+	// Fetches counts the calls to Fetch.
+	Fetches int
+	// VaultTokens holds the Vault token of the client of each call to Fetch.
+	VaultTokens []string
+}
+
+func (f *Fake) CacheKey() string {
+	return f.Key
+}
+
+func (f *Fake) Fetch(ctx context.Context, client *vault.Client) (*source.Credential, error) {
+	f.Fetches++
+	f.VaultTokens = append(f.VaultTokens, client.Token())
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	cred := *f.Credential
+	return &cred, nil
+}
+
+func (f *Fake) AddFlags(fs *pflag.FlagSet) {}
+
+func (f *Fake) Configured() bool {
+	return false
+}
+
+func (f *Fake) Build() (source.Source, error) {
+	return f, nil
+}
@@ -0,0 +1,148 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault-client-go"
+)
+
+// DefaultServiceAccountTokenPath is where Kubernetes mounts the pod's service account token.
+const DefaultServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// Auth is a Vault token obtained by logging in with an auth method.
+type Auth struct {
+	ClientToken string
+	// Exp is the Unix timestamp at which the token expires, zero if the
+	// token has no TTL.
+	Exp       int64
+	Renewable bool
+}
+
+// Authenticator logs in to Vault with a specific auth method.
+type Authenticator interface {
+	Login(ctx context.Context, c *Client) (*Auth, error)
+}
+
+// AppRoleAuth logs in with the AppRole auth method.
+type AppRoleAuth struct {
+	// MountPath is the path the AppRole auth method is mounted at (default: approle).
+	MountPath string
+	RoleID    string
+	// SecretID may be empty for roles created with bind_secret_id=false.
+	SecretID string
+}
+
+func (a *AppRoleAuth) Login(ctx context.Context, c *Client) (*Auth, error) {
+	if a.RoleID == "" {
+		return nil, fmt.Errorf("AppRole login requires a role_id")
+	}
+
+	body := map[string]interface{}{"role_id": a.RoleID}
+	if a.SecretID != "" {
+		body["secret_id"] = a.SecretID
+	}
+
+	return c.login(ctx, mountPathOrDefault(a.MountPath, "approle"), body)
+}
+
+// KubernetesAuth logs in with the Kubernetes auth method using a service
+// account token, typically the one projected into a pod.
+type KubernetesAuth struct {
+	// MountPath is the path the Kubernetes auth method is mounted at (default: kubernetes).
+	MountPath string
+	Role      string
+	// JWTPath is the service account token file (default: DefaultServiceAccountTokenPath).
+	JWTPath string
+}
+
+func (a *KubernetesAuth) Login(ctx context.Context, c *Client) (*Auth, error) {
+	if a.Role == "" {
+		return nil, fmt.Errorf("kubernetes login requires a role")
+	}
+
+	jwtPath := a.JWTPath
+	if jwtPath == "" {
+		jwtPath = DefaultServiceAccountTokenPath
+	}
+
+	// Projected tokens are rotated by the kubelet, so read the file on every login.
+	data, err := os.ReadFile(jwtPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+
+	body := map[string]interface{}{
+		"role": a.Role,
+		"jwt":  strings.TrimSpace(string(data)),
+	}
+
+	return c.login(ctx, mountPathOrDefault(a.MountPath, "kubernetes"), body)
+}
+
+// Login authenticates with the given auth method and uses the resulting
+// token for all subsequent requests.
+func (c *Client) Login(ctx context.Context, a Authenticator) (*Auth, error) {
+	// A login request denied after a failover is not retried with a login.
+	authenticator := c.authenticator
+	c.authenticator = nil
+	auth, err := a.Login(ctx, c)
+	c.authenticator = authenticator
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.SetToken(auth.ClientToken); err != nil {
+		return nil, err
+	}
+
+	return auth, nil
+}
+
+// SetToken sets the Vault token used for all subsequent requests.
+func (c *Client) SetToken(token string) error {
+	for _, n := range c.nodes {
+		if err := n.client.SetToken(token); err != nil {
+			return fmt.Errorf("failed to set vault token: %w", err)
+		}
+	}
+	c.token = token
+	return nil
+}
+
+func (c *Client) login(ctx context.Context, mountPath string, body map[string]interface{}) (*Auth, error) {
+	path := "auth/" + mountPath + "/login"
+
+	resp, err := c.write(ctx, path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to log in at %s: %w", path, err)
+	}
+
+	return authFromResponse(resp, path)
+}
+
+func authFromResponse(resp *vault.Response[map[string]interface{}], path string) (*Auth, error) {
+	if resp == nil || resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("no auth data returned from vault path: %s", path)
+	}
+
+	auth := &Auth{
+		ClientToken: resp.Auth.ClientToken,
+		Renewable:   resp.Auth.Renewable,
+	}
+	if resp.Auth.LeaseDuration > 0 {
+		auth.Exp = time.Now().Add(time.Duration(resp.Auth.LeaseDuration) * time.Second).Unix()
+	}
+
+	return auth, nil
+}
+
+func mountPathOrDefault(mountPath, def string) string {
+	if mountPath = strings.Trim(mountPath, "/"); mountPath != "" {
+		return mountPath
+	}
+	return def
+}
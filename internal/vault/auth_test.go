@@ -0,0 +1,195 @@
+package vault_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+func writeAuthResponse(w http.ResponseWriter, clientToken string, leaseDuration int) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": nil,
+		"auth": map[string]interface{}{
+			"client_token":   clientToken,
+			"lease_duration": leaseDuration,
+			"renewable":      true,
+		},
+	})
+}
+
+var _ = Describe("Vault Auth", func() {
+	var server *httptest.Server
+
+	AfterEach(func() {
+		if server != nil {
+			server.Close()
+		}
+	})
+
+	Describe("AppRoleAuth", func() {
+		It("should log in and use the returned token", func() {
+			exp := time.Now().Add(time.Hour).Unix()
+			testToken := createTestJWT(exp)
+
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v1/auth/approle/login":
+					var body map[string]string
+					Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+					Expect(body).To(Equal(map[string]string{"role_id": "my-role", "secret_id": "my-secret"}))
+					writeAuthResponse(w, "hvs.approle", 3600)
+				case "/v1/identity/oidc/token/test_role":
+					Expect(r.Header.Get("X-Vault-Token")).To(Equal("hvs.approle"))
+					writeVaultResponse(w, vault.OIDCTokenResponse{
+						Data: vault.OIDCTokenData{Token: testToken},
+					})
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+
+			client, err := vault.NewClient(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+
+			auth, err := client.Login(context.Background(), &vault.AppRoleAuth{RoleID: "my-role", SecretID: "my-secret"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(auth.ClientToken).To(Equal("hvs.approle"))
+			Expect(auth.Renewable).To(BeTrue())
+			Expect(auth.Exp).To(BeNumerically("~", time.Now().Add(time.Hour).Unix(), 5))
+
+			token, _, err := client.GetOIDCToken(context.Background(), "identity/oidc/token/test_role")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token).To(Equal(testToken))
+		})
+
+		It("should use a custom mount path and omit an empty secret_id", func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal("/v1/auth/ci/approle/login"))
+				var body map[string]string
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				Expect(body).NotTo(HaveKey("secret_id"))
+				writeAuthResponse(w, "hvs.approle", 0)
+			}))
+
+			client, err := vault.NewClient(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+
+			auth, err := client.Login(context.Background(), &vault.AppRoleAuth{MountPath: "/ci/approle/", RoleID: "my-role"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(auth.Exp).To(BeZero())
+		})
+
+		It("should require a role_id", func() {
+			client, err := vault.NewClient("http://localhost:8200")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.Login(context.Background(), &vault.AppRoleAuth{})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should return an error when no auth data is returned", func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{}})
+			}))
+
+			client, err := vault.NewClient(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.Login(context.Background(), &vault.AppRoleAuth{RoleID: "my-role"})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should return an error on invalid credentials", func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors":["invalid role or secret ID"]}`))
+			}))
+
+			client, err := vault.NewClient(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.Login(context.Background(), &vault.AppRoleAuth{RoleID: "my-role", SecretID: "bad"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("invalid role or secret ID"))
+		})
+	})
+
+	Describe("KubernetesAuth", func() {
+		var tmpDir string
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = os.MkdirTemp("", "vault-k8s-auth-test")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("should log in with the service account token", func() {
+			jwtPath := filepath.Join(tmpDir, "token")
+			Expect(os.WriteFile(jwtPath, []byte("sa-jwt\n"), 0600)).To(Succeed())
+
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal("/v1/auth/kubernetes/login"))
+				var body map[string]string
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				Expect(body).To(Equal(map[string]string{"role": "fleet", "jwt": "sa-jwt"}))
+				writeAuthResponse(w, "hvs.k8s", 600)
+			}))
+
+			client, err := vault.NewClient(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+
+			auth, err := client.Login(context.Background(), &vault.KubernetesAuth{Role: "fleet", JWTPath: jwtPath})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(auth.ClientToken).To(Equal("hvs.k8s"))
+		})
+
+		It("should use a custom mount path", func() {
+			jwtPath := filepath.Join(tmpDir, "token")
+			Expect(os.WriteFile(jwtPath, []byte("sa-jwt"), 0600)).To(Succeed())
+
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal("/v1/auth/k8s-prod/login"))
+				writeAuthResponse(w, "hvs.k8s", 600)
+			}))
+
+			client, err := vault.NewClient(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.Login(context.Background(), &vault.KubernetesAuth{MountPath: "k8s-prod", Role: "fleet", JWTPath: jwtPath})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should require a role", func() {
+			client, err := vault.NewClient("http://localhost:8200")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.Login(context.Background(), &vault.KubernetesAuth{JWTPath: filepath.Join(tmpDir, "token")})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should return an error when the token file is missing", func() {
+			client, err := vault.NewClient("http://localhost:8200")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.Login(context.Background(), &vault.KubernetesAuth{Role: "fleet", JWTPath: filepath.Join(tmpDir, "missing")})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("service account token"))
+		})
+	})
+})
@@ -2,43 +2,114 @@ package vault
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/hashicorp/vault-client-go"
 
+	"github.com/efortin/kubectl-auth-vault/internal/atomicfile"
 	"github.com/efortin/kubectl-auth-vault/internal/jwt"
 )
 
 type Client struct {
-	client *vault.Client
+	nodes     []*node
+	current   int
+	namespace string
+	token     string
+
+	addressStore  AddressStore
+	savedAddress  string
+	onFailover    func(address string, err error)
+	authenticator Authenticator
+	onLogin       func(address string, auth *Auth)
 }
 
-type TokenFetcher interface {
-	GetOIDCToken(ctx context.Context, path string) (token string, exp int64, err error)
+// NewClient returns a client for the Vault server at address. address may be
+// a comma-separated list of the addresses of several Vault clusters; requests
+// are sent to the first one and fail over to the next ones while they are
+// unavailable.
+func NewClient(address string, opts ...Option) (*Client, error) {
+	o := options{timeout: DefaultTimeout, retry: DefaultRetryConfig()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	addresses := splitAddresses(address)
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no vault address")
+	}
+
+	// Use the token from VAULT_TOKEN env or ~/.vault-token file
+	c := &Client{namespace: o.namespace, token: getVaultToken(), addressStore: o.addressStore}
+	for _, addr := range addresses {
+		client, err := newVaultClient(addr, c.token, &o)
+		if err != nil {
+			return nil, err
+		}
+		c.nodes = append(c.nodes, &node{address: addr, client: client})
+	}
+
+	if o.addressStore != nil && len(c.nodes) > 1 {
+		if last, err := o.addressStore.LoadAddress(); err == nil {
+			for i, n := range c.nodes {
+				if n.address == last {
+					c.current, c.savedAddress = i, last
+				}
+			}
+		}
+	}
+
+	return c, nil
 }
 
-func NewClient(address string) (*Client, error) {
-	client, err := vault.New(
+func newVaultClient(address, token string, o *options) (*vault.Client, error) {
+	clientOptions := []vault.ClientOption{
 		vault.WithAddress(address),
-		vault.WithRequestTimeout(30*time.Second),
-	)
+		vault.WithRequestTimeout(o.timeout),
+		vault.WithRetryConfiguration(o.retry.clientConfiguration()),
+	}
+	if !o.tls.IsZero() {
+		clientOptions = append(clientOptions, vault.WithTLS(vault.TLSConfiguration{
+			ServerCertificate: vault.ServerCertificateEntry{
+				FromFile:      o.tls.CACert,
+				FromDirectory: o.tls.CAPath,
+			},
+			ClientCertificate:    vault.ClientCertificateEntry{FromFile: o.tls.ClientCert},
+			ClientCertificateKey: vault.ClientCertificateKeyEntry{FromFile: o.tls.ClientKey},
+			ServerName:           o.tls.ServerName,
+			InsecureSkipVerify:   o.tls.Insecure,
+		}))
+	}
+
+	client, err := vault.New(clientOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create vault client: %w", err)
 	}
 
-	// Set authentication token from VAULT_TOKEN env or ~/.vault-token file
-	token := getVaultToken()
+	if o.namespace != "" {
+		if err := client.SetNamespace(o.namespace); err != nil {
+			return nil, fmt.Errorf("failed to set vault namespace: %w", err)
+		}
+	}
+
 	if token != "" {
 		if err := client.SetToken(token); err != nil {
 			return nil, fmt.Errorf("failed to set vault token: %w", err)
 		}
 	}
 
-	return &Client{client: client}, nil
+	return client, nil
+}
+
+// Namespace returns the Vault Enterprise namespace requests are sent to.
+func (c *Client) Namespace() string {
+	return c.namespace
 }
 
 // getVaultToken returns the Vault token from environment or token file.
@@ -50,12 +121,11 @@ func getVaultToken() string {
 	}
 
 	// Fall back to ~/.vault-token file
-	home, err := os.UserHomeDir()
+	tokenFile, err := vaultTokenFile()
 	if err != nil {
 		return ""
 	}
 
-	tokenFile := filepath.Join(home, ".vault-token")
 	data, err := os.ReadFile(tokenFile)
 	if err != nil {
 		return ""
@@ -64,8 +134,67 @@ func getVaultToken() string {
 	return strings.TrimSpace(string(data))
 }
 
+// ReloadToken uses the token from VAULT_TOKEN or ~/.vault-token again, so
+// that a long-running client picks up a token obtained with `vault login`
+// since it was created. The current token is kept when there is none.
+func (c *Client) ReloadToken() error {
+	token := getVaultToken()
+	if token == "" || token == c.token {
+		return nil
+	}
+	return c.SetToken(token)
+}
+
+// SaveVaultToken persists token to ~/.vault-token, like `vault login` does,
+// so later invocations and the Vault CLI pick it up.
+func SaveVaultToken(token string) error {
+	tokenFile, err := vaultTokenFile()
+	if err != nil {
+		return err
+	}
+
+	// The Vault CLI reads the file too, so it is never left half written.
+	if err := atomicfile.Write(tokenFile, []byte(token), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tokenFile, err)
+	}
+
+	return nil
+}
+
+func vaultTokenFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".vault-token"), nil
+}
+
+// IsPermissionDenied reports whether err is a 403 response, which is what
+// Vault answers for missing, expired or revoked tokens.
+func IsPermissionDenied(err error) bool {
+	return vault.IsErrorStatus(err, http.StatusForbidden)
+}
+
+// IsUnavailable reports whether err means Vault could not serve the request:
+// network errors, timeouts and 5xx responses. TLS verification failures are
+// configuration errors and do not match.
+func IsUnavailable(err error) bool {
+	var responseError *vault.ResponseError
+	if errors.As(err, &responseError) {
+		return responseError.StatusCode >= http.StatusInternalServerError
+	}
+
+	var certificateError *tls.CertificateVerificationError
+	if errors.As(err, &certificateError) {
+		return false
+	}
+
+	var netError net.Error
+	return errors.As(err, &netError) || errors.Is(err, context.DeadlineExceeded)
+}
+
 func (c *Client) GetOIDCToken(ctx context.Context, path string) (string, int64, error) {
-	resp, err := c.client.Read(ctx, path)
+	resp, err := c.read(ctx, path)
 	if err != nil {
 		return "", 0, fmt.Errorf("failed to read from vault path %s: %w", path, err)
 	}
@@ -84,10 +213,9 @@ func (c *Client) GetOIDCToken(ctx context.Context, path string) (string, int64,
 		return "", 0, fmt.Errorf("token is not a string")
 	}
 
-	exp, err := jwt.ExtractExp(token)
-	if err != nil {
-		exp = time.Now().Add(time.Hour).Unix()
-	}
+	// A token without an exp claim gets no expiry rather than a made-up one:
+	// kubectl then asks again on every use, and the cache never reuses it.
+	exp, _ := jwt.ExtractExp(token)
 
 	return token, exp, nil
 }
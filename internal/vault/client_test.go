@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -40,6 +43,23 @@ var _ = Describe("Vault Client", func() {
 			Expect(client).NotTo(BeNil())
 		})
 
+		It("should send the namespace header on every request", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Header.Get("X-Vault-Namespace")).To(Equal("team-a"))
+				writeVaultResponse(w, vault.OIDCTokenResponse{
+					Data: vault.OIDCTokenData{Token: createTestJWT(time.Now().Add(time.Hour).Unix())},
+				})
+			}))
+			defer server.Close()
+
+			client, err := vault.NewClient(server.URL, vault.WithNamespace("team-a"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.Namespace()).To(Equal("team-a"))
+
+			_, _, err = client.GetOIDCToken(context.Background(), "identity/oidc/token/test_role")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
 		It("should return error for invalid address", func() {
 			_, err := vault.NewClient("://invalid-url")
 			Expect(err).To(HaveOccurred())
@@ -136,7 +156,7 @@ var _ = Describe("Vault Client", func() {
 		})
 
 		Context("with invalid JWT (no exp)", func() {
-			It("should return token with default expiration", func() {
+			It("should return the token without expiration", func() {
 				server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					writeVaultResponse(w, vault.OIDCTokenResponse{
 						Data: vault.OIDCTokenData{Token: "invalid-jwt-without-exp"},
@@ -149,10 +169,7 @@ var _ = Describe("Vault Client", func() {
 				token, exp, err := client.GetOIDCToken(context.Background(), "identity/oidc/token/test_role")
 				Expect(err).NotTo(HaveOccurred())
 				Expect(token).To(Equal("invalid-jwt-without-exp"))
-
-				now := time.Now().Unix()
-				Expect(exp).To(BeNumerically(">=", now))
-				Expect(exp).To(BeNumerically("<=", now+3700))
+				Expect(exp).To(BeZero())
 			})
 		})
 
@@ -170,4 +187,116 @@ var _ = Describe("Vault Client", func() {
 			})
 		})
 	})
+
+	Describe("IsPermissionDenied", func() {
+		It("should detect 403 responses", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			}))
+			defer server.Close()
+
+			client, err := vault.NewClient(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, _, err = client.GetOIDCToken(context.Background(), "identity/oidc/token/test_role")
+			Expect(vault.IsPermissionDenied(err)).To(BeTrue())
+		})
+
+		It("should not match other errors", func() {
+			Expect(vault.IsPermissionDenied(nil)).To(BeFalse())
+			Expect(vault.IsPermissionDenied(errors.New("boom"))).To(BeFalse())
+		})
+	})
+
+	Describe("IsUnavailable", func() {
+		fetch := func(url string) error {
+			client, err := vault.NewClient(url, vault.WithRetry(vault.RetryConfig{}))
+			Expect(err).NotTo(HaveOccurred())
+			_, _, err = client.GetOIDCToken(context.Background(), "identity/oidc/token/test_role")
+			return err
+		}
+
+		It("should detect 5xx responses", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer server.Close()
+
+			Expect(vault.IsUnavailable(fetch(server.URL))).To(BeTrue())
+		})
+
+		It("should detect connection errors", func() {
+			server := httptest.NewServer(http.NotFoundHandler())
+			server.Close()
+
+			Expect(vault.IsUnavailable(fetch(server.URL))).To(BeTrue())
+		})
+
+		It("should not match client errors", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			}))
+			defer server.Close()
+
+			Expect(vault.IsUnavailable(fetch(server.URL))).To(BeFalse())
+			Expect(vault.IsUnavailable(nil)).To(BeFalse())
+		})
+
+		It("should not match TLS verification failures", func() {
+			server := httptest.NewTLSServer(http.NotFoundHandler())
+			defer server.Close()
+
+			Expect(vault.IsUnavailable(fetch(server.URL))).To(BeFalse())
+		})
+	})
+
+	Describe("SaveVaultToken", func() {
+		It("should write ~/.vault-token and be picked up by new clients", func() {
+			home, err := os.MkdirTemp("", "vault-home")
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { _ = os.RemoveAll(home) }()
+			GinkgoT().Setenv("HOME", home)
+			GinkgoT().Setenv("VAULT_TOKEN", "")
+
+			Expect(vault.SaveVaultToken("hvs.saved")).To(Succeed())
+
+			data, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("hvs.saved"))
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Header.Get("X-Vault-Token")).To(Equal("hvs.saved"))
+				writeVaultResponse(w, vault.OIDCTokenResponse{
+					Data: vault.OIDCTokenData{Token: createTestJWT(time.Now().Add(time.Hour).Unix())},
+				})
+			}))
+			defer server.Close()
+
+			client, err := vault.NewClient(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			_, _, err = client.GetOIDCToken(context.Background(), "identity/oidc/token/test_role")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should replace an existing token, readable by the current user only", func() {
+			home, err := os.MkdirTemp("", "vault-home")
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { _ = os.RemoveAll(home) }()
+			GinkgoT().Setenv("HOME", home)
+			tokenFile := filepath.Join(home, ".vault-token")
+			Expect(os.WriteFile(tokenFile, []byte("hvs.old-and-longer"), 0644)).To(Succeed())
+
+			Expect(vault.SaveVaultToken("hvs.saved")).To(Succeed())
+
+			data, err := os.ReadFile(tokenFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("hvs.saved"))
+			info, err := os.Stat(tokenFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+			entries, err := os.ReadDir(home)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+		})
+	})
 })
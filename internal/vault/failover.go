@@ -0,0 +1,129 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault-client-go"
+)
+
+// AddressStore persists the address of the last Vault node that served a
+// request, so the next invocation starts with it.
+type AddressStore interface {
+	LoadAddress() (string, error)
+	SaveAddress(address string) error
+}
+
+// WithAddressStore starts with the address loaded from store, when it is one
+// of the client addresses, and saves the address of the node serving requests
+// when it changes.
+func WithAddressStore(store AddressStore) Option {
+	return func(o *options) {
+		o.addressStore = store
+	}
+}
+
+// node is a Vault server of a client configured with several addresses.
+type node struct {
+	address string
+	client  *vault.Client
+}
+
+// splitAddresses splits a comma-separated list of Vault addresses.
+func splitAddresses(address string) []string {
+	var addresses []string
+	for _, a := range strings.Split(address, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addresses = append(addresses, a)
+		}
+	}
+	return addresses
+}
+
+// Address returns the address of the node that served the last request, or
+// of the node the next request is sent to first.
+func (c *Client) Address() string {
+	return c.nodes[c.current].address
+}
+
+// SetAuthenticator sets the auth method the client logs in again with when
+// a node it failed over to denies the token, since the Vault clusters of a
+// failover list do not share tokens. onLogin, when set, is called with the
+// address of that node and the token of the new login.
+func (c *Client) SetAuthenticator(a Authenticator, onLogin func(address string, auth *Auth)) {
+	c.authenticator, c.onLogin = a, onLogin
+}
+
+// SetFailoverHandler sets a function called with the address and the error of
+// each node that is skipped because it is unavailable.
+func (c *Client) SetFailoverHandler(handler func(address string, err error)) {
+	c.onFailover = handler
+}
+
+func (c *Client) read(ctx context.Context, path string, opts ...vault.RequestOption) (*vault.Response[map[string]interface{}], error) {
+	return c.send(ctx, func(client *vault.Client) (*vault.Response[map[string]interface{}], error) {
+		return client.Read(ctx, path, opts...)
+	})
+}
+
+func (c *Client) write(ctx context.Context, path string, body map[string]interface{}, opts ...vault.RequestOption) (*vault.Response[map[string]interface{}], error) {
+	ctx = context.WithValue(ctx, writeRequestKey{}, true)
+	return c.send(ctx, func(client *vault.Client) (*vault.Response[map[string]interface{}], error) {
+		return client.Write(ctx, path, body, opts...)
+	})
+}
+
+// send sends the request to the current node and fails over to the next
+// nodes, in order, while they are unavailable. A node that denies the token
+// after a failover is sent the request again after a login to it.
+func (c *Client) send(ctx context.Context, request func(*vault.Client) (*vault.Response[map[string]interface{}], error)) (*vault.Response[map[string]interface{}], error) {
+	start := c.current
+	resp, err := c.sendOnce(ctx, request)
+	if c.current == start || !IsPermissionDenied(err) {
+		return resp, err
+	}
+
+	if c.authenticator == nil {
+		return resp, fmt.Errorf("%s denied the Vault token after a failover, which may only be valid on another node: %w", c.Address(), err)
+	}
+	auth, loginErr := c.Login(ctx, c.authenticator)
+	if loginErr != nil {
+		return resp, fmt.Errorf("%s denied the Vault token after a failover and logging in to it failed: %v: %w", c.Address(), loginErr, err)
+	}
+	if c.onLogin != nil {
+		c.onLogin(c.Address(), auth)
+	}
+	return c.sendOnce(ctx, request)
+}
+
+func (c *Client) sendOnce(ctx context.Context, request func(*vault.Client) (*vault.Response[map[string]interface{}], error)) (*vault.Response[map[string]interface{}], error) {
+	var (
+		resp *vault.Response[map[string]interface{}]
+		err  error
+	)
+	for i := range c.nodes {
+		n := (c.current + i) % len(c.nodes)
+		resp, err = request(c.nodes[n].client)
+		if !IsUnavailable(err) || ctx.Err() != nil {
+			c.use(n)
+			return resp, err
+		}
+		if c.onFailover != nil {
+			c.onFailover(c.nodes[n].address, err)
+		}
+	}
+	return resp, err
+}
+
+// use makes n the current node and remembers it for the next invocations.
+func (c *Client) use(n int) {
+	c.current = n
+	if c.addressStore == nil || len(c.nodes) < 2 || c.nodes[n].address == c.savedAddress {
+		return
+	}
+	// Failing to save only costs a failover on the next invocation.
+	if c.addressStore.SaveAddress(c.nodes[n].address) == nil {
+		c.savedAddress = c.nodes[n].address
+	}
+}
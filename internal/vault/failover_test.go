@@ -0,0 +1,236 @@
+package vault_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+type memoryAddressStore struct {
+	address string
+	saves   int
+}
+
+func (s *memoryAddressStore) LoadAddress() (string, error) {
+	return s.address, nil
+}
+
+func (s *memoryAddressStore) SaveAddress(address string) error {
+	s.address = address
+	s.saves++
+	return nil
+}
+
+var _ = Describe("Failover", func() {
+	var (
+		primary, secondary *httptest.Server
+		primaryStatus      int
+		primaryCalls       int
+		secondaryCalls     int
+		noRetry            = vault.WithRetry(vault.RetryConfig{})
+	)
+
+	handler := func(calls *int, status *int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*calls++
+			if status != nil && *status != http.StatusOK {
+				w.WriteHeader(*status)
+				return
+			}
+			writeVaultResponse(w, vault.OIDCTokenResponse{
+				Data: vault.OIDCTokenData{Token: createTestJWT(time.Now().Add(time.Hour).Unix())},
+			})
+		})
+	}
+
+	BeforeEach(func() {
+		primaryStatus, primaryCalls, secondaryCalls = http.StatusOK, 0, 0
+		primary = httptest.NewServer(handler(&primaryCalls, &primaryStatus))
+		secondary = httptest.NewServer(handler(&secondaryCalls, nil))
+	})
+
+	AfterEach(func() {
+		primary.Close()
+		secondary.Close()
+	})
+
+	fetch := func(client *vault.Client) error {
+		_, _, err := client.GetOIDCToken(context.Background(), "identity/oidc/token/test_role")
+		return err
+	}
+
+	It("should use the first address while it is available", func() {
+		client, err := vault.NewClient(primary.URL+","+secondary.URL, noRetry)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fetch(client)).To(Succeed())
+		Expect(client.Address()).To(Equal(primary.URL))
+		Expect(secondaryCalls).To(BeZero())
+	})
+
+	It("should fail over to the next address when a node is unavailable", func() {
+		primaryStatus = http.StatusBadGateway
+		client, err := vault.NewClient(primary.URL+", "+secondary.URL, noRetry)
+		Expect(err).NotTo(HaveOccurred())
+
+		var skipped []string
+		client.SetFailoverHandler(func(address string, err error) {
+			Expect(vault.IsUnavailable(err)).To(BeTrue())
+			skipped = append(skipped, address)
+		})
+
+		Expect(fetch(client)).To(Succeed())
+		Expect(client.Address()).To(Equal(secondary.URL))
+		Expect(skipped).To(Equal([]string{primary.URL}))
+
+		// Later requests go to the healthy node directly.
+		Expect(fetch(client)).To(Succeed())
+		Expect(primaryCalls).To(Equal(1))
+	})
+
+	It("should not fail over on client errors", func() {
+		primaryStatus = http.StatusForbidden
+		client, err := vault.NewClient(primary.URL+","+secondary.URL, noRetry)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(vault.IsPermissionDenied(fetch(client))).To(BeTrue())
+		Expect(secondaryCalls).To(BeZero())
+	})
+
+	It("should return the last error when every node is unavailable", func() {
+		primaryStatus = http.StatusServiceUnavailable
+		secondary.Close()
+		client, err := vault.NewClient(primary.URL+","+secondary.URL, noRetry)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(vault.IsUnavailable(fetch(client))).To(BeTrue())
+		Expect(primaryCalls).To(Equal(1))
+	})
+
+	It("should remember the last healthy address", func() {
+		store := &memoryAddressStore{}
+		primaryStatus = http.StatusBadGateway
+		client, err := vault.NewClient(primary.URL+","+secondary.URL, noRetry, vault.WithAddressStore(store))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetch(client)).To(Succeed())
+		Expect(store.address).To(Equal(secondary.URL))
+
+		primaryCalls = 0
+		client, err = vault.NewClient(primary.URL+","+secondary.URL, noRetry, vault.WithAddressStore(store))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Address()).To(Equal(secondary.URL))
+		Expect(fetch(client)).To(Succeed())
+		Expect(primaryCalls).To(BeZero())
+		Expect(store.saves).To(Equal(1))
+	})
+
+	It("should ignore a remembered address that is not configured anymore", func() {
+		store := &memoryAddressStore{address: "https://removed.example.com"}
+		client, err := vault.NewClient(primary.URL+","+secondary.URL, vault.WithAddressStore(store))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Address()).To(Equal(primary.URL))
+	})
+
+	Context("with nodes that have separate token stores", func() {
+		var (
+			east, west           *httptest.Server
+			eastDown             bool
+			eastLogins           int
+			westLogins           int
+			appRole              = &vault.AppRoleAuth{RoleID: "my-role"}
+			eastToken, westToken = "hvs.east", "hvs.west"
+		)
+
+		// node issues its own token on login and denies the others.
+		node := func(token string, logins *int, down *bool) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if down != nil && *down {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				if r.URL.Path == "/v1/auth/approle/login" {
+					*logins++
+					writeAuthResponse(w, token, 3600)
+					return
+				}
+				if r.Header.Get("X-Vault-Token") != token {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				writeVaultResponse(w, vault.OIDCTokenResponse{
+					Data: vault.OIDCTokenData{Token: createTestJWT(time.Now().Add(time.Hour).Unix())},
+				})
+			})
+		}
+
+		BeforeEach(func() {
+			eastDown, eastLogins, westLogins = false, 0, 0
+			east = httptest.NewServer(node(eastToken, &eastLogins, &eastDown))
+			west = httptest.NewServer(node(westToken, &westLogins, nil))
+		})
+
+		AfterEach(func() {
+			east.Close()
+			west.Close()
+		})
+
+		It("should log in to the node it failed over to when it denies the token", func() {
+			client, err := vault.NewClient(east.URL+","+west.URL, noRetry)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.Login(context.Background(), appRole)
+			Expect(err).NotTo(HaveOccurred())
+
+			var loggedIn []string
+			client.SetAuthenticator(appRole, func(address string, auth *vault.Auth) {
+				loggedIn = append(loggedIn, address+" "+auth.ClientToken)
+			})
+			Expect(fetch(client)).To(Succeed())
+			Expect(loggedIn).To(BeEmpty())
+
+			eastDown = true
+			Expect(fetch(client)).To(Succeed())
+			Expect(client.Address()).To(Equal(west.URL))
+			Expect(client.Token()).To(Equal(westToken))
+			Expect(loggedIn).To(Equal([]string{west.URL + " " + westToken}))
+			Expect(eastLogins).To(Equal(1))
+			Expect(westLogins).To(Equal(1))
+
+			// Later requests use the token of the node they go to.
+			Expect(fetch(client)).To(Succeed())
+			Expect(westLogins).To(Equal(1))
+		})
+
+		It("should report a token denied after a failover without an auth method", func() {
+			client, err := vault.NewClient(east.URL+","+west.URL, noRetry)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.SetToken(eastToken)).To(Succeed())
+
+			eastDown = true
+			err = fetch(client)
+			Expect(vault.IsPermissionDenied(err)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring(west.URL + " denied the Vault token after a failover")))
+			Expect(westLogins).To(BeZero())
+		})
+
+		It("should not log in again when the node it started with denies the token", func() {
+			client, err := vault.NewClient(east.URL+","+west.URL, noRetry)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.SetToken(westToken)).To(Succeed())
+			client.SetAuthenticator(appRole, nil)
+
+			Expect(vault.IsPermissionDenied(fetch(client))).To(BeTrue())
+			Expect(eastLogins).To(BeZero())
+		})
+	})
+
+	It("should require an address", func() {
+		_, err := vault.NewClient(" , ")
+		Expect(err).To(MatchError(ContainSubstring("no vault address")))
+	})
+})
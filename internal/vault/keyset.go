@@ -0,0 +1,58 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/efortin/kubectl-auth-vault/internal/jwt"
+)
+
+const (
+	oidcDiscoveryPath = "identity/oidc/.well-known/openid-configuration"
+	oidcKeysPath      = "identity/oidc/.well-known/keys"
+)
+
+// FetchKeySet returns the issuer and public keys of the tokens minted by the
+// Vault identity OIDC provider of the client's namespace. It implements
+// jwt.KeySetFetcher.
+func (c *Client) FetchKeySet(ctx context.Context) (*jwt.KeySet, error) {
+	var discovery struct {
+		Issuer string `json:"issuer"`
+	}
+	if err := c.readWellKnown(ctx, oidcDiscoveryPath, &discovery); err != nil {
+		return nil, err
+	}
+
+	var keys jwt.KeySet
+	if err := c.readWellKnown(ctx, oidcKeysPath, &keys); err != nil {
+		return nil, err
+	}
+	if len(keys.Keys) == 0 {
+		return nil, fmt.Errorf("no keys returned from vault path: %s", oidcKeysPath)
+	}
+	keys.Issuer = discovery.Issuer
+
+	return &keys, nil
+}
+
+// readWellKnown decodes a well-known document. These are not wrapped in a
+// "data" field, so the Vault client returns the whole document as data.
+func (c *Client) readWellKnown(ctx context.Context, path string, v interface{}) error {
+	resp, err := c.read(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to read from vault path %s: %w", path, err)
+	}
+	if resp == nil || resp.Data == nil {
+		return fmt.Errorf("no data returned from vault path: %s", path)
+	}
+
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
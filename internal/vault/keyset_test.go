@@ -0,0 +1,59 @@
+package vault_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/jwt"
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+var _ = Describe("FetchKeySet", func() {
+	var (
+		server *httptest.Server
+		keys   string
+	)
+
+	BeforeEach(func() {
+		keys = `{"keys": [{"kty": "RSA", "kid": "key-1", "alg": "RS256", "use": "sig", "n": "AQAB", "e": "AQAB"}]}`
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("X-Vault-Namespace")).To(Equal("team-a"))
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/v1/identity/oidc/.well-known/openid-configuration":
+				_, _ = w.Write([]byte(`{"issuer": "https://vault.example.com/v1/team-a/identity/oidc", "jwks_uri": "https://vault.example.com/v1/team-a/identity/oidc/.well-known/keys"}`))
+			case "/v1/identity/oidc/.well-known/keys":
+				_, _ = w.Write([]byte(keys))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should return the issuer and keys of the namespace", func() {
+		client, err := vault.NewClient(server.URL, vault.WithNamespace("team-a"))
+		Expect(err).NotTo(HaveOccurred())
+
+		keySet, err := client.FetchKeySet(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keySet.Issuer).To(Equal("https://vault.example.com/v1/team-a/identity/oidc"))
+		Expect(keySet.Keys).To(Equal([]jwt.JSONWebKey{{Kty: "RSA", Kid: "key-1", Alg: "RS256", Use: "sig", N: "AQAB", E: "AQAB"}}))
+	})
+
+	It("should fail without keys", func() {
+		keys = `{"keys": []}`
+		client, err := vault.NewClient(server.URL, vault.WithNamespace("team-a"))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.FetchKeySet(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("no keys")))
+	})
+})
@@ -0,0 +1,77 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ServiceAccountTokenRequest holds the parameters of a service account token
+// generated by the Kubernetes secrets engine.
+type ServiceAccountTokenRequest struct {
+	// KubernetesNamespace is the namespace the service account is created in.
+	KubernetesNamespace string
+	// TTL defaults to the TTL of the role when zero.
+	TTL time.Duration
+	// ClusterRoleBinding binds the role with a ClusterRoleBinding instead of a
+	// RoleBinding in KubernetesNamespace.
+	ClusterRoleBinding bool
+}
+
+// ServiceAccountToken is a service account token generated by the Kubernetes
+// secrets engine, valid for the duration of its lease.
+type ServiceAccountToken struct {
+	Token                   string
+	ServiceAccountName      string
+	ServiceAccountNamespace string
+	LeaseID                 string
+	LeaseDuration           time.Duration
+}
+
+// GenerateServiceAccountToken generates a service account token from the
+// Kubernetes secrets engine role at path, e.g. "kubernetes/creds/breakglass".
+func (c *Client) GenerateServiceAccountToken(ctx context.Context, path string, req ServiceAccountTokenRequest) (*ServiceAccountToken, error) {
+	if req.KubernetesNamespace == "" {
+		return nil, fmt.Errorf("a Kubernetes namespace is required to generate a service account token")
+	}
+
+	body := map[string]interface{}{"kubernetes_namespace": req.KubernetesNamespace}
+	if req.TTL > 0 {
+		body["ttl"] = req.TTL.String()
+	}
+	if req.ClusterRoleBinding {
+		body["cluster_role_binding"] = true
+	}
+
+	resp, err := c.write(ctx, path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate service account token from vault path %s: %w", path, err)
+	}
+	if resp == nil || resp.Data == nil {
+		return nil, fmt.Errorf("no data returned from vault path: %s", path)
+	}
+
+	token, ok := resp.Data["service_account_token"].(string)
+	if !ok || token == "" {
+		return nil, fmt.Errorf("no 'service_account_token' field in vault response")
+	}
+	name, _ := resp.Data["service_account_name"].(string)
+	namespace, _ := resp.Data["service_account_namespace"].(string)
+
+	return &ServiceAccountToken{
+		Token:                   token,
+		ServiceAccountName:      name,
+		ServiceAccountNamespace: namespace,
+		LeaseID:                 resp.LeaseID,
+		LeaseDuration:           time.Duration(resp.LeaseDuration) * time.Second,
+	}, nil
+}
+
+// RevokeLease revokes the lease of a secret, which deletes the service
+// account of a token generated by the Kubernetes secrets engine.
+func (c *Client) RevokeLease(ctx context.Context, leaseID string) error {
+	if _, err := c.write(ctx, "sys/leases/revoke", map[string]interface{}{"lease_id": leaseID}); err != nil {
+		return fmt.Errorf("failed to revoke lease %s: %w", leaseID, err)
+	}
+	return nil
+}
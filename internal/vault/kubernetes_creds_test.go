@@ -0,0 +1,93 @@
+package vault_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+var _ = Describe("Kubernetes secrets engine", func() {
+	var (
+		server   *httptest.Server
+		client   *vault.Client
+		requests map[string]map[string]interface{}
+	)
+
+	BeforeEach(func() {
+		requests = map[string]map[string]interface{}{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]interface{}
+			Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+			requests[r.URL.Path] = body
+
+			switch r.URL.Path {
+			case "/v1/kubernetes/creds/breakglass":
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"lease_id":       "kubernetes/creds/breakglass/abc",
+					"lease_duration": 900,
+					"data": map[string]interface{}{
+						"service_account_name":      "v-token-breakglass-123",
+						"service_account_namespace": "default",
+						"service_account_token":     "sa-token",
+					},
+				})
+			case "/v1/sys/leases/revoke":
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		var err error
+		client, err = vault.NewClient(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("GenerateServiceAccountToken", func() {
+		It("should return the token and its lease", func() {
+			sa, err := client.GenerateServiceAccountToken(context.Background(), "kubernetes/creds/breakglass", vault.ServiceAccountTokenRequest{
+				KubernetesNamespace: "default",
+				TTL:                 15 * time.Minute,
+				ClusterRoleBinding:  true,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*sa).To(Equal(vault.ServiceAccountToken{
+				Token:                   "sa-token",
+				ServiceAccountName:      "v-token-breakglass-123",
+				ServiceAccountNamespace: "default",
+				LeaseID:                 "kubernetes/creds/breakglass/abc",
+				LeaseDuration:           15 * time.Minute,
+			}))
+			Expect(requests["/v1/kubernetes/creds/breakglass"]).To(Equal(map[string]interface{}{
+				"kubernetes_namespace": "default",
+				"ttl":                  "15m0s",
+				"cluster_role_binding": true,
+			}))
+		})
+
+		It("should require a Kubernetes namespace", func() {
+			_, err := client.GenerateServiceAccountToken(context.Background(), "kubernetes/creds/breakglass", vault.ServiceAccountTokenRequest{})
+			Expect(err).To(MatchError(ContainSubstring("Kubernetes namespace is required")))
+			Expect(requests).To(BeEmpty())
+		})
+	})
+
+	Describe("RevokeLease", func() {
+		It("should revoke the lease", func() {
+			Expect(client.RevokeLease(context.Background(), "kubernetes/creds/breakglass/abc")).To(Succeed())
+			Expect(requests["/v1/sys/leases/revoke"]).To(Equal(map[string]interface{}{"lease_id": "kubernetes/creds/breakglass/abc"}))
+		})
+	})
+})
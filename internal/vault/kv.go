@@ -0,0 +1,107 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault-client-go"
+)
+
+// KVSecret is a secret read from the KV secrets engine.
+type KVSecret struct {
+	Data map[string]interface{}
+	// Version is the version of the secret, zero for KV v1.
+	Version int
+}
+
+// ReadKV reads the secret at path, e.g. "secret/clusters/legacy", from the
+// KV secrets engine, mounted as KV v1 or v2. version pins a version of a KV
+// v2 secret; zero reads the latest one.
+func (c *Client) ReadKV(ctx context.Context, path string, version int) (*KVSecret, error) {
+	path = strings.Trim(path, "/")
+	mount, kvVersion, err := c.kvMount(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if kvVersion < 2 {
+		if version != 0 {
+			return nil, fmt.Errorf("%s is in a KV v1 mount, which does not keep versions", path)
+		}
+		resp, err := c.read(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from vault path %s: %w", path, err)
+		}
+		if resp == nil || resp.Data == nil {
+			return nil, fmt.Errorf("no data returned from vault path: %s", path)
+		}
+		return &KVSecret{Data: resp.Data}, nil
+	}
+
+	dataPath := mount + "data/" + strings.TrimPrefix(path, mount)
+	var opts []vault.RequestOption
+	if version != 0 {
+		opts = append(opts, vault.WithQueryParameters(url.Values{"version": {strconv.Itoa(version)}}))
+	}
+	resp, err := c.read(ctx, dataPath, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from vault path %s: %w", dataPath, err)
+	}
+	if resp == nil || resp.Data == nil {
+		return nil, fmt.Errorf("no data returned from vault path: %s", dataPath)
+	}
+
+	var kv struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata struct {
+			Version int `json:"version"`
+		} `json:"metadata"`
+	}
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &kv); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", dataPath, err)
+	}
+	if kv.Data == nil {
+		return nil, fmt.Errorf("version %d of %s is deleted or destroyed", kv.Metadata.Version, path)
+	}
+	return &KVSecret{Data: kv.Data, Version: kv.Metadata.Version}, nil
+}
+
+// kvMount returns the path, with a trailing slash, and the version of the KV
+// mount holding path, like the Vault CLI does.
+func (c *Client) kvMount(ctx context.Context, path string) (string, int, error) {
+	resp, err := c.read(ctx, "sys/internal/ui/mounts/"+path)
+	if vault.IsErrorStatus(err, http.StatusNotFound) {
+		// Vault versions without this endpoint only have KV v1.
+		return "", 1, nil
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to look up the KV mount of %s: %w", path, err)
+	}
+	if resp == nil || resp.Data == nil {
+		return "", 0, fmt.Errorf("no mount found for vault path: %s", path)
+	}
+
+	mount, _ := resp.Data["path"].(string)
+	if mountType, _ := resp.Data["type"].(string); mountType != "kv" && mountType != "generic" {
+		return "", 0, fmt.Errorf("%s is not in a KV mount (%s is a %q mount)", path, mount, mountType)
+	}
+
+	version := 1
+	if options, ok := resp.Data["options"].(map[string]interface{}); ok {
+		if v, ok := options["version"].(string); ok && v != "" {
+			if version, err = strconv.Atoi(v); err != nil {
+				return "", 0, fmt.Errorf("invalid KV version %q of mount %s", v, mount)
+			}
+		}
+	}
+	return mount, version, nil
+}
@@ -0,0 +1,123 @@
+package vault_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+var _ = Describe("KV", func() {
+	var (
+		server      *httptest.Server
+		client      *vault.Client
+		mount       map[string]interface{}
+		mountStatus int
+		query       string
+	)
+
+	writeData := func(w http.ResponseWriter, data interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}
+
+	BeforeEach(func() {
+		mountStatus, query = http.StatusOK, ""
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1/sys/internal/ui/mounts/secret/clusters/legacy":
+				if mountStatus != http.StatusOK {
+					w.WriteHeader(mountStatus)
+					return
+				}
+				writeData(w, mount)
+			case "/v1/secret/clusters/legacy":
+				writeData(w, map[string]interface{}{"token": "v1-token"})
+			case "/v1/secret/data/clusters/legacy":
+				query = r.URL.RawQuery
+				if r.URL.Query().Get("version") == "1" {
+					writeData(w, map[string]interface{}{
+						"data":     nil,
+						"metadata": map[string]interface{}{"version": 1, "destroyed": true},
+					})
+					return
+				}
+				writeData(w, map[string]interface{}{
+					"data":     map[string]interface{}{"token": "v2-token"},
+					"metadata": map[string]interface{}{"version": 3},
+				})
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		var err error
+		client, err = vault.NewClient(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("with a KV v2 mount", func() {
+		BeforeEach(func() {
+			mount = map[string]interface{}{"path": "secret/", "type": "kv", "options": map[string]interface{}{"version": "2"}}
+		})
+
+		It("should read the latest version of the secret", func() {
+			secret, err := client.ReadKV(context.Background(), "secret/clusters/legacy", 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secret.Data).To(Equal(map[string]interface{}{"token": "v2-token"}))
+			Expect(secret.Version).To(Equal(3))
+			Expect(query).To(BeEmpty())
+		})
+
+		It("should read a pinned version", func() {
+			_, err := client.ReadKV(context.Background(), "/secret/clusters/legacy", 3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(query).To(Equal("version=3"))
+		})
+
+		It("should fail for a destroyed version", func() {
+			_, err := client.ReadKV(context.Background(), "secret/clusters/legacy", 1)
+			Expect(err).To(MatchError(ContainSubstring("version 1 of secret/clusters/legacy is deleted or destroyed")))
+		})
+	})
+
+	Context("with a KV v1 mount", func() {
+		BeforeEach(func() {
+			mount = map[string]interface{}{"path": "secret/", "type": "kv", "options": nil}
+		})
+
+		It("should read the secret", func() {
+			secret, err := client.ReadKV(context.Background(), "secret/clusters/legacy", 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secret.Data).To(Equal(map[string]interface{}{"token": "v1-token"}))
+			Expect(secret.Version).To(BeZero())
+		})
+
+		It("should reject pinned versions", func() {
+			_, err := client.ReadKV(context.Background(), "secret/clusters/legacy", 2)
+			Expect(err).To(MatchError(ContainSubstring("does not keep versions")))
+		})
+
+		It("should be assumed when the mount cannot be looked up", func() {
+			mountStatus = http.StatusNotFound
+			secret, err := client.ReadKV(context.Background(), "secret/clusters/legacy", 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secret.Data).To(HaveKeyWithValue("token", "v1-token"))
+		})
+	})
+
+	It("should reject paths outside of KV mounts", func() {
+		mount = map[string]interface{}{"path": "secret/", "type": "pki"}
+		_, err := client.ReadKV(context.Background(), "secret/clusters/legacy", 0)
+		Expect(err).To(MatchError(ContainSubstring(`is a "pki" mount`)))
+	})
+})
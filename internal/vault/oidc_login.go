@@ -0,0 +1,191 @@
+package vault
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/hashicorp/vault-client-go"
+)
+
+// DefaultOIDCListenAddress is the callback address used by the Vault CLI,
+// which OIDC roles usually already allow as redirect URI.
+const DefaultOIDCListenAddress = "localhost:8250"
+
+const oidcCallbackPath = "/oidc/callback"
+
+// OIDCAuth logs in with the OIDC auth method through the user's browser.
+type OIDCAuth struct {
+	// MountPath is the path the OIDC auth method is mounted at (default: oidc).
+	MountPath string
+	// Role is the OIDC role, empty for the mount's default role.
+	Role string
+	// ListenAddress is the local callback listener address (default: DefaultOIDCListenAddress).
+	ListenAddress string
+	// OpenURL opens the provider's authorization URL, typically in a browser.
+	// When nil, the user is only asked to open the URL manually.
+	OpenURL func(url string) error
+	// Out receives the instructions for the user; it must not be the stream
+	// carrying the ExecCredential.
+	Out io.Writer
+}
+
+type oidcCallback struct {
+	code  string
+	state string
+	err   error
+}
+
+func (a *OIDCAuth) Login(ctx context.Context, c *Client) (*Auth, error) {
+	mountPath := mountPathOrDefault(a.MountPath, "oidc")
+	listenAddress := a.ListenAddress
+	if listenAddress == "" {
+		listenAddress = DefaultOIDCListenAddress
+	}
+
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start OIDC callback listener: %w", err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	redirectURI, err := callbackURI(listenAddress, listener.Addr())
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := c.oidcAuthURL(ctx, mountPath, a.Role, redirectURI, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	callbacks := make(chan oidcCallback, 1)
+	server := &http.Server{Handler: oidcCallbackHandler(callbacks)}
+	go func() { _ = server.Serve(listener) }()
+	defer func() { _ = server.Close() }()
+
+	out := a.Out
+	if out == nil {
+		out = io.Discard
+	}
+	_, _ = fmt.Fprintf(out, "Complete the login via your OIDC provider. Open the following URL in your browser:\n\n    %s\n\n", authURL)
+	if a.OpenURL != nil {
+		if err := a.OpenURL(authURL); err != nil {
+			_, _ = fmt.Fprintf(out, "warning: failed to open browser: %v\n", err)
+		}
+	}
+	_, _ = fmt.Fprintf(out, "Waiting for OIDC authentication to complete...\n")
+
+	var cb oidcCallback
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("OIDC login aborted: %w", ctx.Err())
+	case cb = <-callbacks:
+	}
+	if cb.err != nil {
+		return nil, cb.err
+	}
+
+	return c.oidcCallback(ctx, mountPath, cb, nonce)
+}
+
+func (c *Client) oidcAuthURL(ctx context.Context, mountPath, role, redirectURI, nonce string) (string, error) {
+	path := "auth/" + mountPath + "/oidc/auth_url"
+	resp, err := c.write(ctx, path, map[string]interface{}{
+		"role":         role,
+		"redirect_uri": redirectURI,
+		"client_nonce": nonce,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to request OIDC auth URL: %w", err)
+	}
+
+	var authURL string
+	if resp != nil && resp.Data != nil {
+		authURL, _ = resp.Data["auth_url"].(string)
+	}
+	if authURL == "" {
+		return "", fmt.Errorf("vault returned no OIDC auth URL; check that %s is an allowed redirect URI for the role", redirectURI)
+	}
+
+	return authURL, nil
+}
+
+func (c *Client) oidcCallback(ctx context.Context, mountPath string, cb oidcCallback, nonce string) (*Auth, error) {
+	path := "auth/" + mountPath + "/oidc/callback"
+	resp, err := c.read(ctx, path, vault.WithQueryParameters(url.Values{
+		"code":         {cb.code},
+		"state":        {cb.state},
+		"client_nonce": {nonce},
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete OIDC login: %w", err)
+	}
+
+	return authFromResponse(resp, path)
+}
+
+func oidcCallbackHandler(callbacks chan<- oidcCallback) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(oidcCallbackPath, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		var cb oidcCallback
+		switch {
+		case query.Get("error") != "":
+			cb.err = fmt.Errorf("OIDC provider returned an error: %s %s", query.Get("error"), query.Get("error_description"))
+		case query.Get("code") == "":
+			cb.err = errors.New("OIDC callback did not include an authorization code")
+		default:
+			cb.code = query.Get("code")
+			cb.state = query.Get("state")
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if cb.err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, "<html><body>Vault login failed, see the terminal for details.</body></html>")
+		} else {
+			_, _ = fmt.Fprint(w, "<html><body>Vault login successful, you can close this window.</body></html>")
+		}
+
+		select {
+		case callbacks <- cb:
+		default:
+		}
+	})
+	return mux
+}
+
+// callbackURI builds the redirect URI from the configured host, so that
+// "localhost" stays "localhost", and the port actually bound.
+func callbackURI(listenAddress string, bound net.Addr) (string, error) {
+	host, _, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return "", fmt.Errorf("invalid OIDC listen address %q: %w", listenAddress, err)
+	}
+	_, port, err := net.SplitHostPort(bound.String())
+	if err != nil {
+		return "", err
+	}
+	return "http://" + net.JoinHostPort(host, port) + oidcCallbackPath, nil
+}
+
+func randomNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
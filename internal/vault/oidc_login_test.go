@@ -0,0 +1,136 @@
+package vault_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+var _ = Describe("OIDCAuth", func() {
+	var (
+		vaultServer *httptest.Server
+		idpServer   *httptest.Server
+		idpError    string
+	)
+
+	BeforeEach(func() {
+		idpError = ""
+		idpServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			redirect, err := url.Parse(r.URL.Query().Get("redirect_uri"))
+			Expect(err).NotTo(HaveOccurred())
+			query := url.Values{"state": {"st"}}
+			if idpError != "" {
+				query.Set("error", idpError)
+			} else {
+				query.Set("code", "abc")
+			}
+			redirect.RawQuery = query.Encode()
+			http.Redirect(w, r, redirect.String(), http.StatusFound)
+		}))
+
+		var nonce string
+		vaultServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1/auth/oidc/oidc/auth_url":
+				var body map[string]string
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				Expect(body["role"]).To(Equal("k8s-users"))
+				Expect(body["redirect_uri"]).To(HavePrefix("http://127.0.0.1:"))
+				Expect(body["redirect_uri"]).To(HaveSuffix("/oidc/callback"))
+				nonce = body["client_nonce"]
+				Expect(nonce).NotTo(BeEmpty())
+
+				authURL := idpServer.URL + "/authorize?" + url.Values{"redirect_uri": {body["redirect_uri"]}}.Encode()
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"data": map[string]interface{}{"auth_url": authURL},
+				})
+			case "/v1/auth/oidc/oidc/callback":
+				query := r.URL.Query()
+				Expect(query.Get("code")).To(Equal("abc"))
+				Expect(query.Get("state")).To(Equal("st"))
+				Expect(query.Get("client_nonce")).To(Equal(nonce))
+				writeAuthResponse(w, "hvs.oidc", 3600)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		vaultServer.Close()
+		idpServer.Close()
+	})
+
+	browser := func(authURL string) error {
+		go func() {
+			resp, err := http.Get(authURL)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+		}()
+		return nil
+	}
+
+	It("should complete the browser flow and return the Vault token", func() {
+		client, err := vault.NewClient(vaultServer.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		var out bytes.Buffer
+		auth, err := client.Login(context.Background(), &vault.OIDCAuth{
+			Role:          "k8s-users",
+			ListenAddress: "127.0.0.1:0",
+			OpenURL:       browser,
+			Out:           &out,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(auth.ClientToken).To(Equal("hvs.oidc"))
+		Expect(out.String()).To(ContainSubstring(idpServer.URL))
+	})
+
+	It("should return the provider error", func() {
+		idpError = "access_denied"
+		client, err := vault.NewClient(vaultServer.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.Login(context.Background(), &vault.OIDCAuth{
+			Role:          "k8s-users",
+			ListenAddress: "127.0.0.1:0",
+			OpenURL:       browser,
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("access_denied"))
+	})
+
+	It("should give up when the context expires", func() {
+		client, err := vault.NewClient(vaultServer.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		_, err = client.Login(ctx, &vault.OIDCAuth{
+			Role:          "k8s-users",
+			ListenAddress: "127.0.0.1:0",
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("aborted"))
+	})
+
+	It("should reject an invalid listen address", func() {
+		client, err := vault.NewClient(vaultServer.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.Login(context.Background(), &vault.OIDCAuth{ListenAddress: "not-an-address"})
+		Expect(err).To(HaveOccurred())
+	})
+})
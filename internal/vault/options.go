@@ -0,0 +1,124 @@
+package vault
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Option configures a Client.
+type Option func(*options)
+
+type options struct {
+	namespace string
+	tls       TLSConfig
+	timeout   time.Duration
+	retry     RetryConfig
+
+	addressStore AddressStore
+}
+
+// WithNamespace sends all requests to the given Vault Enterprise namespace.
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithTLS configures how the client verifies Vault and authenticates to it.
+func WithTLS(tls TLSConfig) Option {
+	return func(o *options) {
+		o.tls = tls
+	}
+}
+
+// TLSConfig holds the TLS settings used to connect to Vault. The fields
+// mirror the Vault CLI flags and environment variables.
+type TLSConfig struct {
+	// CACert is a PEM-encoded CA bundle file (VAULT_CACERT).
+	CACert string
+	// CAPath is a directory of PEM-encoded CA certificates (VAULT_CAPATH).
+	CAPath string
+	// ClientCert and ClientKey are the PEM-encoded client certificate and
+	// key used for mTLS (VAULT_CLIENT_CERT, VAULT_CLIENT_KEY).
+	ClientCert string
+	ClientKey  string
+	// ServerName overrides the name used to verify the server certificate
+	// and sent as SNI (VAULT_TLS_SERVER_NAME).
+	ServerName string
+	// Insecure disables server certificate verification (VAULT_SKIP_VERIFY).
+	Insecure bool
+}
+
+// IsZero reports whether no TLS setting is configured.
+func (t TLSConfig) IsZero() bool {
+	return t == TLSConfig{}
+}
+
+// Validate checks that the configured files exist and hold usable
+// certificates, and that the client certificate has not expired.
+func (t TLSConfig) Validate() error {
+	if t.CACert != "" {
+		data, err := os.ReadFile(t.CACert)
+		if err != nil {
+			return fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(data) {
+			return fmt.Errorf("no valid PEM certificate found in %s", t.CACert)
+		}
+	}
+
+	if t.CAPath != "" {
+		info, err := os.Stat(t.CAPath)
+		if err != nil {
+			return fmt.Errorf("failed to read CA path: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("CA path %s is not a directory", t.CAPath)
+		}
+	}
+
+	if (t.ClientCert == "") != (t.ClientKey == "") {
+		return fmt.Errorf("client certificate and client key must be provided together")
+	}
+
+	if t.ClientCert != "" {
+		pair, err := tls.LoadX509KeyPair(t.ClientCert, t.ClientKey)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		leaf, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("failed to parse client certificate: %w", err)
+		}
+		if time.Now().After(leaf.NotAfter) {
+			return fmt.Errorf("client certificate %s expired at %s", t.ClientCert, leaf.NotAfter.Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
+
+// ClientCertificateExpiry returns the NotAfter of the configured client
+// certificate, or the zero time when none is configured or it cannot be read.
+func (t TLSConfig) ClientCertificateExpiry() time.Time {
+	if t.ClientCert == "" {
+		return time.Time{}
+	}
+	data, err := os.ReadFile(t.ClientCert)
+	if err != nil {
+		return time.Time{}
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return time.Time{}
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}
+	}
+	return cert.NotAfter
+}
@@ -0,0 +1,165 @@
+package vault_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+// writeClientCertificate writes a self-signed client certificate and its key
+// to dir and returns their paths.
+func writeClientCertificate(dir string, notAfter time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test-client"},
+		NotBefore:    time.Now().Add(-2 * time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	Expect(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)).To(Succeed())
+	Expect(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)).To(Succeed())
+	return certFile, keyFile
+}
+
+var _ = Describe("TLS", func() {
+	var (
+		server *httptest.Server
+		tmpDir string
+		caFile string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "vault-tls-test")
+		Expect(err).NotTo(HaveOccurred())
+
+		server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeVaultResponse(w, vault.OIDCTokenResponse{
+				Data: vault.OIDCTokenData{Token: createTestJWT(time.Now().Add(time.Hour).Unix())},
+			})
+		}))
+	})
+
+	JustBeforeEach(func() {
+		server.StartTLS()
+		caFile = filepath.Join(tmpDir, "ca.pem")
+		Expect(os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		_ = os.RemoveAll(tmpDir)
+	})
+
+	fetch := func(tlsConfig vault.TLSConfig) error {
+		client, err := vault.NewClient(server.URL, vault.WithTLS(tlsConfig))
+		if err != nil {
+			return err
+		}
+		_, _, err = client.GetOIDCToken(context.Background(), "identity/oidc/token/test_role")
+		return err
+	}
+
+	It("should reject a server signed by an unknown CA", func() {
+		Expect(fetch(vault.TLSConfig{})).NotTo(Succeed())
+	})
+
+	It("should trust the configured CA bundle", func() {
+		Expect(fetch(vault.TLSConfig{CACert: caFile})).To(Succeed())
+	})
+
+	It("should trust a directory of CA certificates", func() {
+		Expect(fetch(vault.TLSConfig{CAPath: tmpDir})).To(Succeed())
+	})
+
+	It("should skip verification when insecure", func() {
+		Expect(fetch(vault.TLSConfig{Insecure: true})).To(Succeed())
+	})
+
+	It("should verify the configured server name", func() {
+		Expect(fetch(vault.TLSConfig{CACert: caFile, ServerName: "example.com"})).To(Succeed())
+		Expect(fetch(vault.TLSConfig{CACert: caFile, ServerName: "wrong.example.org"})).NotTo(Succeed())
+	})
+
+	It("should fail to create a client with an unreadable CA bundle", func() {
+		_, err := vault.NewClient(server.URL, vault.WithTLS(vault.TLSConfig{CACert: filepath.Join(tmpDir, "missing.pem")}))
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("when the server requires a client certificate", func() {
+		BeforeEach(func() {
+			server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+		})
+
+		It("should authenticate with the configured client certificate", func() {
+			certFile, keyFile := writeClientCertificate(tmpDir, time.Now().Add(time.Hour))
+			Expect(fetch(vault.TLSConfig{CACert: caFile, ClientCert: certFile, ClientKey: keyFile})).To(Succeed())
+		})
+	})
+
+	Describe("Validate", func() {
+		It("should accept an empty configuration", func() {
+			Expect(vault.TLSConfig{}.Validate()).To(Succeed())
+		})
+
+		It("should accept valid files", func() {
+			certFile, keyFile := writeClientCertificate(tmpDir, time.Now().Add(time.Hour))
+			tlsConfig := vault.TLSConfig{CACert: caFile, CAPath: tmpDir, ClientCert: certFile, ClientKey: keyFile}
+			Expect(tlsConfig.Validate()).To(Succeed())
+			Expect(tlsConfig.ClientCertificateExpiry()).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+		})
+
+		It("should reject a missing CA bundle", func() {
+			Expect(vault.TLSConfig{CACert: filepath.Join(tmpDir, "missing.pem")}.Validate()).NotTo(Succeed())
+		})
+
+		It("should reject a CA bundle without certificates", func() {
+			badCA := filepath.Join(tmpDir, "bad.pem")
+			Expect(os.WriteFile(badCA, []byte("not a certificate"), 0600)).To(Succeed())
+			Expect(vault.TLSConfig{CACert: badCA}.Validate()).NotTo(Succeed())
+		})
+
+		It("should reject a CA path that is not a directory", func() {
+			Expect(vault.TLSConfig{CAPath: caFile}.Validate()).NotTo(Succeed())
+		})
+
+		It("should require the client certificate and key together", func() {
+			certFile, _ := writeClientCertificate(tmpDir, time.Now().Add(time.Hour))
+			Expect(vault.TLSConfig{ClientCert: certFile}.Validate()).NotTo(Succeed())
+		})
+
+		It("should reject an expired client certificate", func() {
+			certFile, keyFile := writeClientCertificate(tmpDir, time.Now().Add(-time.Hour))
+			err := vault.TLSConfig{ClientCert: certFile, ClientKey: keyFile}.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("expired"))
+		})
+	})
+})
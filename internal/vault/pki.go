@@ -0,0 +1,114 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CertificateRequest holds the parameters of a certificate issued by the PKI
+// secrets engine. Zero values are left to the defaults of the PKI role.
+type CertificateRequest struct {
+	// CommonName becomes the Kubernetes user name of the certificate.
+	CommonName string
+	TTL        time.Duration
+}
+
+// Certificate is a client certificate issued by the PKI secrets engine.
+type Certificate struct {
+	// Certificate and PrivateKey are PEM-encoded. Certificate is followed by
+	// the intermediate CAs that issued it, so that the Kubernetes API server
+	// can build the chain to the root CA it trusts.
+	Certificate  string
+	PrivateKey   string
+	SerialNumber string
+	NotAfter     time.Time
+}
+
+// IssueCertificate issues a certificate and its private key from the PKI
+// role at path, e.g. "pki/issue/kubernetes".
+func (c *Client) IssueCertificate(ctx context.Context, path string, req CertificateRequest) (*Certificate, error) {
+	body := map[string]interface{}{}
+	if req.CommonName != "" {
+		body["common_name"] = req.CommonName
+	}
+	if req.TTL > 0 {
+		body["ttl"] = req.TTL.String()
+	}
+
+	resp, err := c.write(ctx, path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue certificate from vault path %s: %w", path, err)
+	}
+	if resp == nil || resp.Data == nil {
+		return nil, fmt.Errorf("no data returned from vault path: %s", path)
+	}
+
+	certificate, _ := resp.Data["certificate"].(string)
+	privateKey, _ := resp.Data["private_key"].(string)
+	if certificate == "" || privateKey == "" {
+		return nil, fmt.Errorf("no certificate and private key in vault response from %s", path)
+	}
+	serialNumber, _ := resp.Data["serial_number"].(string)
+
+	block, _ := pem.Decode([]byte(certificate))
+	if block == nil {
+		return nil, fmt.Errorf("certificate from %s is not PEM-encoded", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate from %s: %w", path, err)
+	}
+
+	chain, err := intermediateCAs(resp.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA chain from %s: %w", path, err)
+	}
+
+	return &Certificate{
+		Certificate:  strings.TrimRight(certificate, "\n") + "\n" + chain,
+		PrivateKey:   privateKey,
+		SerialNumber: serialNumber,
+		NotAfter:     cert.NotAfter,
+	}, nil
+}
+
+// intermediateCAs returns the PEM-encoded CA certificates Vault returns with
+// an issued certificate, in ca_chain or else issuing_ca, leaving out the
+// self-signed root CAs that clients do not send.
+func intermediateCAs(data map[string]interface{}) (string, error) {
+	var entries []string
+	if caChain, ok := data["ca_chain"].([]interface{}); ok {
+		for _, entry := range caChain {
+			if entry, ok := entry.(string); ok {
+				entries = append(entries, entry)
+			}
+		}
+	} else if issuingCA, ok := data["issuing_ca"].(string); ok {
+		entries = append(entries, issuingCA)
+	}
+
+	var chain []byte
+	for _, entry := range entries {
+		rest := []byte(entry)
+		for {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return "", err
+			}
+			if bytes.Equal(cert.RawSubject, cert.RawIssuer) {
+				continue
+			}
+			chain = append(chain, pem.EncodeToMemory(block)...)
+		}
+	}
+	return string(chain), nil
+}
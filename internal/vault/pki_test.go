@@ -0,0 +1,221 @@
+package vault_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+var _ = Describe("PKI", func() {
+	var (
+		server   *httptest.Server
+		tmpDir   string
+		notAfter time.Time
+		certPEM  string
+		keyPEM   string
+		request  map[string]interface{}
+		caData   map[string]interface{}
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "vault-pki-test")
+		Expect(err).NotTo(HaveOccurred())
+
+		notAfter = time.Now().Add(time.Hour).Truncate(time.Second)
+		certFile, keyFile := writeClientCertificate(tmpDir, notAfter)
+		certData, err := os.ReadFile(certFile)
+		Expect(err).NotTo(HaveOccurred())
+		keyData, err := os.ReadFile(keyFile)
+		Expect(err).NotTo(HaveOccurred())
+		certPEM, keyPEM = string(certData), string(keyData)
+
+		request, caData = nil, nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(r.URL.Path).To(Equal("/v1/pki/issue/kubernetes"))
+			Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+			data := map[string]interface{}{
+				"certificate":   certPEM,
+				"private_key":   keyPEM,
+				"serial_number": "01",
+			}
+			for k, v := range caData {
+				data[k] = v
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		_ = os.RemoveAll(tmpDir)
+	})
+
+	It("should issue a certificate and return its expiry", func() {
+		client, err := vault.NewClient(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		cert, err := client.IssueCertificate(context.Background(), "pki/issue/kubernetes", vault.CertificateRequest{
+			CommonName: "jane",
+			TTL:        30 * time.Minute,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cert.Certificate).To(Equal(certPEM))
+		Expect(cert.PrivateKey).To(Equal(keyPEM))
+		Expect(cert.SerialNumber).To(Equal("01"))
+		Expect(cert.NotAfter.Equal(notAfter)).To(BeTrue())
+		Expect(request).To(Equal(map[string]interface{}{"common_name": "jane", "ttl": "30m0s"}))
+	})
+
+	It("should leave unset parameters to the PKI role", func() {
+		client, err := vault.NewClient(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.IssueCertificate(context.Background(), "pki/issue/kubernetes", vault.CertificateRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(request).To(BeEmpty())
+	})
+
+	Context("with a certificate issued by an intermediate CA", func() {
+		var rootPEM, intermediatePEM string
+
+		BeforeEach(func() {
+			root, rootKey := newCA("root", nil, nil)
+			intermediate, intermediateKey := newCA("intermediate", root, rootKey)
+			rootPEM, intermediatePEM = encodeCertificate(root), encodeCertificate(intermediate)
+
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+				SerialNumber: big.NewInt(3),
+				Subject:      pkix.Name{CommonName: "jane"},
+				NotBefore:    time.Now().Add(-time.Hour),
+				NotAfter:     notAfter,
+				KeyUsage:     x509.KeyUsageDigitalSignature,
+				ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			}, intermediate, &key.PublicKey, intermediateKey)
+			Expect(err).NotTo(HaveOccurred())
+			// Vault returns the certificate without a trailing newline.
+			certPEM = strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+		})
+
+		// verify checks that the certificate chains up to the root CA with
+		// only the intermediates sent along with it.
+		verify := func(cert *vault.Certificate) {
+			var certificates []*x509.Certificate
+			rest := []byte(cert.Certificate)
+			for {
+				var block *pem.Block
+				if block, rest = pem.Decode(rest); block == nil {
+					break
+				}
+				c, err := x509.ParseCertificate(block.Bytes)
+				Expect(err).NotTo(HaveOccurred())
+				certificates = append(certificates, c)
+			}
+			Expect(certificates).To(HaveLen(2))
+
+			roots := x509.NewCertPool()
+			Expect(roots.AppendCertsFromPEM([]byte(rootPEM))).To(BeTrue())
+			intermediates := x509.NewCertPool()
+			intermediates.AddCert(certificates[1])
+			_, err := certificates[0].Verify(x509.VerifyOptions{
+				Roots:         roots,
+				Intermediates: intermediates,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		It("should append the intermediates of ca_chain without the root", func() {
+			caData = map[string]interface{}{
+				"issuing_ca": intermediatePEM,
+				"ca_chain":   []string{intermediatePEM, rootPEM},
+			}
+			client, err := vault.NewClient(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+
+			cert, err := client.IssueCertificate(context.Background(), "pki/issue/kubernetes", vault.CertificateRequest{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cert.Certificate).To(Equal(certPEM + "\n" + intermediatePEM))
+			Expect(cert.NotAfter.Equal(notAfter)).To(BeTrue())
+			verify(cert)
+		})
+
+		It("should append issuing_ca without ca_chain", func() {
+			caData = map[string]interface{}{"issuing_ca": intermediatePEM}
+			client, err := vault.NewClient(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+
+			cert, err := client.IssueCertificate(context.Background(), "pki/issue/kubernetes", vault.CertificateRequest{})
+			Expect(err).NotTo(HaveOccurred())
+			verify(cert)
+		})
+
+		It("should not append a root issuing_ca", func() {
+			caData = map[string]interface{}{"issuing_ca": rootPEM}
+			client, err := vault.NewClient(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+
+			cert, err := client.IssueCertificate(context.Background(), "pki/issue/kubernetes", vault.CertificateRequest{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cert.Certificate).To(Equal(certPEM + "\n"))
+		})
+	})
+
+	It("should fail without a certificate in the response", func() {
+		certPEM = ""
+		client, err := vault.NewClient(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.IssueCertificate(context.Background(), "pki/issue/kubernetes", vault.CertificateRequest{})
+		Expect(err).To(MatchError(ContainSubstring("no certificate and private key")))
+	})
+})
+
+// newCA returns a CA certificate and its key, signed by parent or
+// self-signed when parent is nil.
+func newCA(name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-2 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	Expect(err).NotTo(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+	return cert, key
+}
+
+func encodeCertificate(cert *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
@@ -0,0 +1,111 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/hashicorp/vault-client-go"
+)
+
+const (
+	// DefaultTimeout bounds each Vault request, including its retries.
+	DefaultTimeout = 30 * time.Second
+	// DefaultMaxRetries is the number of retries after a transient failure.
+	DefaultMaxRetries = 3
+)
+
+// RetryConfig controls how requests failing with a transient error are
+// retried: network errors (e.g. connection resets), 412, 429 and 5xx
+// responses other than 501. Standby redirects are followed by the client.
+// Writes, which may not be idempotent (e.g. issuing a certificate), are only
+// retried when the connection to Vault could not be established.
+type RetryConfig struct {
+	// MaxRetries is the number of retries after the first attempt, 0
+	// disables retries.
+	MaxRetries int
+	// WaitMin and WaitMax bound the exponential backoff between attempts.
+	WaitMin time.Duration
+	WaitMax time.Duration
+}
+
+// DefaultRetryConfig returns the retry settings used when WithRetry is not
+// given.
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxRetries: DefaultMaxRetries,
+		WaitMin:    250 * time.Millisecond,
+		WaitMax:    4 * time.Second,
+	}
+}
+
+// WithRetry configures how transient failures are retried.
+func WithRetry(retry RetryConfig) Option {
+	return func(o *options) {
+		o.retry = retry
+	}
+}
+
+// WithTimeout bounds each request to Vault, including all its retries. The
+// context of the request bounds the time across requests.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+func (r RetryConfig) clientConfiguration() vault.RetryConfiguration {
+	return vault.RetryConfiguration{
+		RetryMax:     r.MaxRetries,
+		RetryWaitMin: r.WaitMin,
+		RetryWaitMax: r.WaitMax,
+		CheckRetry:   checkRetry,
+		Backoff:      backoff,
+		ErrorHandler: retryablehttp.PassthroughErrorHandler,
+	}
+}
+
+// writeRequestKey marks the context of write requests for checkRetry.
+type writeRequestKey struct{}
+
+// checkRetry applies the default retry policy of the Vault client to reads.
+// A write is only retried when the request never reached Vault: after a
+// response timeout or a 5xx response, Vault may have applied it already, and
+// sending it again could e.g. issue a second certificate or service account.
+func checkRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	retry, checkErr := vault.DefaultRetryPolicy(ctx, resp, err)
+	if !retry || ctx.Value(writeRequestKey{}) == nil {
+		return retry, checkErr
+	}
+
+	var opError *net.OpError
+	return errors.As(err, &opError) && opError.Op == "dial", nil
+}
+
+// backoff doubles the wait on every attempt, starting at waitMin and capped
+// at waitMax, and picks a random wait between half and all of it so that
+// clients failing together do not retry together. A Retry-After header on 429
+// and 503 responses is honored, up to waitMax.
+func backoff(waitMin, waitMax time.Duration, attempt int, resp *http.Response) time.Duration {
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return min(time.Duration(seconds)*time.Second, waitMax)
+		}
+	}
+
+	wait := waitMax
+	if attempt < 32 {
+		if d := waitMin << attempt; d > 0 && d < waitMax {
+			wait = d
+		}
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return wait/2 + rand.N(wait/2+1)
+}
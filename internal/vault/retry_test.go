@@ -0,0 +1,134 @@
+package vault_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+var _ = Describe("Retries", func() {
+	var (
+		server   *httptest.Server
+		failures int32
+		status   int
+		calls    atomic.Int32
+	)
+
+	fastRetry := func(maxRetries int) vault.Option {
+		return vault.WithRetry(vault.RetryConfig{MaxRetries: maxRetries, WaitMin: time.Millisecond, WaitMax: 10 * time.Millisecond})
+	}
+
+	BeforeEach(func() {
+		failures, status = 0, http.StatusBadGateway
+		calls.Store(0)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) <= failures {
+				w.WriteHeader(status)
+				return
+			}
+			writeVaultResponse(w, vault.OIDCTokenResponse{
+				Data: vault.OIDCTokenData{Token: createTestJWT(time.Now().Add(time.Hour).Unix())},
+			})
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	fetch := func(opts ...vault.Option) error {
+		client, err := vault.NewClient(server.URL, opts...)
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = client.GetOIDCToken(context.Background(), "identity/oidc/token/test_role")
+		return err
+	}
+
+	It("should retry transient server errors", func() {
+		failures = 3
+		Expect(fetch(fastRetry(3))).To(Succeed())
+		Expect(calls.Load()).To(Equal(int32(4)))
+	})
+
+	It("should retry rate limited requests", func() {
+		failures, status = 1, http.StatusTooManyRequests
+		Expect(fetch(fastRetry(1))).To(Succeed())
+		Expect(calls.Load()).To(Equal(int32(2)))
+	})
+
+	It("should give up after the maximum number of retries", func() {
+		failures = 3
+		Expect(fetch(fastRetry(2))).NotTo(Succeed())
+		Expect(calls.Load()).To(Equal(int32(3)))
+	})
+
+	It("should not retry when retries are disabled", func() {
+		failures = 1
+		Expect(fetch(fastRetry(0))).NotTo(Succeed())
+		Expect(calls.Load()).To(Equal(int32(1)))
+	})
+
+	It("should not retry client errors", func() {
+		failures, status = 1, http.StatusForbidden
+		err := fetch(fastRetry(3))
+		Expect(vault.IsPermissionDenied(err)).To(BeTrue())
+		Expect(calls.Load()).To(Equal(int32(1)))
+	})
+
+	It("should retry connection errors", func() {
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				Expect(err).NotTo(HaveOccurred())
+				_ = conn.Close()
+				return
+			}
+			writeVaultResponse(w, vault.OIDCTokenResponse{
+				Data: vault.OIDCTokenData{Token: createTestJWT(time.Now().Add(time.Hour).Unix())},
+			})
+		})
+		Expect(fetch(fastRetry(1))).To(Succeed())
+		Expect(calls.Load()).To(Equal(int32(2)))
+	})
+
+	It("should not retry writes that reached Vault", func() {
+		failures = 1
+		client, err := vault.NewClient(server.URL, fastRetry(3))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.IssueCertificate(context.Background(), "pki/issue/kubernetes", vault.CertificateRequest{})
+		Expect(vault.IsUnavailable(err)).To(BeTrue())
+		Expect(calls.Load()).To(Equal(int32(1)))
+	})
+
+	It("should retry writes that could not connect to Vault", func() {
+		// Nothing listens on the address of a closed server.
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+
+		client, err := vault.NewClient(closed.URL, vault.WithRetry(vault.RetryConfig{MaxRetries: 2, WaitMin: 100 * time.Millisecond, WaitMax: 100 * time.Millisecond}))
+		Expect(err).NotTo(HaveOccurred())
+		start := time.Now()
+		_, err = client.IssueCertificate(context.Background(), "pki/issue/kubernetes", vault.CertificateRequest{})
+		Expect(vault.IsUnavailable(err)).To(BeTrue())
+		// Two retries wait at least half of WaitMax each.
+		Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+	})
+
+	It("should stop retrying at the timeout", func() {
+		failures = 100
+		start := time.Now()
+		err := fetch(
+			vault.WithRetry(vault.RetryConfig{MaxRetries: 100, WaitMin: 50 * time.Millisecond, WaitMax: 50 * time.Millisecond}),
+			vault.WithTimeout(200*time.Millisecond),
+		)
+		Expect(err).To(MatchError(ContainSubstring("context deadline exceeded")))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(calls.Load()).To(BeNumerically("<", 10))
+	})
+})
@@ -0,0 +1,80 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TokenInfo describes the client token, as returned by auth/token/lookup-self.
+type TokenInfo struct {
+	// ExpireTime is zero for tokens that do not expire, such as root tokens.
+	ExpireTime time.Time
+	// CreationTTL is the TTL the token was created or last renewed with.
+	CreationTTL time.Duration
+	Renewable   bool
+}
+
+// NeedsRenewal reports whether the token has less than a third of its TTL
+// or minRemaining left at now.
+func (t *TokenInfo) NeedsRenewal(now time.Time, minRemaining time.Duration) bool {
+	if t.ExpireTime.IsZero() {
+		return false
+	}
+	remaining := t.ExpireTime.Sub(now)
+	return remaining < minRemaining || remaining < t.CreationTTL/3
+}
+
+// Token returns the client token, from VAULT_TOKEN, ~/.vault-token or a
+// login. It is empty when there is none.
+func (c *Client) Token() string {
+	return c.token
+}
+
+// LookupToken returns the TTL and renewability of the client token.
+func (c *Client) LookupToken(ctx context.Context) (*TokenInfo, error) {
+	const path = "auth/token/lookup-self"
+
+	resp, err := c.read(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up vault token: %w", err)
+	}
+	if resp == nil || resp.Data == nil {
+		return nil, fmt.Errorf("no data returned from vault path: %s", path)
+	}
+
+	var lookup struct {
+		ExpireTime  *time.Time `json:"expire_time"`
+		CreationTTL int64      `json:"creation_ttl"`
+		Renewable   bool       `json:"renewable"`
+	}
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &lookup); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	info := &TokenInfo{
+		CreationTTL: time.Duration(lookup.CreationTTL) * time.Second,
+		Renewable:   lookup.Renewable,
+	}
+	if lookup.ExpireTime != nil {
+		info.ExpireTime = *lookup.ExpireTime
+	}
+	return info, nil
+}
+
+// RenewToken extends the TTL of the client token, up to its maximum TTL.
+func (c *Client) RenewToken(ctx context.Context) (*Auth, error) {
+	const path = "auth/token/renew-self"
+
+	resp, err := c.write(ctx, path, map[string]interface{}{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to renew vault token: %w", err)
+	}
+
+	return authFromResponse(resp, path)
+}
@@ -0,0 +1,126 @@
+package vault_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/efortin/kubectl-auth-vault/internal/vault"
+)
+
+var _ = Describe("Token", func() {
+	var (
+		server  *httptest.Server
+		handler http.HandlerFunc
+	)
+
+	BeforeEach(func() {
+		GinkgoT().Setenv("VAULT_TOKEN", "hvs.test")
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler(w, r)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newClient := func() *vault.Client {
+		client, err := vault.NewClient(server.URL, vault.WithRetry(vault.RetryConfig{}))
+		Expect(err).NotTo(HaveOccurred())
+		return client
+	}
+
+	It("should expose the token from VAULT_TOKEN", func() {
+		Expect(newClient().Token()).To(Equal("hvs.test"))
+	})
+
+	Describe("LookupToken", func() {
+		It("should return the expiry and renewability of the token", func() {
+			expireTime := time.Now().Add(time.Hour).Truncate(time.Second)
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal("/v1/auth/token/lookup-self"))
+				Expect(r.Header.Get("X-Vault-Token")).To(Equal("hvs.test"))
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+					"expire_time":  expireTime.Format(time.RFC3339Nano),
+					"creation_ttl": 7200,
+					"ttl":          3600,
+					"renewable":    true,
+				}})
+			}
+
+			info, err := newClient().LookupToken(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.ExpireTime.Equal(expireTime)).To(BeTrue())
+			Expect(info.CreationTTL).To(Equal(2 * time.Hour))
+			Expect(info.Renewable).To(BeTrue())
+		})
+
+		It("should return a zero expiry for tokens without TTL", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+					"expire_time": nil, "creation_ttl": 0, "renewable": false,
+				}})
+			}
+
+			info, err := newClient().LookupToken(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.ExpireTime.IsZero()).To(BeTrue())
+			Expect(info.NeedsRenewal(time.Now(), time.Hour)).To(BeFalse())
+		})
+
+		It("should report a denied lookup as permission denied", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			}
+
+			_, err := newClient().LookupToken(context.Background())
+			Expect(vault.IsPermissionDenied(err)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring("failed to look up vault token")))
+		})
+	})
+
+	Describe("RenewToken", func() {
+		It("should return the new expiry of the token", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal(http.MethodPost))
+				Expect(r.URL.Path).To(Equal("/v1/auth/token/renew-self"))
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"data": nil,
+					"auth": map[string]interface{}{"client_token": "hvs.test", "lease_duration": 3600, "renewable": true},
+				})
+			}
+
+			auth, err := newClient().RenewToken(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(auth.Exp).To(BeNumerically("~", time.Now().Add(time.Hour).Unix(), 5))
+		})
+	})
+
+	Describe("NeedsRenewal", func() {
+		now := time.Now()
+
+		It("should renew with less than a third of the TTL left", func() {
+			info := &vault.TokenInfo{ExpireTime: now.Add(30 * time.Minute), CreationTTL: 2 * time.Hour}
+			Expect(info.NeedsRenewal(now, time.Minute)).To(BeTrue())
+		})
+
+		It("should renew with less than the minimum remaining lifetime", func() {
+			info := &vault.TokenInfo{ExpireTime: now.Add(2 * time.Minute), CreationTTL: 5 * time.Minute}
+			Expect(info.NeedsRenewal(now, 5*time.Minute)).To(BeTrue())
+		})
+
+		It("should not renew a fresh token", func() {
+			info := &vault.TokenInfo{ExpireTime: now.Add(90 * time.Minute), CreationTTL: 2 * time.Hour}
+			Expect(info.NeedsRenewal(now, 5*time.Minute)).To(BeFalse())
+		})
+	})
+})